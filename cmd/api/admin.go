@@ -0,0 +1,236 @@
+package main
+
+import (
+	"crypto/rand"
+	"errors"
+	"net/http"
+
+	"github.com/Blue-Davinci/musical-zoe/internal/data"
+	"github.com/Blue-Davinci/musical-zoe/internal/validator"
+	"go.uber.org/zap"
+)
+
+// listUsersHandler() returns a page of users for operators. The results can be filtered
+// by activation status, creation date and a case-insensitive email search.
+func (app *application) listUsersHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.UserFilters
+		data.Filters
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+	input.Activated = app.readBool(qs, "activated", v)
+	input.CreatedAfter = app.readTime(qs, "created_after", v)
+	input.CreatedBefore = app.readTime(qs, "created_before", v)
+	input.Email = app.readString(qs, "email", "")
+	input.Page = app.readInt(qs, "page", 1, v)
+	input.PageSize = app.readInt(qs, "page_size", data.DefaultPageSize, v)
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	users, metadata, err := app.models.Users.GetAll(input.UserFilters, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	profiles := make([]data.UserProfile, 0, len(users))
+	for _, user := range users {
+		profiles = append(profiles, user.Profile())
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"users": profiles, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showUserHandler() returns a single user along with the permissions they hold.
+func (app *application) showUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.readUserParam(w, r)
+	if !ok {
+		return
+	}
+	permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"user": user.Profile(), "permissions": permissions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateUserActivationHandler() activates or deactivates a user. Deactivating a user
+// suspends the account, so that unlike one that was never activated its owner can't
+// activate it again, and revokes their tokens so that they are signed out straight away.
+func (app *application) updateUserActivationHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.readUserParam(w, r)
+	if !ok {
+		return
+	}
+	expectedVersion, ok, err := app.readIfMatchVersion(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if ok && expectedVersion != user.Version {
+		app.editConflictResponse(w, r)
+		return
+	}
+	var input struct {
+		Activated *bool `json:"activated"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if v.Check(input.Activated != nil, "activated", "must be provided"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	user.Activated = *input.Activated
+	user.Suspended = !*input.Activated
+	err = app.models.Users.UpdateUser(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrGeneralEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if !user.Activated {
+		err = app.revokeAllTokens(user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		app.recordAuditEvent(r, data.AuditEventTokenRevoke, user.ID, user.Email, app.adminAuditMetadata(r, "deactivated by an operator"))
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"user": user.Profile()}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// forcePasswordResetHandler() replaces a user's password with a random one, revokes all
+// of their tokens and emails them a password reset link, so that the only way back into
+// the account is through their inbox.
+func (app *application) forcePasswordResetHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.readUserParam(w, r)
+	if !ok {
+		return
+	}
+	err := user.Password.Set(rand.Text())
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.models.Users.UpdateUser(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrGeneralEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.revokeAllTokens(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.recordAuditEvent(r, data.AuditEventPasswordChange, user.ID, user.Email, app.adminAuditMetadata(r, "reset forced by an operator"))
+	token, err := app.models.Tokens.New(user.ID, data.DefaultPasswordResetTokenExpiryTime, data.ScopePasswordReset)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	emailData := map[string]any{
+		"passwordResetURL":   app.config.url.passwordResetURL + token.Plaintext,
+		"passwordResetToken": token.Plaintext,
+		"userName":           user.Name,
+	}
+	err = app.sendEmail(user.Email, "user_password_reset.tmpl", user.Locale, emailData)
+	if err != nil {
+		app.logger.Error("failed to send password reset email", zap.String("email", user.Email), zap.Error(err))
+	}
+	err = app.writeJSON(w, http.StatusAccepted, envelope{"message": "the user's password was reset and a reset link has been emailed to them"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// revokeUserTokensHandler() signs a user out everywhere by revoking all of their tokens
+// and personal API keys.
+func (app *application) revokeUserTokensHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.readUserParam(w, r)
+	if !ok {
+		return
+	}
+	err := app.revokeAllTokens(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.recordAuditEvent(r, data.AuditEventTokenRevoke, user.ID, user.Email, app.adminAuditMetadata(r, "revoked by an operator"))
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "all of the user's tokens were revoked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteUserHandler() permanently deletes a user and, through the foreign keys, all of
+// their tokens, keys and linked identities. Their audit events are kept but anonymised.
+func (app *application) deleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.readUserParam(w, r)
+	if !ok {
+		return
+	}
+	err := app.deleteAccount(r, user, app.adminAuditMetadata(r, "deleted by an operator"))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrGeneralRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "user successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readUserParam() loads the user named by the "id" URL parameter, writing a 404 and
+// returning false if there is no such user.
+func (app *application) readUserParam(w http.ResponseWriter, r *http.Request) (*data.User, bool) {
+	userID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+	user, err := app.models.Users.GetByID(userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrGeneralRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+	return user, true
+}
+
+// adminAuditMetadata() describes an operator action for the audit log, noting which
+// operator performed it.
+func (app *application) adminAuditMetadata(r *http.Request, reason string) map[string]any {
+	return map[string]any{"reason": reason, "operator_id": app.contextGetUser(r).ID}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestListUsersHandlerEscapesEmailSearch(t *testing.T) {
+	tests := []struct {
+		name     string
+		email    string
+		expected string
+	}{
+		{name: "plain search", email: "example.com", expected: "example.com"},
+		{name: "underscore", email: "zoe_b", expected: `zoe\_b`},
+		{name: "percent", email: "100%", expected: `100\%`},
+		{name: "backslash", email: `zoe\`, expected: `zoe\\`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, mock := newTestApplication(t)
+			mock.ExpectQuery(query("CountUsers")).WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), tt.expected).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+			mock.ExpectQuery(query("ListUsers")).WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), tt.expected, sqlmock.AnyArg(), sqlmock.AnyArg()).
+				WillReturnRows(sqlmock.NewRows(userColumns))
+			r := httptest.NewRequest(http.MethodGet, "/v1/admin/users?email="+url.QueryEscape(tt.email), nil)
+			rr := httptest.NewRecorder()
+			app.listUsersHandler(rr, r)
+
+			if rr.Code != http.StatusOK {
+				t.Errorf("expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestDeleteUserHandler(t *testing.T) {
+	operator := testUser{ID: 1, Name: "Operator", Email: "ops@example.com", Password: "pa55word1234", Activated: true, Version: 1}
+	user := testUser{ID: 7, Name: "Zoe", Email: "zoe@example.com", Password: "pa55word1234", Activated: true, Version: 1}
+
+	tests := []struct {
+		name           string
+		id             string
+		expect         func(mock sqlmock.Sqlmock)
+		expectedStatus int
+	}{
+		{
+			name: "audits the deletion and anonymises the user's events",
+			id:   "7",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(query("GetUserByID")).WillReturnRows(user.rows(t))
+				mock.ExpectQuery(query("InsertAuditEvent")).WithArgs(int64(7), "zoe@example.com", "account.delete", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(1, time.Now()))
+				mock.ExpectExec(query("DeleteUser")).WithArgs(int64(7), "zoe@example.com").WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "unknown user",
+			id:   "8",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(query("GetUserByID")).WillReturnRows(sqlmock.NewRows(userColumns))
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, mock := newTestApplication(t)
+			op := operator.load(t, app, mock)
+			tt.expect(mock)
+			r := httptest.NewRequest(http.MethodDelete, "/v1/admin/users/"+tt.id, nil)
+			r = withURLParam(app.contextSetUser(r, op), "id", tt.id)
+			rr := httptest.NewRecorder()
+			app.deleteUserHandler(rr, r)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestRevokeUserTokensHandler(t *testing.T) {
+	operator := testUser{ID: 1, Name: "Operator", Email: "ops@example.com", Password: "pa55word1234", Activated: true, Version: 1}
+	user := testUser{ID: 7, Name: "Zoe", Email: "zoe@example.com", Password: "pa55word1234", Activated: true, Version: 1}
+	app, mock := newTestApplication(t)
+	op := operator.load(t, app, mock)
+	mock.ExpectQuery(query("GetUserByID")).WillReturnRows(user.rows(t))
+	expectAllTokensRevoked(mock, 7)
+	mock.ExpectQuery(query("InsertAuditEvent")).WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(1, time.Now()))
+
+	r := httptest.NewRequest(http.MethodDelete, "/v1/admin/users/7/tokens", nil)
+	r = withURLParam(app.contextSetUser(r, op), "id", "7")
+	rr := httptest.NewRecorder()
+	app.revokeUserTokensHandler(rr, r)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+}
+
+func TestUpdateUserActivationHandler(t *testing.T) {
+	operator := testUser{ID: 1, Name: "Operator", Email: "ops@example.com", Password: "pa55word1234", Activated: true, Version: 1}
+	activated := testUser{ID: 7, Name: "Zoe", Email: "zoe@example.com", Password: "pa55word1234", Activated: true, Version: 1}
+	suspended := testUser{ID: 7, Name: "Zoe", Email: "zoe@example.com", Password: "pa55word1234", Suspended: true, Version: 2}
+
+	expectUpdate := func(mock sqlmock.Sqlmock, u testUser, activate bool) {
+		mock.ExpectQuery(query("GetUserByID")).WillReturnRows(u.rows(t))
+		mock.ExpectQuery(query("UpdateUser")).
+			WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), activate, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), !activate, u.ID, u.Version).
+			WillReturnRows(sqlmock.NewRows([]string{"version", "updated_at"}).AddRow(u.Version+1, time.Now()))
+	}
+
+	tests := []struct {
+		name      string
+		activated bool
+		expect    func(mock sqlmock.Sqlmock)
+	}{
+		{
+			name:      "deactivating suspends the account and signs the user out",
+			activated: false,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUpdate(mock, activated, false)
+				expectAllTokensRevoked(mock, 7)
+				mock.ExpectQuery(query("InsertAuditEvent")).WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(1, time.Now()))
+			},
+		},
+		{
+			name:      "reactivating lifts the suspension",
+			activated: true,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUpdate(mock, suspended, true)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, mock := newTestApplication(t)
+			op := operator.load(t, app, mock)
+			tt.expect(mock)
+			r := newJSONRequest(t, http.MethodPatch, "/v1/admin/users/7", map[string]bool{"activated": tt.activated})
+			r = withURLParam(app.contextSetUser(r, op), "id", "7")
+			rr := httptest.NewRecorder()
+			app.updateUserActivationHandler(rr, r)
+
+			if rr.Code != http.StatusOK {
+				t.Errorf("expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Blue-Davinci/musical-zoe/internal/data"
+	"github.com/Blue-Davinci/musical-zoe/internal/validator"
+)
+
+// createPersonalApiKeyHandler() creates a named personal API key for server-to-server
+// clients. The plaintext key is only ever returned in this response.
+func (app *application) createPersonalApiKeyHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name   string     `json:"name"`
+		Scopes []string   `json:"scopes"`
+		Expiry *time.Time `json:"expiry"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	user := app.contextGetUser(r)
+	apiKey := &data.PersonalApiKey{
+		Name:   input.Name,
+		Scopes: input.Scopes,
+		Expiry: input.Expiry,
+	}
+	v := validator.New()
+	data.ValidatePersonalApiKey(v, apiKey)
+	if data.ValidatePersonalApiKeyExpiry(v, apiKey.Expiry); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	// keep the number of keys per user bounded
+	count, err := app.models.ApiKeys.CountForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if count >= data.MaxPersonalApiKeysPerUser {
+		v.AddError("name", fmt.Sprintf("you can have at most %d api keys, delete one before creating another", data.MaxPersonalApiKeysPerUser))
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	apiKey, err = app.models.ApiKeys.New(user.ID, apiKey.Name, apiKey.Scopes, apiKey.Expiry)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.recordAuditEvent(r, data.AuditEventTokenCreate, user.ID, user.Email, map[string]any{"personal_api_key_id": apiKey.ID, "name": apiKey.Name, "scopes": apiKey.Scopes})
+	env := envelope{
+		"api_key": apiKey,
+		"message": "store this key somewhere safe, it will not be shown again",
+	}
+	err = app.writeJSON(w, http.StatusCreated, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getPersonalApiKeysHandler() lists the user's personal API keys without their secrets.
+func (app *application) getPersonalApiKeysHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	apiKeys, err := app.models.ApiKeys.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"api_keys": apiKeys}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getPersonalApiKeyHandler() returns a single personal API key owned by the user.
+func (app *application) getPersonalApiKeyHandler(w http.ResponseWriter, r *http.Request) {
+	keyID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	user := app.contextGetUser(r)
+	apiKey, err := app.models.ApiKeys.GetForUser(keyID, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrGeneralRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"api_key": apiKey}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updatePersonalApiKeyHandler() renames a personal API key and/or replaces its scopes.
+// The key itself and its expiry never change.
+func (app *application) updatePersonalApiKeyHandler(w http.ResponseWriter, r *http.Request) {
+	keyID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	user := app.contextGetUser(r)
+	apiKey, err := app.models.ApiKeys.GetForUser(keyID, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrGeneralRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	var input struct {
+		Name   *string  `json:"name"`
+		Scopes []string `json:"scopes"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if input.Name != nil {
+		apiKey.Name = *input.Name
+	}
+	if input.Scopes != nil {
+		apiKey.Scopes = input.Scopes
+	}
+	v := validator.New()
+	if data.ValidatePersonalApiKey(v, apiKey); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.ApiKeys.Update(apiKey)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrGeneralRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"api_key": apiKey}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deletePersonalApiKeyHandler() permanently revokes one of the user's personal API keys.
+func (app *application) deletePersonalApiKeyHandler(w http.ResponseWriter, r *http.Request) {
+	keyID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	user := app.contextGetUser(r)
+	err = app.models.ApiKeys.DeleteForUser(keyID, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrGeneralRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.recordAuditEvent(r, data.AuditEventTokenRevoke, user.ID, user.Email, map[string]any{"personal_api_key_id": keyID})
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "api key successfully revoked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
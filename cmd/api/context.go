@@ -15,6 +15,16 @@ type contextKey string
 // in the request context.
 const userContextKey = contextKey("user")
 
+// apiKeyContextKey holds the personal API key used to authenticate the request, if any,
+// and apiKeyScopeContextKey records that the route has checked the key's scopes.
+const (
+	apiKeyContextKey      = contextKey("api_key")
+	apiKeyScopeContextKey = contextKey("api_key_scope_checked")
+)
+
+// requestIDContextKey holds the ID assigned to the request by the requestID middleware.
+const requestIDContextKey = contextKey("request_id")
+
 // The contextSetUser() method returns a new copy of the request with the provided
 // User struct added to the context. Note that we use our userContextKey constant as the
 // key.
@@ -35,3 +45,44 @@ func (app *application) contextGetUser(r *http.Request) *data.User {
 	}
 	return user
 }
+
+// The contextSetApiKey() method adds the personal API key used to authenticate the
+// request to the context.
+func (app *application) contextSetApiKey(r *http.Request, apiKey *data.PersonalApiKey) *http.Request {
+	ctx := context.WithValue(r.Context(), apiKeyContextKey, apiKey)
+	return r.WithContext(ctx)
+}
+
+// The contextGetApiKey() method returns the personal API key used to authenticate the
+// request, or nil if the request used a bearer token or no credentials at all.
+func (app *application) contextGetApiKey(r *http.Request) *data.PersonalApiKey {
+	apiKey, ok := r.Context().Value(apiKeyContextKey).(*data.PersonalApiKey)
+	if !ok {
+		return nil
+	}
+	return apiKey
+}
+
+// contextSetApiKeyScopeChecked() and contextApiKeyScopeChecked() mark and report that a
+// route accepting personal API keys has verified the key's scope.
+func (app *application) contextSetApiKeyScopeChecked(r *http.Request) *http.Request {
+	ctx := context.WithValue(r.Context(), apiKeyScopeContextKey, true)
+	return r.WithContext(ctx)
+}
+
+func (app *application) contextApiKeyScopeChecked(r *http.Request) bool {
+	checked, _ := r.Context().Value(apiKeyScopeContextKey).(bool)
+	return checked
+}
+
+// contextSetRequestID() and contextGetRequestID() store and fetch the request's ID. An
+// empty string is returned if the requestID middleware hasn't run.
+func (app *application) contextSetRequestID(r *http.Request, requestID string) *http.Request {
+	ctx := context.WithValue(r.Context(), requestIDContextKey, requestID)
+	return r.WithContext(ctx)
+}
+
+func (app *application) contextGetRequestID(r *http.Request) string {
+	requestID, _ := r.Context().Value(requestIDContextKey).(string)
+	return requestID
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/Blue-Davinci/musical-zoe/internal/mailer"
+	"github.com/Blue-Davinci/musical-zoe/internal/validator"
+	"github.com/go-chi/chi"
+)
+
+// devRoutes() provides helpers that only make sense on a developer's machine. They are
+// mounted only when running with -env=development.
+func (app *application) devRoutes() chi.Router {
+	devRoutes := chi.NewRouter()
+	// /outbox : emails captured by the file or memory mail transport
+	devRoutes.Get("/outbox", app.getOutboxHandler)
+	// /emails : preview any email template rendered with sample data
+	devRoutes.Get("/emails", app.listEmailTemplatesHandler)
+	devRoutes.Get("/emails/{template}", app.previewEmailTemplateHandler)
+	return devRoutes
+}
+
+// getOutboxHandler() lists the emails captured by the mail transport, newest first. It
+// can be narrowed to a single recipient with ?to=. Transports that send the emails on,
+// such as SMTP, keep nothing to show and respond with 404.
+func (app *application) getOutboxHandler(w http.ResponseWriter, r *http.Request) {
+	outbox, ok := app.mailer.Outbox()
+	if !ok {
+		app.notFoundResponse(w, r)
+		return
+	}
+	messages, err := outbox.Messages()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	to := app.readString(r.URL.Query(), "to", "")
+	if to != "" {
+		messages = slices.DeleteFunc(messages, func(msg mailer.Message) bool {
+			return msg.To != to
+		})
+	}
+	slices.Reverse(messages)
+	err = app.writeJSON(w, http.StatusOK, envelope{"messages": messages}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listEmailTemplatesHandler() lists the email templates that can be previewed, along with
+// the supported locales and the ones each template has been translated into.
+func (app *application) listEmailTemplatesHandler(w http.ResponseWriter, r *http.Request) {
+	templates, err := mailer.Templates()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	translations := map[string][]string{}
+	for _, name := range templates {
+		if locales := mailer.Translations(name); len(locales) > 0 {
+			translations[name] = locales
+		}
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"templates": templates, "locales": mailer.Locales, "translations": translations}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// previewEmailTemplateHandler() renders an email template with sample data. The HTML
+// body is returned as a page that can be opened in a browser; ?format=text returns the
+// plain text body and ?format=json the whole message, subject included. ?locale= previews
+// the email as a user with that locale would receive it.
+func (app *application) previewEmailTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	templates, err := mailer.Templates()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	name := chi.URLParam(r, "template")
+	if !slices.Contains(templates, name) {
+		app.notFoundResponse(w, r)
+		return
+	}
+	v := validator.New()
+	format := app.readString(r.URL.Query(), "format", "html")
+	v.Check(validator.PermittedValue(format, "html", "text", "json"), "format", "must be html, text or json")
+	locale := app.validateLocale(v, app.readString(r.URL.Query(), "locale", mailer.DefaultLocale))
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	msg, err := app.mailer.Preview(name, locale)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	switch format {
+	case "json":
+		err = app.writeJSON(w, http.StatusOK, envelope{"message": msg}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+	case "text":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte(msg.PlainBody))
+	default:
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(msg.HTMLBody))
+	}
+}
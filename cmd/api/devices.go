@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Blue-Davinci/musical-zoe/internal/data"
+	"github.com/Blue-Davinci/musical-zoe/internal/validator"
+	"github.com/tomasen/realip"
+	"go.uber.org/zap"
+)
+
+// notifyNewDevice() remembers the IP address and user-agent a user has just logged in
+// from and, if the pair has not been seen for them before, emails them the details along
+// with a one-click link that signs out every session. It runs in the background so the
+// login itself is never slowed down or failed by it.
+func (app *application) notifyNewDevice(r *http.Request, user *data.User) {
+	ipAddress := realip.FromRequest(r)
+	userAgent := r.UserAgent()
+	loginTime := time.Now()
+	app.background(func() {
+		isNew, err := app.models.KnownDevices.Remember(user.ID, ipAddress, userAgent)
+		if err != nil {
+			app.logger.Error("failed to record known device", zap.Int64("user_id", user.ID), zap.Error(err))
+			return
+		}
+		if !isNew {
+			return
+		}
+		token, err := app.models.Tokens.New(user.ID, data.DefaultRevokeSessionsExpiryTime, data.ScopeRevokeSessions)
+		if err != nil {
+			app.logger.Error("failed to create revoke sessions token", zap.Int64("user_id", user.ID), zap.Error(err))
+			return
+		}
+		device := userAgent
+		if device == "" {
+			device = "Unknown device"
+		}
+		data := map[string]any{
+			"userName":          user.Name,
+			"device":            device,
+			"ipAddress":         ipAddress,
+			"loginTime":         loginTime,
+			"revokeSessionsURL": app.config.url.revokeSessionsURL + token.Plaintext,
+		}
+		err = app.sendEmail(user.Email, "user_new_device_login.tmpl", user.Locale, data)
+		if err != nil {
+			app.logger.Error("Error sending new device login email", zap.String("email", user.Email), zap.Error(err))
+		}
+	})
+}
+
+// revokeSessionsHandler() redeems the "this wasn't me" token from a new device alert. It
+// signs the user out everywhere, revokes their personal API keys and stops trusting their
+// known devices, so the next login from any device, including the unrecognised one, is
+// reported again.
+func (app *application) revokeSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		TokenPlaintext string `json:"token"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if data.ValidateTokenPlaintext(v, input.TokenPlaintext); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	user, err := app.models.Users.GetForToken(data.ScopeRevokeSessions, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrGeneralRecordNotFound):
+			v.AddError("token", "invalid or expired revoke sessions token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.revokeAllTokens(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.models.KnownDevices.RevokeAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.recordAuditEvent(r, data.AuditEventTokenRevoke, user.ID, user.Email, map[string]any{"reason": "unrecognised login reported"})
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "all sessions have been signed out, we recommend resetting your password"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestNotifyNewDevice(t *testing.T) {
+	user := testUser{ID: 7, Name: "Zoe", Email: "zoe@example.com", Password: "pa55word1234", Activated: true, Version: 1}
+	deviceColumns := []string{"id", "inserted", "was_revoked"}
+
+	expectAlert := func(mock sqlmock.Sqlmock) {
+		mock.ExpectQuery(query("InsertApiKey")).WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(1, time.Now()))
+		mock.ExpectQuery(query("InsertEmailOutboxMessage")).WillReturnRows(sqlmock.NewRows([]string{"id", "status", "next_attempt_at", "updated_at"}).AddRow(1, "pending", time.Now(), time.Now()))
+	}
+
+	tests := []struct {
+		name   string
+		expect func(mock sqlmock.Sqlmock)
+	}{
+		{
+			name: "first device is not reported",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(query("UpsertKnownDevice")).WillReturnRows(sqlmock.NewRows(deviceColumns).AddRow(1, true, false))
+				mock.ExpectQuery(query("CountKnownDevicesForUser")).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+			},
+		},
+		{
+			name: "known device is not reported",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(query("UpsertKnownDevice")).WillReturnRows(sqlmock.NewRows(deviceColumns).AddRow(1, false, false))
+			},
+		},
+		{
+			name: "new device is reported",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(query("UpsertKnownDevice")).WillReturnRows(sqlmock.NewRows(deviceColumns).AddRow(2, true, false))
+				mock.ExpectQuery(query("CountKnownDevicesForUser")).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+				expectAlert(mock)
+			},
+		},
+		{
+			name: "known device is reported again after sessions were revoked",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(query("UpsertKnownDevice")).WillReturnRows(sqlmock.NewRows(deviceColumns).AddRow(1, false, true))
+				expectAlert(mock)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, mock := newTestApplication(t)
+			u := user.load(t, app, mock)
+			tt.expect(mock)
+			r := httptest.NewRequest(http.MethodPost, "/v1/api/authentication", nil)
+			r.Header.Set("User-Agent", "Mozilla/5.0")
+			app.notifyNewDevice(r, u)
+		})
+	}
+}
+
+func TestRevokeSessionsHandler(t *testing.T) {
+	user := testUser{ID: 7, Name: "Zoe", Email: "zoe@example.com", Password: "pa55word1234", Activated: true, Version: 1}
+
+	tests := []struct {
+		name           string
+		expect         func(mock sqlmock.Sqlmock)
+		expectedStatus int
+	}{
+		{
+			name: "signs out everywhere and revokes api keys and devices",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(query("GetForToken")).WillReturnRows(user.rows(t))
+				expectAllTokensRevoked(mock, 7)
+				mock.ExpectExec(query("RevokeKnownDevicesForUser")).WillReturnResult(sqlmock.NewResult(0, 3))
+				mock.ExpectQuery(query("InsertAuditEvent")).WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(1, time.Now()))
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "expired token",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(query("GetForToken")).WillReturnRows(sqlmock.NewRows(userColumns))
+			},
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, mock := newTestApplication(t)
+			tt.expect(mock)
+			r := newJSONRequest(t, http.MethodPut, "/v1/api/sessions/revoke", map[string]string{"token": "ABCDEFGHIJKLMNOPQRSTUVWXYZ"})
+			rr := httptest.NewRecorder()
+			app.revokeSessionsHandler(rr, r)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,445 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"expvar"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // subscribers' time zones must load even where the OS has no zoneinfo
+
+	"github.com/Blue-Davinci/musical-zoe/internal/data"
+	"github.com/Blue-Davinci/musical-zoe/internal/mailer"
+	"github.com/Blue-Davinci/musical-zoe/internal/validator"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultDigestBatchSize caps how many digests one scheduler run sends, any others
+	// stay due and are picked up by the next run.
+	DefaultDigestBatchSize = 100
+	// DefaultDigestItemLimit is how many tracks, artists and headlines a digest lists.
+	DefaultDigestItemLimit = 5
+	// DefaultDigestPeriod is the Last.fm chart period the digest's tracks and artists
+	// come from.
+	DefaultDigestPeriod = "7day"
+)
+
+// digestMetrics exposes running totals of the digest scheduler's work under "digest"
+// on the /debug/vars endpoint.
+var digestMetrics = expvar.NewMap("digest")
+
+// digestCharts holds the week's top tracks and artists, which are the same in every
+// digest, in the form the template expects.
+type digestCharts struct {
+	tracks  []map[string]string
+	artists []map[string]string
+}
+
+// startDigestScheduler() sends due weekly digests every digest interval until ctx is
+// cancelled. It is tracked by app.wg so that shutdown waits for a run in progress.
+func (app *application) startDigestScheduler(ctx context.Context) {
+	if app.config.digest.interval <= 0 {
+		app.logger.Info("digest scheduler disabled")
+		return
+	}
+	app.wg.Add(1)
+	go func() {
+		defer app.wg.Done()
+		ticker := time.NewTicker(app.config.digest.interval)
+		defer ticker.Stop()
+		app.logger.Info("digest scheduler started", zap.Duration("interval", app.config.digest.interval))
+		for {
+			select {
+			case <-ctx.Done():
+				app.logger.Info("digest scheduler stopped")
+				return
+			case <-ticker.C:
+				app.runDigests()
+			}
+		}
+	}()
+}
+
+// runDigests() sends one batch of due digests, and the counts are logged and added to
+// the expvar totals.
+func (app *application) runDigests() {
+	defer func() {
+		if err := recover(); err != nil {
+			app.logger.Error("digest scheduler panicked", zap.Any("error", err))
+		}
+	}()
+	now := time.Now()
+	sent, failed := app.sendDueDigests(now)
+
+	digestMetrics.Add("runs", 1)
+	digestMetrics.Add("digests_sent", sent)
+	digestMetrics.Add("digests_failed", failed)
+	lastRun := new(expvar.String)
+	lastRun.Set(now.UTC().Format(time.RFC3339))
+	digestMetrics.Set("last_run", lastRun)
+
+	if sent > 0 || failed > 0 {
+		app.logger.Info("digest run complete",
+			zap.Int64("digests_sent", sent),
+			zap.Int64("digests_failed", failed),
+			zap.Duration("took", time.Since(now)),
+		)
+	}
+}
+
+// sendDueDigests() queues the digests that are due at now. Each digest is claimed before
+// it is sent, which moves it on to the following week, so that it is sent once even when
+// several instances are running. The charts are fetched once per run; if that fails the
+// run is abandoned and the digests stay due. It returns how many digests were sent and
+// how many failed.
+func (app *application) sendDueDigests(now time.Time) (int64, int64) {
+	digests, err := app.models.Digests.GetDue(now, DefaultDigestBatchSize)
+	if err != nil {
+		app.logger.Error("digest scheduler failed to fetch due digests", zap.Error(err))
+		return 0, 0
+	}
+	if len(digests) == 0 {
+		return 0, 0
+	}
+	charts, err := app.fetchDigestCharts()
+	if err != nil {
+		app.logger.Error("digest scheduler failed to fetch charts", zap.Error(err))
+		return 0, 0
+	}
+	// headlines depend on the subscriber's country and genres, so fetch each combination once
+	headlines := make(map[string][]map[string]string)
+	var sent, failed int64
+	for _, digest := range digests {
+		subscription, user := digest.Subscription, digest.User
+		claimed, err := app.models.Digests.Claim(user.ID, *subscription.NextSendAt, nextDigestSendAt(subscription, now))
+		if err != nil {
+			app.logger.Error("digest scheduler failed to claim digest", zap.Int64("user_id", user.ID), zap.Error(err))
+			failed++
+			continue
+		}
+		if !claimed {
+			continue
+		}
+		query := digestGenreQuery(subscription.Genres)
+		key := subscription.Country + "|" + query
+		if _, ok := headlines[key]; !ok {
+			headlines[key] = app.fetchDigestHeadlines(subscription.Country, query)
+		}
+		err = app.sendDigest(digest, charts, headlines[key], now)
+		if err != nil {
+			app.logger.Error("failed to send weekly digest email", zap.String("email", user.Email), zap.Error(err))
+			failed++
+			continue
+		}
+		sent++
+	}
+	return sent, failed
+}
+
+// sendDigest() queues a single digest with a one-click unsubscribe link, which is also
+// advertised in the List-Unsubscribe headers so that mail clients can show their own
+// unsubscribe button.
+func (app *application) sendDigest(digest *data.DueDigest, charts *digestCharts, headlines []map[string]string, now time.Time) error {
+	subscription, user := digest.Subscription, digest.User
+	token, err := app.models.Tokens.New(user.ID, data.DefaultUnsubscribeTokenExpiryTime, data.ScopeUnsubscribe)
+	if err != nil {
+		return err
+	}
+	unsubscribeURL := app.config.url.digestUnsubscribeURL + token.Plaintext
+	data := map[string]any{
+		"userName":       user.Name,
+		"weekOf":         mailer.Date(now.In(subscription.Location())),
+		"tracks":         charts.tracks,
+		"artists":        charts.artists,
+		"headlines":      headlines,
+		"genres":         strings.Join(subscription.Genres, ", "),
+		"country":        strings.ToUpper(subscription.Country),
+		"unsubscribeURL": unsubscribeURL,
+	}
+	msg, err := app.mailer.Render(user.Email, "user_weekly_digest.tmpl", user.Locale, data)
+	if err != nil {
+		return err
+	}
+	msg.Headers = map[string]string{
+		"List-Unsubscribe":      "<" + unsubscribeURL + ">",
+		"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+	}
+	return app.queueEmail("user_weekly_digest.tmpl", msg)
+}
+
+// fetchDigestCharts() fetches the week's top tracks and artists from Last.fm.
+func (app *application) fetchDigestCharts() (*digestCharts, error) {
+	trends := NewTrendsService(app.config)
+	tracks, err := trends.FetchTopTracks(DefaultDigestItemLimit, DefaultDigestPeriod)
+	if err != nil {
+		return nil, err
+	}
+	artists, err := trends.FetchTopArtists(DefaultDigestItemLimit, DefaultDigestPeriod)
+	if err != nil {
+		return nil, err
+	}
+	charts := &digestCharts{}
+	for _, track := range tracks.Tracks.Track {
+		charts.tracks = append(charts.tracks, map[string]string{"name": track.Name, "artist": track.Artist.Name, "url": track.URL})
+	}
+	for _, artist := range artists.Artists.Artist {
+		charts.artists = append(charts.artists, map[string]string{"name": artist.Name, "url": artist.URL})
+	}
+	return charts, nil
+}
+
+// fetchDigestHeadlines() fetches the music headlines for a country and genre query. The
+// headlines are a nice to have, so on failure the digest is sent without them.
+func (app *application) fetchDigestHeadlines(country, genreQuery string) []map[string]string {
+	news, err := NewNewsService(app.config).FetchMusicNews("headlines", country, genreQuery, DefaultDigestItemLimit)
+	if err != nil {
+		app.logger.Warn("digest scheduler failed to fetch headlines", zap.String("country", country), zap.String("genres", genreQuery), zap.Error(err))
+		return nil
+	}
+	var headlines []map[string]string
+	for _, article := range news.Articles {
+		headlines = append(headlines, map[string]string{"title": article.Title, "source": article.Source.Name, "url": article.URL})
+	}
+	return headlines
+}
+
+// digestGenreQuery() turns the subscriber's genres into a News API query such as
+// ("rock" OR "hip hop"), or "" if they haven't picked any.
+func digestGenreQuery(genres []string) string {
+	if len(genres) == 0 {
+		return ""
+	}
+	quoted := make([]string, len(genres))
+	for i, genre := range genres {
+		quoted[i] = strconv.Quote(genre)
+	}
+	return "(" + strings.Join(quoted, " OR ") + ")"
+}
+
+// nextDigestSendAt() returns the first time strictly after after that falls on the
+// subscription's send day and hour in its time zone. Should the hour not exist on that
+// day because of a daylight saving change, time.Date moves it on by the size of the gap.
+func nextDigestSendAt(subscription *data.DigestSubscription, after time.Time) time.Time {
+	location := subscription.Location()
+	local := after.In(location)
+	days := (int(subscription.SendDay) - int(local.Weekday()) + 7) % 7
+	next := time.Date(local.Year(), local.Month(), local.Day()+days, subscription.SendHour, 0, 0, 0, location)
+	if !next.After(after) {
+		next = time.Date(local.Year(), local.Month(), local.Day()+days+7, subscription.SendHour, 0, 0, 0, location)
+	}
+	return next.UTC()
+}
+
+// getDigestSubscriptionHandler() returns the authenticated user's weekly digest
+// preferences, or the defaults if they have never subscribed.
+func (app *application) getDigestSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	subscription, err := app.models.Digests.Get(user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrGeneralRecordNotFound):
+			subscription = data.NewDigestSubscription(user.ID)
+		default:
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"digest": subscription}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateDigestSubscriptionHandler() subscribes the authenticated user to the weekly
+// digest. Any preferences left out keep their current, or default, values, and the
+// next digest is scheduled for the first send time from now.
+func (app *application) updateDigestSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	var input struct {
+		Genres   []string `json:"genres"`
+		Country  *string  `json:"country"`
+		SendDay  *int     `json:"send_day"`
+		SendHour *int     `json:"send_hour"`
+		Timezone *string  `json:"timezone"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	subscription, err := app.models.Digests.Get(user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrGeneralRecordNotFound):
+			subscription = data.NewDigestSubscription(user.ID)
+		default:
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+	if input.Genres != nil {
+		subscription.Genres = make([]string, len(input.Genres))
+		for i, genre := range input.Genres {
+			subscription.Genres[i] = strings.ToLower(strings.TrimSpace(genre))
+		}
+	}
+	if input.Country != nil {
+		subscription.Country = strings.ToLower(strings.TrimSpace(*input.Country))
+	}
+	if input.SendDay != nil {
+		subscription.SendDay = time.Weekday(*input.SendDay)
+	}
+	if input.SendHour != nil {
+		subscription.SendHour = *input.SendHour
+	}
+	if input.Timezone != nil {
+		subscription.Timezone = strings.TrimSpace(*input.Timezone)
+	}
+	v := validator.New()
+	if data.ValidateDigestSubscription(v, subscription); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Digests.Subscribe(subscription, nextDigestSendAt(subscription, time.Now()))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"digest": subscription}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteDigestSubscriptionHandler() unsubscribes the authenticated user from the weekly
+// digest. Their preferences are kept for if they subscribe again.
+func (app *application) deleteDigestSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	_, err := app.models.Digests.Unsubscribe(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "you have been unsubscribed from the weekly digest"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// digestUnsubscribePage is shown to people who open the unsubscribe link from a digest
+// email in their browser. Opening the link only asks for confirmation, because mail
+// scanners follow links in emails; the form posts back to the same link to unsubscribe.
+var digestUnsubscribePage = template.Must(template.New("unsubscribe").Parse(`<!doctype html>
+<html lang="en">
+<head>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <title>musicalzoe weekly digest</title>
+</head>
+<body style="font-family: Arial, sans-serif; max-width: 32rem; margin: 4rem auto; padding: 0 1rem; color: #333333;">
+    <h1>musicalzoe weekly digest</h1>
+    {{if .Confirm}}
+    <p>Do you want to stop receiving the weekly digest?</p>
+    <form method="post">
+        <input type="hidden" name="List-Unsubscribe" value="One-Click">
+        <button type="submit">Unsubscribe</button>
+    </form>
+    {{else}}
+    <p>{{.Message}}</p>
+    {{end}}
+</body>
+</html>
+`))
+
+// digestUnsubscribePageData is the data for digestUnsubscribePage, either a confirmation
+// form or a message.
+type digestUnsubscribePageData struct {
+	Confirm bool
+	Message string
+}
+
+// writeDigestUnsubscribePage() renders digestUnsubscribePage with the given status.
+func (app *application) writeDigestUnsubscribePage(w http.ResponseWriter, r *http.Request, status int, page digestUnsubscribePageData) {
+	var buf bytes.Buffer
+	err := digestUnsubscribePage.Execute(&buf, page)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+}
+
+// getDigestUnsubscribeHandler() is what a browser opens from the unsubscribe link in a
+// digest email. It checks the token and shows a confirmation form, but never unsubscribes
+// the user itself.
+func (app *application) getDigestUnsubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	token := app.readString(r.URL.Query(), "token", "")
+	v := validator.New()
+	if data.ValidateTokenPlaintext(v, token); !v.Valid() {
+		app.writeDigestUnsubscribePage(w, r, http.StatusUnprocessableEntity, digestUnsubscribePageData{Message: "This unsubscribe link is invalid or has expired."})
+		return
+	}
+	_, err := app.models.Users.GetForToken(data.ScopeUnsubscribe, token)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrGeneralRecordNotFound):
+			app.writeDigestUnsubscribePage(w, r, http.StatusUnprocessableEntity, digestUnsubscribePageData{Message: "This unsubscribe link is invalid or has expired."})
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.writeDigestUnsubscribePage(w, r, http.StatusOK, digestUnsubscribePageData{Confirm: true})
+}
+
+// unsubscribeDigestHandler() unsubscribes the user through the link in a digest email.
+// The token comes from the query string because mail clients that support
+// List-Unsubscribe-Post send a POST to the link as it is, with a form body that we
+// ignore. Browsers submitting the confirmation form ask for HTML and get a page back,
+// everyone else gets JSON. The token is kept so that a repeated click still succeeds.
+func (app *application) unsubscribeDigestHandler(w http.ResponseWriter, r *http.Request) {
+	fromBrowser := strings.Contains(r.Header.Get("Accept"), "text/html")
+	token := app.readString(r.URL.Query(), "token", "")
+	v := validator.New()
+	if data.ValidateTokenPlaintext(v, token); !v.Valid() {
+		if fromBrowser {
+			app.writeDigestUnsubscribePage(w, r, http.StatusUnprocessableEntity, digestUnsubscribePageData{Message: "This unsubscribe link is invalid or has expired."})
+			return
+		}
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	user, err := app.models.Users.GetForToken(data.ScopeUnsubscribe, token)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrGeneralRecordNotFound) && fromBrowser:
+			app.writeDigestUnsubscribePage(w, r, http.StatusUnprocessableEntity, digestUnsubscribePageData{Message: "This unsubscribe link is invalid or has expired."})
+		case errors.Is(err, data.ErrGeneralRecordNotFound):
+			v.AddError("token", "invalid or expired unsubscribe token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	_, err = app.models.Digests.Unsubscribe(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if fromBrowser {
+		app.writeDigestUnsubscribePage(w, r, http.StatusOK, digestUnsubscribePageData{Message: "You have been unsubscribed from the weekly digest."})
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "you have been unsubscribed from the weekly digest"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Blue-Davinci/musical-zoe/internal/data"
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestNextDigestSendAt(t *testing.T) {
+	tests := []struct {
+		name     string
+		sendDay  time.Weekday
+		sendHour int
+		timezone string
+		after    time.Time
+		expected time.Time
+	}{
+		{
+			name:     "later the same week",
+			sendDay:  time.Friday,
+			sendHour: 8,
+			timezone: "UTC",
+			after:    time.Date(2026, time.October, 12, 9, 30, 0, 0, time.UTC), // Monday
+			expected: time.Date(2026, time.October, 16, 8, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "later the same day",
+			sendDay:  time.Monday,
+			sendHour: 18,
+			timezone: "UTC",
+			after:    time.Date(2026, time.October, 12, 9, 30, 0, 0, time.UTC),
+			expected: time.Date(2026, time.October, 12, 18, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "hour already passed",
+			sendDay:  time.Monday,
+			sendHour: 8,
+			timezone: "UTC",
+			after:    time.Date(2026, time.October, 12, 9, 30, 0, 0, time.UTC),
+			expected: time.Date(2026, time.October, 19, 8, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "exactly at the send time",
+			sendDay:  time.Monday,
+			sendHour: 8,
+			timezone: "UTC",
+			after:    time.Date(2026, time.October, 12, 8, 0, 0, 0, time.UTC),
+			expected: time.Date(2026, time.October, 19, 8, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "send day in the subscriber's time zone",
+			sendDay:  time.Tuesday,
+			sendHour: 8,
+			timezone: "Asia/Tokyo",
+			after:    time.Date(2026, time.October, 12, 20, 0, 0, 0, time.UTC), // already Tuesday 05:00 in Tokyo
+			expected: time.Date(2026, time.October, 12, 23, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "across a daylight saving change",
+			sendDay:  time.Monday,
+			sendHour: 8,
+			timezone: "Europe/Paris",
+			after:    time.Date(2026, time.October, 19, 7, 0, 0, 0, time.UTC), // 09:00 CEST
+			expected: time.Date(2026, time.October, 26, 7, 0, 0, 0, time.UTC), // 08:00 CET
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subscription := &data.DigestSubscription{SendDay: tt.sendDay, SendHour: tt.sendHour, Timezone: tt.timezone}
+			got := nextDigestSendAt(subscription, tt.after)
+			if !got.Equal(tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestDigestGenreQuery(t *testing.T) {
+	if got := digestGenreQuery(nil); got != "" {
+		t.Errorf("expected an empty query, got %q", got)
+	}
+	if got, expected := digestGenreQuery([]string{"rock", "hip hop"}), `("rock" OR "hip hop")`; got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
+
+func TestDigestUnsubscribeHandlers(t *testing.T) {
+	user := testUser{ID: 7, Name: "Zoe", Email: "zoe@example.com", Password: "pa55word1234", Activated: true, Version: 1}
+	target := "/v1/api/digest/unsubscribe?token=ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+	tests := []struct {
+		name             string
+		method           string
+		target           string
+		accept           string
+		expect           func(mock sqlmock.Sqlmock)
+		expectedStatus   int
+		expectedType     string
+		expectedContains string
+	}{
+		{
+			name:   "opening the link only asks for confirmation",
+			method: http.MethodGet,
+			target: target,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(query("GetForToken")).WillReturnRows(user.rows(t))
+			},
+			expectedStatus:   http.StatusOK,
+			expectedType:     "text/html",
+			expectedContains: `<form method="post">`,
+		},
+		{
+			name:   "opening an expired link",
+			method: http.MethodGet,
+			target: target,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(query("GetForToken")).WillReturnRows(sqlmock.NewRows(userColumns))
+			},
+			expectedStatus:   http.StatusUnprocessableEntity,
+			expectedType:     "text/html",
+			expectedContains: "invalid or has expired",
+		},
+		{
+			name:             "opening a link without a token",
+			method:           http.MethodGet,
+			target:           "/v1/api/digest/unsubscribe",
+			expect:           func(mock sqlmock.Sqlmock) {},
+			expectedStatus:   http.StatusUnprocessableEntity,
+			expectedType:     "text/html",
+			expectedContains: "invalid or has expired",
+		},
+		{
+			name:   "confirming in the browser",
+			method: http.MethodPost,
+			target: target,
+			accept: "text/html,application/xhtml+xml",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(query("GetForToken")).WillReturnRows(user.rows(t))
+				mock.ExpectExec(query("UnsubscribeDigest")).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			expectedStatus:   http.StatusOK,
+			expectedType:     "text/html",
+			expectedContains: "You have been unsubscribed",
+		},
+		{
+			name:   "one-click unsubscribe from a mail client",
+			method: http.MethodPost,
+			target: target,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(query("GetForToken")).WillReturnRows(user.rows(t))
+				mock.ExpectExec(query("UnsubscribeDigest")).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			expectedStatus:   http.StatusOK,
+			expectedType:     "application/json",
+			expectedContains: "you have been unsubscribed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, mock := newTestApplication(t)
+			tt.expect(mock)
+			r := httptest.NewRequest(tt.method, tt.target, strings.NewReader("List-Unsubscribe=One-Click"))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+			rr := httptest.NewRecorder()
+			if tt.method == http.MethodGet {
+				app.getDigestUnsubscribeHandler(rr, r)
+			} else {
+				app.unsubscribeDigestHandler(rr, r)
+			}
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if got := rr.Header().Get("Content-Type"); !strings.HasPrefix(got, tt.expectedType) {
+				t.Errorf("expected content type %q, got %q", tt.expectedType, got)
+			}
+			if !strings.Contains(rr.Body.String(), tt.expectedContains) {
+				t.Errorf("expected body to contain %q, got %s", tt.expectedContains, rr.Body.String())
+			}
+		})
+	}
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"fmt"
 	"net/http"
+	"time"
 
 	"go.uber.org/zap"
 )
@@ -9,7 +11,7 @@ import (
 func (app *application) logError(r *http.Request, err error) {
 	// Use the PrintError() method to log the error message, and include the current
 	// request method and URL as properties in the log entry.
-	app.logger.Error(err.Error(), zap.String("request_method", r.Method), zap.String("request_url", r.URL.String()))
+	app.logger.Error(err.Error(), zap.String("request_method", r.Method), zap.String("request_url", r.URL.String()), zap.String("request_id", app.contextGetRequestID(r)))
 
 }
 
@@ -58,6 +60,13 @@ func (app *application) inactiveAccountResponse(w http.ResponseWriter, r *http.R
 	app.errorResponse(w, r, http.StatusLocked, message)
 }
 
+// The suspendedAccountResponse() method will return a 403 Forbidden response for an
+// account that an operator has deactivated, which its owner can't activate again.
+func (app *application) suspendedAccountResponse(w http.ResponseWriter, r *http.Request) {
+	message := "your user account has been suspended, please contact support"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
 // The badRequestResponse() method will be used to send a 400 Bad Request status code and
 // JSON response to the client.
 func (app *application) badRequestResponse(w http.ResponseWriter, r *http.Request, err error) {
@@ -77,6 +86,13 @@ func (app *application) editConflictResponse(w http.ResponseWriter, r *http.Requ
 	app.errorResponse(w, r, http.StatusConflict, message)
 }
 
+// The preconditionRequiredResponse() method will return a 428 Precondition Required when
+// an update is sent without the If-Match header it needs to guard against lost updates.
+func (app *application) preconditionRequiredResponse(w http.ResponseWriter, r *http.Request) {
+	message := "this request must include an If-Match header with the version you last read"
+	app.errorResponse(w, r, http.StatusPreconditionRequired, message)
+}
+
 // The invalidCredentialsResponse() method will return invalid token credential error
 func (app *application) invalidCredentialsResponse(w http.ResponseWriter, r *http.Request) {
 	message := "invalid authentication credentials"
@@ -89,3 +105,89 @@ func (app *application) notFoundResponse(w http.ResponseWriter, r *http.Request)
 	message := "the requested resource could not be found"
 	app.errorResponse(w, r, http.StatusNotFound, message)
 }
+
+// The invalidMFACodeResponse() method will return a 401 when a TOTP code does not match
+func (app *application) invalidMFACodeResponse(w http.ResponseWriter, r *http.Request) {
+	message := "invalid or expired multi-factor authentication code"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+// The mfaAlreadyEnabledResponse() method will return a 409 Conflict when a user tries to
+// enroll in MFA while it is already enabled on their account.
+func (app *application) mfaAlreadyEnabledResponse(w http.ResponseWriter, r *http.Request) {
+	message := "multi-factor authentication is already enabled for this account"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+// The invalidRecoveryCodeResponse() method will return a 401 when a recovery code is
+// unknown or has already been used.
+func (app *application) invalidRecoveryCodeResponse(w http.ResponseWriter, r *http.Request) {
+	message := "invalid or already used recovery code"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+// The invalidRefreshTokenResponse() method will return a 401 when a refresh token is
+// unknown, expired or has been revoked.
+func (app *application) invalidRefreshTokenResponse(w http.ResponseWriter, r *http.Request) {
+	message := "invalid or expired refresh token"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+// The oidcLoginFailedResponse() method will return a 401 when an identity provider
+// login is declined or its code or ID token can't be verified.
+func (app *application) oidcLoginFailedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the identity provider login could not be completed"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+// The accountLockedResponse() method will return a 423 Locked when logins for an email
+// address are temporarily locked after too many failed attempts.
+func (app *application) accountLockedResponse(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", retryAfterSeconds(retryAfter))
+	message := "too many failed login attempts, this account is temporarily locked, please try again later"
+	app.errorResponse(w, r, http.StatusLocked, message)
+}
+
+// The tooManyLoginAttemptsResponse() method will return a 429 Too Many Requests when a
+// client IP address has made too many failed login attempts.
+func (app *application) tooManyLoginAttemptsResponse(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", retryAfterSeconds(retryAfter))
+	message := "too many failed login attempts from your network, please try again later"
+	app.errorResponse(w, r, http.StatusTooManyRequests, message)
+}
+
+// The tooManyContactMessagesResponse() method will return a 429 Too Many Requests when a
+// client IP address has sent too many contact form messages.
+func (app *application) tooManyContactMessagesResponse(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", retryAfterSeconds(retryAfter))
+	message := "too many messages sent from your network, please try again later"
+	app.errorResponse(w, r, http.StatusTooManyRequests, message)
+}
+
+// The emailNotRetryableResponse() method will return a 409 Conflict when an operator
+// retries a queued email that has not been dead-lettered.
+func (app *application) emailNotRetryableResponse(w http.ResponseWriter, r *http.Request) {
+	message := "only dead-lettered emails can be retried"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+// The notPermittedResponse() method will return a 403 Forbidden when an authenticated
+// user lacks the permission needed for a resource.
+func (app *application) notPermittedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "your user account doesn't have the necessary permissions to access this resource"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+// The apiKeyNotAllowedResponse() method will return a 403 Forbidden when a personal API
+// key is used on a route that only accepts bearer tokens.
+func (app *application) apiKeyNotAllowedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "personal api keys cannot be used to access this resource, use a bearer token instead"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+// The apiKeyScopeRequiredResponse() method will return a 403 Forbidden when a personal
+// API key lacks the scope a route requires.
+func (app *application) apiKeyScopeRequiredResponse(w http.ResponseWriter, r *http.Request, scope string) {
+	message := fmt.Sprintf("this api key does not have the %q scope required to access this resource", scope)
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
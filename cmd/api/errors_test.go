@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"go.uber.org/zap"
 )
@@ -45,6 +46,70 @@ func TestErrorResponses(t *testing.T) {
 			expectedStatus: http.StatusUnauthorized,
 			expectedField:  "error",
 		},
+		{
+			name: "api key scope required",
+			errorFunc: func(w http.ResponseWriter, r *http.Request) {
+				app.apiKeyScopeRequiredResponse(w, r, "news:read")
+			},
+			expectedStatus: http.StatusForbidden,
+			expectedField:  "error",
+		},
+		{
+			name: "suspended account",
+			errorFunc: func(w http.ResponseWriter, r *http.Request) {
+				app.suspendedAccountResponse(w, r)
+			},
+			expectedStatus: http.StatusForbidden,
+			expectedField:  "error",
+		},
+		{
+			name: "oidc login failed",
+			errorFunc: func(w http.ResponseWriter, r *http.Request) {
+				app.oidcLoginFailedResponse(w, r)
+			},
+			expectedStatus: http.StatusUnauthorized,
+			expectedField:  "error",
+		},
+		{
+			name: "precondition required",
+			errorFunc: func(w http.ResponseWriter, r *http.Request) {
+				app.preconditionRequiredResponse(w, r)
+			},
+			expectedStatus: http.StatusPreconditionRequired,
+			expectedField:  "error",
+		},
+		{
+			name: "account locked",
+			errorFunc: func(w http.ResponseWriter, r *http.Request) {
+				app.accountLockedResponse(w, r, 15*time.Minute)
+			},
+			expectedStatus: http.StatusLocked,
+			expectedField:  "error",
+		},
+		{
+			name: "too many login attempts",
+			errorFunc: func(w http.ResponseWriter, r *http.Request) {
+				app.tooManyLoginAttemptsResponse(w, r, 15*time.Minute)
+			},
+			expectedStatus: http.StatusTooManyRequests,
+			expectedField:  "error",
+		},
+		{
+			name: "email not retryable",
+			errorFunc: func(w http.ResponseWriter, r *http.Request) {
+				app.emailNotRetryableResponse(w, r)
+			},
+			expectedStatus: http.StatusConflict,
+			expectedField:  "error",
+		},
+		{
+			name: "too many contact messages",
+			errorFunc: func(w http.ResponseWriter, r *http.Request) {
+				app.tooManyContactMessagesResponse(w, r, time.Hour)
+			},
+			expectedStatus: http.StatusTooManyRequests,
+			expectedField:  "error",
+		},
 		{
 			name: "server error",
 			errorFunc: func(w http.ResponseWriter, r *http.Request) {
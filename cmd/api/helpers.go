@@ -1,16 +1,24 @@
 package main
 
 import (
+	"cmp"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Blue-Davinci/musical-zoe/internal/data"
+	"github.com/Blue-Davinci/musical-zoe/internal/mailer"
 	"github.com/Blue-Davinci/musical-zoe/internal/validator"
+	"github.com/go-chi/chi"
+	"go.uber.org/zap"
 )
 
 var (
@@ -18,6 +26,15 @@ var (
 	ErrNoDataFoundInRedis    = errors.New("no data found in Redis")
 )
 
+// apiKeyHeader is the request header that carries a personal API key.
+const apiKeyHeader = "X-API-Key"
+
+// requestIDHeader carries the request ID, and requestIDRX matches the IDs we accept from
+// clients and proxies.
+const requestIDHeader = "X-Request-ID"
+
+var requestIDRX = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
 // Define an envelope type.
 type envelope map[string]any
 
@@ -142,47 +159,117 @@ func (app *application) background(fn func()) {
 
 // aunthenticatorHelper() is a helper function for the authentication middleware
 // It takes in a request and returns a user and an error
-func (app *application) aunthenticatorHelper(r *http.Request) (*data.User, error) {
+func (app *application) aunthenticatorHelper(r *http.Request) (*data.User, *data.PersonalApiKey, error) {
+	// Personal API keys are sent in their own header. When one is present it takes
+	// the place of the bearer token and we return the key so its scopes can be checked.
+	if keyPlaintext := r.Header.Get(apiKeyHeader); keyPlaintext != "" {
+		return app.personalApiKeyAuthenticatorHelper(keyPlaintext)
+	}
+	// Retrieve the bearer token from the Authorization header. If there is no header
+	// at all we treat the request as coming from the AnonymousUser.
+	token, err := app.readBearerToken(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	if token == "" {
+		return data.AnonymousUser, nil, nil
+	}
+	// Retrieve the details of the user associated with the authentication token,
+	// again calling the invalidAuthenticationTokenResponse() helper if no
+	// matching record was found. IMPORTANT: Notice that we are using
+	// ScopeAuthentication as the first parameter here.
+	user, err := app.models.Users.GetForToken(data.ScopeAuthentication, token)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrGeneralRecordNotFound):
+			return nil, nil, ErrInvalidAuthentication
+		default:
+			return nil, nil, ErrInvalidAuthentication
+		}
+	}
+	// Record the session as recently used. Failing to do so should never block the
+	// request, so we only log the error.
+	err = app.models.Tokens.Touch(token)
+	if err != nil {
+		app.logger.Error("failed to update session last used time", zap.Error(err))
+	}
+	return user, nil, nil
+}
+
+// personalApiKeyAuthenticatorHelper() authenticates a request made with a personal API
+// key from the X-API-Key header, returning the key's owner and the key itself.
+func (app *application) personalApiKeyAuthenticatorHelper(keyPlaintext string) (*data.User, *data.PersonalApiKey, error) {
+	v := validator.New()
+	if data.ValidatePersonalApiKeyPlaintext(v, keyPlaintext); !v.Valid() {
+		return nil, nil, ErrInvalidAuthentication
+	}
+	user, apiKey, err := app.models.ApiKeys.GetForPlaintext(keyPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrGeneralRecordNotFound):
+			return nil, nil, ErrInvalidAuthentication
+		default:
+			return nil, nil, err
+		}
+	}
+	err = app.models.ApiKeys.Touch(apiKey.ID)
+	if err != nil {
+		app.logger.Error("failed to update api key last used time", zap.Error(err))
+	}
+	return user, apiKey, nil
+}
+
+// readBearerToken() extracts and validates the token from a "Bearer <token>"
+// Authorization header. It returns an empty string and no error if the request has no
+// Authorization header at all.
+func (app *application) readBearerToken(r *http.Request) (string, error) {
 	// Retrieve the value of the Authorization header from the request. This will
+	// return the empty string "" if there is no such header found.
 	authorizationHeader := r.Header.Get("Authorization")
-	// If there is no Authorization header found, use the contextSetUser() helper to
-	// add the AnonUser to the request context. Then we
 	if authorizationHeader == "" {
-		return data.AnonymousUser, nil
+		return "", nil
 	}
 	// Otherwise, we expect the value of the Authorization header to be in the format
 	// "Bearer <token>". We try to split this into its constituent parts, and if the
-	// header isn't in the expected format we return a 401 Unauthorized response
-	// using the invalidAuthenticationTokenResponse() helper
+	// header isn't in the expected format we return an ErrInvalidAuthentication
 	headerParts := strings.Split(authorizationHeader, " ")
 	if len(headerParts) != 2 || headerParts[0] != "Bearer" {
-		return nil, ErrInvalidAuthentication
+		return "", ErrInvalidAuthentication
 	}
 	// Extract the actual authentication token from the header parts.
 	token := headerParts[1]
-	//app.logger.Info("User id Connected", zap.String("Connected ID", token))
 	// Validate the token to make sure it is in a sensible format.
 	v := validator.New()
-	// If the token isn't valid, use the invalidAuthenticationTokenResponse()
-	// helper to send a response, rather than the failedValidationResponse() helper
-	// that we'd normally use.
 	if data.ValidateTokenPlaintext(v, token); !v.Valid() {
-		return nil, ErrInvalidAuthentication
+		return "", ErrInvalidAuthentication
 	}
-	// Retrieve the details of the user associated with the authentication token,
-	// again calling the invalidAuthenticationTokenResponse() helper if no
-	// matching record was found. IMPORTANT: Notice that we are using
-	// ScopeAuthentication as the first parameter here.
-	user, err := app.models.Users.GetForToken(data.ScopeAuthentication, token)
-	if err != nil {
-		switch {
-		case errors.Is(err, data.ErrGeneralRecordNotFound):
-			return nil, ErrInvalidAuthentication
-		default:
-			return nil, ErrInvalidAuthentication
-		}
+	return token, nil
+}
+
+// readIDParam() reads the "id" URL parameter from the current request and converts it
+// to an int64. It returns an error if the parameter is missing or not a positive integer.
+func (app *application) readIDParam(r *http.Request) (int64, error) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil || id < 1 {
+		return 0, errors.New("invalid id parameter")
+	}
+	return id, nil
+}
+
+// readIfMatchVersion() reads the record version a client expects from the If-Match
+// header. Both plain (3) and entity-tag ("3" or W/"3") forms are accepted. The boolean
+// is false when the header was not sent at all.
+func (app *application) readIfMatchVersion(r *http.Request) (int32, bool, error) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" {
+		return 0, false, nil
+	}
+	header = strings.Trim(strings.TrimPrefix(header, "W/"), `"`)
+	version, err := strconv.ParseInt(header, 10, 32)
+	if err != nil || version < 1 {
+		return 0, true, errors.New("If-Match header must contain a valid version number")
 	}
-	return user, nil
+	return int32(version), true, nil
 }
 
 // The readString() helper returns a string value from the query string, or the provided
@@ -199,6 +286,100 @@ func (app *application) readString(qs url.Values, key string, defaultValue strin
 	return s
 }
 
+// The readInt() helper reads a string value from the query string and converts it to an
+// integer before returning. If no matching key could be found it returns the provided
+// default value. If the value couldn't be converted to an integer, then we record an
+// error message in the provided Validator instance.
+func (app *application) readInt(qs url.Values, key string, defaultValue int, v *validator.Validator) int {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		v.AddError(key, "must be an integer value")
+		return defaultValue
+	}
+	return i
+}
+
+// The readBool() helper reads an optional true/false value from the query string. It
+// returns nil when the key is missing, and records an error in the Validator when the
+// value isn't a boolean.
+func (app *application) readBool(qs url.Values, key string, v *validator.Validator) *bool {
+	s := qs.Get(key)
+	if s == "" {
+		return nil
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		v.AddError(key, "must be true or false")
+		return nil
+	}
+	return &b
+}
+
+// The readTime() helper reads an optional timestamp from the query string, accepting
+// either RFC 3339 or a plain YYYY-MM-DD date. It returns nil when the key is missing, and
+// records an error in the Validator when the value can't be parsed.
+func (app *application) readTime(qs url.Values, key string, v *validator.Validator) *time.Time {
+	s := qs.Get(key)
+	if s == "" {
+		return nil
+	}
+	for _, layout := range []string{time.RFC3339, time.DateOnly} {
+		t, err := time.Parse(layout, s)
+		if err == nil {
+			return &t
+		}
+	}
+	v.AddError(key, "must be a date (YYYY-MM-DD) or an RFC 3339 timestamp")
+	return nil
+}
+
+// readAcceptLanguage() returns the supported locale the client prefers according to its
+// Accept-Language header, such as "fr" for "fr-CH, fr;q=0.9, en;q=0.8". Languages are
+// tried in order of their quality value, and the default locale is returned when none of
+// them are supported.
+func (app *application) readAcceptLanguage(r *http.Request) string {
+	type language struct {
+		tag     string
+		quality float64
+	}
+	languages := []language{}
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		quality := 1.0
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(q, 64)
+			if err != nil {
+				continue
+			}
+			quality = parsed
+		}
+		if tag != "" && quality > 0 {
+			languages = append(languages, language{tag: tag, quality: quality})
+		}
+	}
+	slices.SortStableFunc(languages, func(a, b language) int {
+		return cmp.Compare(b.quality, a.quality)
+	})
+	for _, language := range languages {
+		if locale, ok := mailer.NormalizeLocale(language.tag); ok {
+			return locale
+		}
+	}
+	return mailer.DefaultLocale
+}
+
+// validateLocale() checks that locale names a supported locale, recording an error in the
+// Validator if it doesn't, and returns it in normalized form, so "fr-CA" becomes "fr".
+func (app *application) validateLocale(v *validator.Validator, locale string) string {
+	normalized, ok := mailer.NormalizeLocale(locale)
+	v.Check(ok, "locale", "must be one of "+strings.Join(mailer.Locales, ", "))
+	return normalized
+}
+
 // buildAPIURL constructs a full API URL with query parameters
 func buildAPIURL(baseURL, endpoint string, params map[string]string) (string, error) {
 	// Parse the base URL
@@ -221,3 +402,17 @@ func buildAPIURL(baseURL, endpoint string, params map[string]string) (string, er
 
 	return u.String(), nil
 }
+
+// validatePasswordPolicy() checks a new password against the configured password policy,
+// adding any problem to v. It is skipped when the password has already failed the basic
+// length checks. A failed breach lookup is logged and the password accepted on the
+// remaining rules.
+func (app *application) validatePasswordPolicy(r *http.Request, v *validator.Validator, password string, personal ...string) {
+	if _, exists := v.Errors["password"]; exists {
+		return
+	}
+	err := app.passwords.Validate(r.Context(), v, password, personal...)
+	if err != nil {
+		app.logger.Warn("password breach lookup failed", zap.Error(err))
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"testing"
+
+	"github.com/Blue-Davinci/musical-zoe/internal/validator"
 )
 
 func TestReadString(t *testing.T) {
@@ -60,6 +62,54 @@ func TestReadString(t *testing.T) {
 	}
 }
 
+func TestReadInt(t *testing.T) {
+	tests := []struct {
+		name         string
+		queryParams  string
+		defaultValue int
+		expected     int
+		valid        bool
+	}{
+		{
+			name:         "parameter exists",
+			queryParams:  "page=3",
+			defaultValue: 1,
+			expected:     3,
+			valid:        true,
+		},
+		{
+			name:         "parameter doesn't exist",
+			queryParams:  "",
+			defaultValue: 1,
+			expected:     1,
+			valid:        true,
+		},
+		{
+			name:         "not an integer",
+			queryParams:  "page=three",
+			defaultValue: 1,
+			expected:     1,
+			valid:        false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/?"+tt.queryParams, nil)
+			app := &application{}
+			v := validator.New()
+
+			result := app.readInt(req.URL.Query(), "page", tt.defaultValue, v)
+			if result != tt.expected {
+				t.Errorf("readInt() = %v, want %v", result, tt.expected)
+			}
+			if v.Valid() != tt.valid {
+				t.Errorf("expected valid=%t, got errors %v", tt.valid, v.Errors)
+			}
+		})
+	}
+}
+
 func TestBuildAPIURL(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -150,3 +200,79 @@ func TestBuildAPIURL(t *testing.T) {
 		})
 	}
 }
+
+func TestReadIfMatchVersion(t *testing.T) {
+	tests := []struct {
+		name         string
+		header       string
+		expected     int32
+		expectedSent bool
+		hasError     bool
+	}{
+		{name: "no header", header: "", expected: 0, expectedSent: false, hasError: false},
+		{name: "plain version", header: "3", expected: 3, expectedSent: true, hasError: false},
+		{name: "quoted etag", header: `"7"`, expected: 7, expectedSent: true, hasError: false},
+		{name: "weak etag", header: `W/"12"`, expected: 12, expectedSent: true, hasError: false},
+		{name: "not a number", header: "abc", expected: 0, expectedSent: true, hasError: true},
+		{name: "zero version", header: "0", expected: 0, expectedSent: true, hasError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("PATCH", "/v1/api/me", nil)
+			if tt.header != "" {
+				req.Header.Set("If-Match", tt.header)
+			}
+
+			app := &application{}
+
+			version, sent, err := app.readIfMatchVersion(req)
+			if tt.hasError && err == nil {
+				t.Errorf("expected error but got none")
+			}
+			if !tt.hasError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if sent != tt.expectedSent {
+				t.Errorf("readIfMatchVersion() sent = %v, want %v", sent, tt.expectedSent)
+			}
+			if !tt.hasError && version != tt.expected {
+				t.Errorf("readIfMatchVersion() = %v, want %v", version, tt.expected)
+			}
+		})
+	}
+}
+
+func TestReadAcceptLanguage(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		expected string
+	}{
+		{name: "no header", header: "", expected: "en"},
+		{name: "single language", header: "fr", expected: "fr"},
+		{name: "region subtag", header: "de-AT", expected: "de"},
+		{name: "first supported", header: "pt-BR, es;q=0.8, en;q=0.5", expected: "es"},
+		{name: "highest quality wins", header: "en;q=0.3, fr-CH, fr;q=0.9", expected: "fr"},
+		{name: "quality ordering", header: "en;q=0.5, de;q=0.7", expected: "de"},
+		{name: "refused language", header: "fr;q=0, es;q=0.1", expected: "es"},
+		{name: "wildcard only", header: "*", expected: "en"},
+		{name: "unsupported only", header: "ja, zh-CN;q=0.9", expected: "en"},
+		{name: "malformed quality", header: "fr;q=abc, de;q=0.2", expected: "de"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/v1/api/users", nil)
+			if tt.header != "" {
+				req.Header.Set("Accept-Language", tt.header)
+			}
+
+			app := &application{}
+
+			if locale := app.readAcceptLanguage(req); locale != tt.expected {
+				t.Errorf("readAcceptLanguage() = %q, want %q", locale, tt.expected)
+			}
+		})
+	}
+}
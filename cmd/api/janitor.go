@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"time"
+
+	"github.com/Blue-Davinci/musical-zoe/internal/data"
+	"github.com/Blue-Davinci/musical-zoe/internal/mailer"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultActivationReminderBatchSize caps how many reminder emails one janitor run
+	// sends, so that a backlog is worked through gradually.
+	DefaultActivationReminderBatchSize = 100
+)
+
+// janitorMetrics exposes running totals of the janitor's work under "janitor" on the
+// /debug/vars endpoint.
+var janitorMetrics = expvar.NewMap("janitor")
+
+// janitorResult holds the counts from a single janitor run.
+type janitorResult struct {
+	tokensDeleted           int64
+	remindersSent           int64
+	usersPurged             int64
+	loginAttemptsDeleted    int64
+	oidcAuthRequestsDeleted int64
+	sentEmailsDeleted       int64
+	deadEmailsDeleted       int64
+}
+
+// startJanitor() runs the janitor every janitor interval until ctx is cancelled. It is
+// tracked by app.wg so that shutdown waits for a run in progress to finish.
+func (app *application) startJanitor(ctx context.Context) {
+	if app.config.janitor.interval <= 0 {
+		app.logger.Info("janitor disabled")
+		return
+	}
+	app.wg.Add(1)
+	go func() {
+		defer app.wg.Done()
+		ticker := time.NewTicker(app.config.janitor.interval)
+		defer ticker.Stop()
+		app.logger.Info("janitor started", zap.Duration("interval", app.config.janitor.interval))
+		for {
+			select {
+			case <-ctx.Done():
+				app.logger.Info("janitor stopped")
+				return
+			case <-ticker.C:
+				app.runJanitor()
+			}
+		}
+	}()
+}
+
+// runJanitor() performs one cleanup pass. Each step runs even if an earlier one failed,
+// and the counts are logged and added to the expvar totals.
+func (app *application) runJanitor() {
+	defer func() {
+		if err := recover(); err != nil {
+			app.logger.Error("janitor panicked", zap.Any("error", err))
+		}
+	}()
+	var result janitorResult
+	var err error
+	now := time.Now()
+	result.tokensDeleted, err = app.models.Tokens.DeleteExpired()
+	if err != nil {
+		app.logger.Error("janitor failed to delete expired tokens", zap.Error(err))
+	}
+	if app.config.janitor.unactivatedUserMaxAge > 0 {
+		if app.config.janitor.activationReminderAge > 0 {
+			result.remindersSent = app.sendActivationReminders(now)
+		}
+		result.usersPurged, err = app.models.Users.DeleteUnactivated(now.Add(-app.config.janitor.unactivatedUserMaxAge))
+		if err != nil {
+			app.logger.Error("janitor failed to purge unactivated users", zap.Error(err))
+		}
+	}
+	result.loginAttemptsDeleted, err = app.models.LoginAttempts.Purge(now.Add(-app.config.lockout.window))
+	if err != nil {
+		app.logger.Error("janitor failed to purge login attempts", zap.Error(err))
+	}
+	result.oidcAuthRequestsDeleted, err = app.models.Identities.DeleteExpiredAuthRequests()
+	if err != nil {
+		app.logger.Error("janitor failed to delete expired oidc auth requests", zap.Error(err))
+	}
+	result.sentEmailsDeleted, err = app.models.EmailOutbox.DeleteSentBefore(now.Add(-app.config.outbox.retention))
+	if err != nil {
+		app.logger.Error("janitor failed to delete sent emails", zap.Error(err))
+	}
+	result.deadEmailsDeleted, err = app.models.EmailOutbox.DeleteDeadBefore(now.Add(-app.config.outbox.retention))
+	if err != nil {
+		app.logger.Error("janitor failed to delete dead emails", zap.Error(err))
+	}
+
+	janitorMetrics.Add("runs", 1)
+	janitorMetrics.Add("tokens_deleted", result.tokensDeleted)
+	janitorMetrics.Add("activation_reminders_sent", result.remindersSent)
+	janitorMetrics.Add("users_purged", result.usersPurged)
+	janitorMetrics.Add("login_attempts_deleted", result.loginAttemptsDeleted)
+	janitorMetrics.Add("oidc_auth_requests_deleted", result.oidcAuthRequestsDeleted)
+	janitorMetrics.Add("sent_emails_deleted", result.sentEmailsDeleted)
+	janitorMetrics.Add("dead_emails_deleted", result.deadEmailsDeleted)
+	lastRun := new(expvar.String)
+	lastRun.Set(now.UTC().Format(time.RFC3339))
+	janitorMetrics.Set("last_run", lastRun)
+
+	app.logger.Info("janitor run complete",
+		zap.Int64("tokens_deleted", result.tokensDeleted),
+		zap.Int64("activation_reminders_sent", result.remindersSent),
+		zap.Int64("users_purged", result.usersPurged),
+		zap.Int64("login_attempts_deleted", result.loginAttemptsDeleted),
+		zap.Int64("oidc_auth_requests_deleted", result.oidcAuthRequestsDeleted),
+		zap.Int64("sent_emails_deleted", result.sentEmailsDeleted),
+		zap.Int64("dead_emails_deleted", result.deadEmailsDeleted),
+		zap.Duration("took", time.Since(now)),
+	)
+}
+
+// sendActivationReminders() emails a fresh activation link to unactivated accounts that
+// have reached the reminder age, telling them when the account will be removed. Each
+// account is reminded once. It returns how many reminders were sent.
+func (app *application) sendActivationReminders(now time.Time) int64 {
+	users, err := app.models.Users.GetForActivationReminder(now.Add(-app.config.janitor.activationReminderAge), DefaultActivationReminderBatchSize)
+	if err != nil {
+		app.logger.Error("janitor failed to fetch users for activation reminders", zap.Error(err))
+		return 0
+	}
+	var sent int64
+	for _, user := range users {
+		// the original activation token has most likely expired, so replace it
+		err = app.models.Tokens.DeleteAllForUser(data.ScopeActivation, user.ID)
+		if err != nil {
+			app.logger.Error("janitor failed to delete activation tokens", zap.Int64("user_id", user.ID), zap.Error(err))
+			continue
+		}
+		token, err := app.models.Tokens.New(user.ID, data.DefaultActivationTokenExpiryTime, data.ScopeActivation)
+		if err != nil {
+			app.logger.Error("janitor failed to create activation token", zap.Int64("user_id", user.ID), zap.Error(err))
+			continue
+		}
+		data := map[string]any{
+			"activationURL":   app.config.url.activationURL + token.Plaintext,
+			"activationToken": token.Plaintext,
+			"userName":        user.Name,
+			"deletionDate":    mailer.Date(user.CreatedAt.Add(app.config.janitor.unactivatedUserMaxAge).UTC()),
+		}
+		err = app.sendEmail(user.Email, "user_activation_reminder.tmpl", user.Locale, data)
+		if err != nil {
+			app.logger.Error("failed to send activation reminder email", zap.String("email", user.Email), zap.Error(err))
+			continue
+		}
+		err = app.models.Users.MarkActivationReminderSent(user.ID)
+		if err != nil {
+			app.logger.Error("janitor failed to record activation reminder", zap.Int64("user_id", user.ID), zap.Error(err))
+			continue
+		}
+		sent++
+	}
+	return sent
+}
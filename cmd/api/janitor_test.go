@@ -0,0 +1,139 @@
+package main
+
+import (
+	"database/sql/driver"
+	"expvar"
+	"testing"
+	"time"
+
+	"github.com/Blue-Davinci/musical-zoe/internal/data"
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// cutoff matches a time argument within a second of the expected cutoff.
+type cutoff struct {
+	expected time.Time
+}
+
+func (c cutoff) Match(v driver.Value) bool {
+	t, ok := v.(time.Time)
+	if !ok {
+		return false
+	}
+	diff := t.Sub(c.expected)
+	return diff > -time.Second && diff < time.Second
+}
+
+// janitorMetric() returns the current value of a janitor counter, which is zero until
+// the first run publishes it.
+func janitorMetric(name string) int64 {
+	if v := janitorMetrics.Get(name); v != nil {
+		return v.(*expvar.Int).Value()
+	}
+	return 0
+}
+
+// expectJanitorCleanup() expects the purges the janitor makes after handling
+// unactivated users, with nothing to delete.
+func expectJanitorCleanup(mock sqlmock.Sqlmock) {
+	mock.ExpectExec(query("DeleteLoginFailuresBefore")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(query("DeleteExpiredLoginLockouts")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(query("DeleteExpiredOIDCAuthRequests")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(query("DeleteSentEmailOutboxMessagesBefore")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(query("DeleteDeadEmailOutboxMessagesBefore")).WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+func TestRunJanitorPurgesOldEmails(t *testing.T) {
+	app, mock := newTestApplication(t)
+	app.config.outbox.retention = 7 * 24 * time.Hour
+	retentionCutoff := cutoff{expected: time.Now().Add(-app.config.outbox.retention)}
+
+	mock.ExpectExec(query("DeleteExpiredApiKeys")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(query("DeleteLoginFailuresBefore")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(query("DeleteExpiredLoginLockouts")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(query("DeleteExpiredOIDCAuthRequests")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(query("DeleteSentEmailOutboxMessagesBefore")).WithArgs(retentionCutoff).WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec(query("DeleteDeadEmailOutboxMessagesBefore")).WithArgs(retentionCutoff).WillReturnResult(sqlmock.NewResult(0, 2))
+
+	previous := janitorMetric("dead_emails_deleted")
+	app.runJanitor()
+
+	if deleted := janitorMetric("dead_emails_deleted") - previous; deleted != 2 {
+		t.Errorf("expected 2 dead emails to be counted, got %d", deleted)
+	}
+}
+
+func TestRunJanitorHandlesUnactivatedUsers(t *testing.T) {
+	app, mock := newTestApplication(t)
+	app.config.janitor.unactivatedUserMaxAge = 30 * 24 * time.Hour
+	app.config.janitor.activationReminderAge = 23 * 24 * time.Hour
+	now := time.Now()
+	reminderCutoff := cutoff{expected: now.Add(-app.config.janitor.activationReminderAge)}
+	purgeCutoff := cutoff{expected: now.Add(-app.config.janitor.unactivatedUserMaxAge)}
+
+	mock.ExpectExec(query("DeleteExpiredApiKeys")).WillReturnResult(sqlmock.NewResult(0, 4))
+	mock.ExpectQuery(query("GetUsersForActivationReminder")).WithArgs(reminderCutoff, DefaultActivationReminderBatchSize).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "email", "locale", "created_at"}).
+			AddRow(8, "Max", "max@example.com", "en", now.Add(-24*24*time.Hour)))
+	mock.ExpectExec(query("DeletAllAPIKeysForUser")).WithArgs(data.ScopeActivation, int64(8)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(query("InsertApiKey")).WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(1, time.Now()))
+	expectEmailQueued(mock)
+	mock.ExpectExec(query("InsertActivationReminder")).WithArgs(int64(8)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(query("DeleteUnactivatedUsers")).WithArgs(purgeCutoff).WillReturnResult(sqlmock.NewResult(0, 2))
+	expectJanitorCleanup(mock)
+
+	tokens := janitorMetric("tokens_deleted")
+	reminders := janitorMetric("activation_reminders_sent")
+	purged := janitorMetric("users_purged")
+	app.runJanitor()
+
+	if deleted := janitorMetric("tokens_deleted") - tokens; deleted != 4 {
+		t.Errorf("expected 4 expired tokens to be counted, got %d", deleted)
+	}
+	if sent := janitorMetric("activation_reminders_sent") - reminders; sent != 1 {
+		t.Errorf("expected 1 activation reminder to be counted, got %d", sent)
+	}
+	if deleted := janitorMetric("users_purged") - purged; deleted != 2 {
+		t.Errorf("expected 2 purged users to be counted, got %d", deleted)
+	}
+}
+
+func TestRunJanitorLeavesUnactivatedUsersWhenDisabled(t *testing.T) {
+	app, mock := newTestApplication(t)
+
+	mock.ExpectExec(query("DeleteExpiredApiKeys")).WillReturnResult(sqlmock.NewResult(0, 0))
+	expectJanitorCleanup(mock)
+
+	app.runJanitor()
+}
+
+func TestRunJanitorPurgesWithoutRemindersWhenTheyAreDisabled(t *testing.T) {
+	app, mock := newTestApplication(t)
+	app.config.janitor.unactivatedUserMaxAge = 30 * 24 * time.Hour
+
+	mock.ExpectExec(query("DeleteExpiredApiKeys")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(query("DeleteUnactivatedUsers")).WillReturnResult(sqlmock.NewResult(0, 1))
+	expectJanitorCleanup(mock)
+
+	app.runJanitor()
+}
+
+func TestRunJanitorSkipsSuspendedUsers(t *testing.T) {
+	app, mock := newTestApplication(t)
+	app.config.janitor.unactivatedUserMaxAge = 30 * 24 * time.Hour
+	app.config.janitor.activationReminderAge = 23 * 24 * time.Hour
+	// suspended users are kept for the operator and are never reminded
+	skipsSuspended := `(?s).*suspended = false`
+
+	mock.ExpectExec(query("DeleteExpiredApiKeys")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(query("GetUsersForActivationReminder") + skipsSuspended).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "email", "locale", "created_at"}))
+	mock.ExpectExec(query("DeleteUnactivatedUsers") + skipsSuspended).WillReturnResult(sqlmock.NewResult(0, 0))
+	expectJanitorCleanup(mock)
+
+	app.runJanitor()
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
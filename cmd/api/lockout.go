@@ -0,0 +1,118 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Blue-Davinci/musical-zoe/internal/data"
+	"go.uber.org/zap"
+)
+
+// loginThrottledResponse() checks whether a login attempt may go ahead at all. Logins
+// are refused while the email address is locked out, or while the client's IP address
+// has too many recent failures across all accounts. It returns true if it has already
+// written a response, in which case the caller must stop.
+func (app *application) loginThrottledResponse(w http.ResponseWriter, r *http.Request, email, ipAddress string) bool {
+	lockedUntil, locked, err := app.models.LoginAttempts.LockedUntil(email)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return true
+	}
+	if locked {
+		app.accountLockedResponse(w, r, time.Until(lockedUntil))
+		return true
+	}
+	failures, err := app.models.LoginAttempts.CountFailuresForIP(ipAddress, time.Now().Add(-app.config.lockout.window))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return true
+	}
+	if failures >= int64(app.config.lockout.ipThreshold) {
+		app.tooManyLoginAttemptsResponse(w, r, app.config.lockout.window)
+		return true
+	}
+	return false
+}
+
+// failedLoginResponse() records a failed login and responds to it. user is nil when no
+// account exists for the email, which is still recorded so that probing unknown
+// addresses is throttled in exactly the same way.
+func (app *application) failedLoginResponse(w http.ResponseWriter, r *http.Request, email, ipAddress string, user *data.User) {
+	locked, err := app.recordLoginFailure(r, email, ipAddress, user, "invalid credentials")
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if locked {
+		app.accountLockedResponse(w, r, app.config.lockout.duration)
+		return
+	}
+	app.invalidCredentialsResponse(w, r)
+}
+
+// failedReconfirmationResponse() records a wrong password or code that an authenticated
+// user entered to confirm a sensitive change, and responds to it. These count towards
+// the lockout like failed logins so that a stolen session can't be used to guess them;
+// callers check loginThrottledResponse() first.
+func (app *application) failedReconfirmationResponse(w http.ResponseWriter, r *http.Request, user *data.User, ipAddress, reason string, invalidResponse func(http.ResponseWriter, *http.Request)) {
+	locked, err := app.recordLoginFailure(r, user.Email, ipAddress, user, reason)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if locked {
+		app.accountLockedResponse(w, r, app.config.lockout.duration)
+		return
+	}
+	invalidResponse(w, r)
+}
+
+// recordLoginFailure() records a failed login, whether a wrong password or a wrong
+// second factor, in the audit log and towards the email's lockout. Once an email address
+// reaches the failure threshold within the lockout window it is locked, and the owner of
+// the account, if there is one, is told by email. It reports whether the email is now
+// locked.
+func (app *application) recordLoginFailure(r *http.Request, email, ipAddress string, user *data.User, reason string) (bool, error) {
+	var userID int64
+	if user != nil {
+		userID = user.ID
+	}
+	app.recordAuditEvent(r, data.AuditEventLoginFailure, userID, email, map[string]any{"reason": reason})
+	failures, err := app.models.LoginAttempts.RecordFailure(email, ipAddress, time.Now().Add(-app.config.lockout.window))
+	if err != nil {
+		return false, err
+	}
+	if failures < int64(app.config.lockout.threshold) {
+		return false, nil
+	}
+	lockedUntil := time.Now().Add(app.config.lockout.duration)
+	err = app.models.LoginAttempts.Lock(email, lockedUntil)
+	if err != nil {
+		return false, err
+	}
+	app.logger.Warn("login locked after repeated failures",
+		zap.String("email", email),
+		zap.String("ip_address", ipAddress),
+		zap.Int64("failures", failures))
+	if user != nil {
+		emailData := map[string]any{
+			"userName":    user.Name,
+			"attempts":    failures,
+			"ipAddress":   ipAddress,
+			"lockedUntil": lockedUntil,
+		}
+		err := app.sendEmail(user.Email, "user_account_locked.tmpl", user.Locale, emailData)
+		if err != nil {
+			app.logger.Error("Error sending account locked email", zap.String("email", user.Email), zap.Error(err))
+		}
+	}
+	return true, nil
+}
+
+// retryAfterSeconds() formats a wait as the whole number of seconds expected by the
+// Retry-After header, rounding up so clients never retry too early.
+func retryAfterSeconds(wait time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(wait.Seconds())))
+}
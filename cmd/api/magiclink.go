@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Blue-Davinci/musical-zoe/internal/data"
+	"github.com/Blue-Davinci/musical-zoe/internal/validator"
+	"go.uber.org/zap"
+)
+
+// createMagicLinkTokenHandler() emails a single-use sign-in link to an activated
+// account. Like the password reset endpoint it always responds with the same 202
+// Accepted message so that it can't be used to discover registered addresses.
+func (app *application) createMagicLinkTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if data.ValidateEmail(v, input.Email); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	// the generic message we send back regardless of the outcome
+	message := envelope{"message": "if an activated account with that email exists, you will receive a sign-in link shortly"}
+	user, err := app.models.Users.GetByEmail(input.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrGeneralRecordNotFound):
+			err = app.writeJSON(w, http.StatusAccepted, message, nil)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+			}
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if user.Activated && !user.Suspended {
+		// throttle links for the same account
+		recentlySent, err := app.models.Tokens.IssuedSince(data.ScopeMagicLink, user.ID, time.Now().Add(-data.DefaultMagicLinkResendInterval))
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if !recentlySent {
+			// only the newest link should work
+			err = app.models.Tokens.DeleteAllForUser(data.ScopeMagicLink, user.ID)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+			token, err := app.models.Tokens.New(user.ID, data.DefaultMagicLinkTokenExpiryTime, data.ScopeMagicLink)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+			emailData := map[string]any{
+				"magicLinkURL":   app.config.url.magicLinkURL + token.Plaintext,
+				"magicLinkToken": token.Plaintext,
+				"userName":       user.Name,
+			}
+			err = app.sendEmail(user.Email, "user_magic_link.tmpl", user.Locale, emailData)
+			if err != nil {
+				app.logger.Error("failed to send magic link email", zap.String("email", user.Email), zap.Error(err))
+			}
+		}
+	}
+	err = app.writeJSON(w, http.StatusAccepted, message, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// redeemMagicLinkTokenHandler() exchanges a magic-link token for a bearer token. The
+// link stands in for the password only, so accounts with MFA enabled still have to
+// complete the second step.
+func (app *application) redeemMagicLinkTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		TokenPlaintext string `json:"token"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if data.ValidateTokenPlaintext(v, input.TokenPlaintext); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	user, err := app.models.Users.GetForToken(data.ScopeMagicLink, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrGeneralRecordNotFound):
+			v.AddError("token", "invalid or expired magic link token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	// the link is single use
+	err = app.models.Tokens.DeleteAllForUser(data.ScopeMagicLink, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	// the account may have been deactivated since the link was sent
+	if user.Suspended {
+		app.suspendedAccountResponse(w, r)
+		return
+	}
+	if !user.Activated {
+		app.inactiveAccountResponse(w, r)
+		return
+	}
+	if user.MFAEnabled {
+		app.createMFAChallengeResponse(w, r, user)
+		return
+	}
+	app.createAuthenticationApiKeyResponse(w, r, user, "")
+}
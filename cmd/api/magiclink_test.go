@@ -0,0 +1,173 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Blue-Davinci/musical-zoe/internal/data"
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestCreateMagicLinkTokenHandler(t *testing.T) {
+	activated := testUser{ID: 7, Name: "Zoe", Email: "zoe@example.com", Password: "pa55word1234", Activated: true, Version: 1}
+	unactivated := testUser{ID: 8, Name: "Max", Email: "max@example.com", Password: "pa55word1234", Version: 1}
+	// suspended with the activated flag set, as it would be if anything reactivated it
+	suspended := testUser{ID: 9, Name: "Mallory", Email: "mallory@example.com", Password: "pa55word1234", Activated: true, Suspended: true, Version: 2}
+
+	tests := []struct {
+		name   string
+		email  string
+		expect func(mock sqlmock.Sqlmock)
+	}{
+		{
+			name:  "replaces any earlier link and emails a new one",
+			email: activated.Email,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(query("GetUserByEmail")).WillReturnRows(activated.rows(t))
+				mock.ExpectQuery(query("CountApiKeysCreatedSince")).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+				mock.ExpectExec(query("DeletAllAPIKeysForUser")).WithArgs(data.ScopeMagicLink, int64(7)).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery(query("InsertApiKey")).WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(1, time.Now()))
+				expectEmailQueued(mock)
+			},
+		},
+		{
+			name:  "throttled within the resend interval",
+			email: activated.Email,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(query("GetUserByEmail")).WillReturnRows(activated.rows(t))
+				mock.ExpectQuery(query("CountApiKeysCreatedSince")).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+			},
+		},
+		{
+			name:  "unactivated account is not sent a link",
+			email: unactivated.Email,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(query("GetUserByEmail")).WillReturnRows(unactivated.rows(t))
+			},
+		},
+		{
+			name:  "suspended account is not sent a link",
+			email: suspended.Email,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(query("GetUserByEmail")).WillReturnRows(suspended.rows(t))
+			},
+		},
+		{
+			name:  "unknown email",
+			email: "nobody@example.com",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(query("GetUserByEmail")).WillReturnRows(sqlmock.NewRows(userColumns))
+			},
+		},
+	}
+
+	var expectedBody string
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, mock := newTestApplication(t)
+			tt.expect(mock)
+			r := newJSONRequest(t, http.MethodPost, "/v1/api/authentication/magic-link", map[string]string{"email": tt.email})
+			rr := httptest.NewRecorder()
+			app.createMagicLinkTokenHandler(rr, r)
+
+			if rr.Code != http.StatusAccepted {
+				t.Errorf("expected status %d, got %d: %s", http.StatusAccepted, rr.Code, rr.Body.String())
+			}
+			// every outcome must look the same to the caller
+			if expectedBody == "" {
+				expectedBody = rr.Body.String()
+			}
+			if rr.Body.String() != expectedBody {
+				t.Errorf("expected the same response for every email, got %s", rr.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestRedeemMagicLinkTokenHandler(t *testing.T) {
+	user := testUser{ID: 7, Name: "Zoe", Email: "zoe@example.com", Password: "pa55word1234", Activated: true, Version: 1}
+	mfaUser := testUser{ID: 7, Name: "Zoe", Email: "zoe@example.com", Password: "pa55word1234", Activated: true, MFASecret: "JBSWY3DPEHPK3PXP", Version: 1}
+	deactivated := testUser{ID: 7, Name: "Zoe", Email: "zoe@example.com", Password: "pa55word1234", Version: 1}
+	suspended := testUser{ID: 7, Name: "Zoe", Email: "zoe@example.com", Password: "pa55word1234", Activated: true, Suspended: true, Version: 2}
+	token := "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+	expectRedeemed := func(mock sqlmock.Sqlmock, u testUser) {
+		mock.ExpectQuery(query("GetForToken")).WithArgs(sqlmock.AnyArg(), data.ScopeMagicLink, sqlmock.AnyArg()).WillReturnRows(u.rows(t))
+		mock.ExpectExec(query("DeletAllAPIKeysForUser")).WithArgs(data.ScopeMagicLink, u.ID).WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+
+	tests := []struct {
+		name           string
+		token          string
+		expect         func(mock sqlmock.Sqlmock)
+		expectedStatus int
+	}{
+		{
+			name:  "link is used up and a session is created",
+			token: token,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectRedeemed(mock, user)
+				expectNewSession(mock)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:  "mfa accounts still get the second step",
+			token: token,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectRedeemed(mock, mfaUser)
+				mock.ExpectQuery(query("InsertApiKey")).WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(1, time.Now()))
+			},
+			expectedStatus: http.StatusAccepted,
+		},
+		{
+			name:  "account deactivated since the link was sent",
+			token: token,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectRedeemed(mock, deactivated)
+			},
+			expectedStatus: http.StatusLocked,
+		},
+		{
+			name:  "suspended account gets no session",
+			token: token,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectRedeemed(mock, suspended)
+			},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:  "expired or used link",
+			token: token,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(query("GetForToken")).WillReturnRows(sqlmock.NewRows(userColumns))
+			},
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "malformed token",
+			token:          "short",
+			expect:         func(mock sqlmock.Sqlmock) {},
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, mock := newTestApplication(t)
+			tt.expect(mock)
+			r := newJSONRequest(t, http.MethodPut, "/v1/api/authentication/magic-link", map[string]string{"token": tt.token})
+			rr := httptest.NewRecorder()
+			app.redeemMagicLinkTokenHandler(rr, r)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
@@ -15,6 +15,8 @@ import (
 	"github.com/Blue-Davinci/musical-zoe/internal/database"
 	"github.com/Blue-Davinci/musical-zoe/internal/logger"
 	"github.com/Blue-Davinci/musical-zoe/internal/mailer"
+	"github.com/Blue-Davinci/musical-zoe/internal/passwords"
+	"github.com/Blue-Davinci/musical-zoe/internal/sso"
 	"github.com/Blue-Davinci/musical-zoe/internal/vcs"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
@@ -53,21 +55,73 @@ type config struct {
 		password string
 		sender   string
 	}
+	mailer struct {
+		transport string
+		outboxDir string
+	}
+	outbox struct {
+		workers      int
+		pollInterval time.Duration
+		maxAttempts  int
+		retention    time.Duration
+	}
 	cors struct {
 		trustedOrigins []string
 	}
+	activation struct {
+		resendInterval time.Duration
+	}
+	tokens struct {
+		accessTTL  time.Duration
+		refreshTTL time.Duration
+	}
+	janitor struct {
+		interval              time.Duration
+		unactivatedUserMaxAge time.Duration
+		activationReminderAge time.Duration
+	}
+	digest struct {
+		interval time.Duration
+	}
+	passwords struct {
+		minEntropy   float64
+		breachAPIURL string
+	}
+	oidc struct {
+		redirectBaseURL string
+		providers       []sso.ProviderConfig
+	}
+	contact struct {
+		supportEmail string
+		ipLimit      int
+		window       time.Duration
+	}
+	lockout struct {
+		threshold   int
+		window      time.Duration
+		duration    time.Duration
+		ipThreshold int
+	}
 	url struct {
-		activationURL     string
-		authenticationURL string
+		activationURL        string
+		authenticationURL    string
+		passwordResetURL     string
+		emailChangeURL       string
+		emailCancelURL       string
+		magicLinkURL         string
+		revokeSessionsURL    string
+		digestUnsubscribeURL string
 	}
 }
 
 type application struct {
-	config config
-	logger *zap.Logger
-	models data.Models
-	mailer mailer.Mailer
-	wg     sync.WaitGroup
+	config    config
+	logger    *zap.Logger
+	models    data.Models
+	mailer    mailer.Mailer
+	sso       *sso.Providers
+	passwords *passwords.Policy
+	wg        sync.WaitGroup
 }
 
 func main() {
@@ -108,9 +162,56 @@ func main() {
 	flag.StringVar(&cfg.smtp.username, "smtp-username", os.Getenv("MUSICALZOE_SMTP_USERNAME"), "SMTP server username")
 	flag.StringVar(&cfg.smtp.password, "smtp-password", os.Getenv("MUSICALZOE_SMTP_PASSWORD"), "SMTP server password")
 	flag.StringVar(&cfg.smtp.sender, "smtp-sender", os.Getenv("MUSICALZOE_SMTP_SENDER"), "SMTP sender email address")
+	// Mailer transport
+	flag.StringVar(&cfg.mailer.transport, "mailer-transport", getEnvDefault("MUSICALZOE_MAILER_TRANSPORT", mailer.TransportSMTP), "How emails are delivered (smtp|file|log|memory)")
+	flag.StringVar(&cfg.mailer.outboxDir, "mailer-outbox-dir", "tmp/outbox", "Directory the file transport writes .eml files to")
+	// Email outbox workers
+	flag.IntVar(&cfg.outbox.workers, "email-workers", data.DefaultEmailOutboxWorkers, "Number of workers delivering queued emails")
+	flag.DurationVar(&cfg.outbox.pollInterval, "email-poll-interval", data.DefaultEmailOutboxPollInterval, "How often idle email workers check for queued emails")
+	flag.IntVar(&cfg.outbox.maxAttempts, "email-max-attempts", data.DefaultEmailOutboxMaxAttempts, "Delivery attempts before a queued email is dead-lettered")
+	flag.DurationVar(&cfg.outbox.retention, "email-retention", data.DefaultEmailOutboxRetention, "How long sent and dead-lettered emails are kept in the outbox")
 	// URL configuration
 	flag.StringVar(&cfg.url.activationURL, "activation-url", "http://localhost:4000/v1/api/activated/token=", "Activation URL for user registration")
 	flag.StringVar(&cfg.url.authenticationURL, "authentication-url", "http://localhost:4000/v1/api/authentication", "Authentication URL for user login")
+	flag.StringVar(&cfg.url.emailChangeURL, "email-change-url", "http://localhost:4000/v1/api/me/email/token=", "Email change confirmation URL")
+	flag.StringVar(&cfg.url.emailCancelURL, "email-cancel-url", "http://localhost:4000/v1/api/me/email/cancel/token=", "Email change cancellation URL")
+	flag.StringVar(&cfg.url.magicLinkURL, "magic-link-url", "http://localhost:4000/v1/api/authentication/magic-link/token=", "Magic link URL for passwordless login")
+	flag.StringVar(&cfg.url.passwordResetURL, "password-reset-url", "http://localhost:4000/v1/api/password/token=", "Password reset URL for forgotten passwords")
+	flag.StringVar(&cfg.url.revokeSessionsURL, "revoke-sessions-url", "http://localhost:4000/v1/api/sessions/revoke/token=", "Revoke all sessions URL sent in new device login alerts")
+	flag.StringVar(&cfg.url.digestUnsubscribeURL, "digest-unsubscribe-url", "http://localhost:4000/v1/api/digest/unsubscribe?token=", "One-click unsubscribe URL sent in weekly digest emails")
+	// Activation configuration
+	flag.DurationVar(&cfg.activation.resendInterval, "activation-resend-interval", 5*time.Minute, "Minimum time between activation email resends for the same account")
+	// Session token lifetimes
+	flag.DurationVar(&cfg.tokens.accessTTL, "access-token-ttl", data.DefaultAccessTokenExpiryTime, "Lifetime of bearer access tokens")
+	flag.DurationVar(&cfg.tokens.refreshTTL, "refresh-token-ttl", data.DefaultRefreshTokenExpiryTime, "Lifetime of refresh tokens")
+	// Login lockout configuration
+	flag.IntVar(&cfg.lockout.threshold, "login-lockout-threshold", data.DefaultLoginLockoutThreshold, "Failed logins for one email within the window before it is locked")
+	flag.DurationVar(&cfg.lockout.window, "login-lockout-window", data.DefaultLoginLockoutWindow, "Window in which failed logins are counted")
+	flag.DurationVar(&cfg.lockout.duration, "login-lockout-duration", data.DefaultLoginLockoutDuration, "How long an email stays locked once the threshold is reached")
+	flag.IntVar(&cfg.lockout.ipThreshold, "login-ip-threshold", data.DefaultLoginIPThreshold, "Failed logins from one IP address within the window before it is throttled")
+	// Contact form configuration
+	flag.StringVar(&cfg.contact.supportEmail, "support-email", os.Getenv("MUSICALZOE_SUPPORT_EMAIL"), "Address notified of new contact form messages")
+	flag.IntVar(&cfg.contact.ipLimit, "contact-ip-limit", data.DefaultContactIPLimit, "Contact form messages accepted from one IP address within the window")
+	flag.DurationVar(&cfg.contact.window, "contact-window", data.DefaultContactWindow, "Window in which contact form messages are counted")
+	// Janitor configuration
+	flag.DurationVar(&cfg.janitor.interval, "janitor-interval", time.Hour, "How often expired tokens and stale accounts are cleaned up (0 disables)")
+	flag.DurationVar(&cfg.janitor.unactivatedUserMaxAge, "unactivated-user-max-age", 0, "Age at which accounts that were never activated are deleted (0 disables)")
+	flag.DurationVar(&cfg.janitor.activationReminderAge, "activation-reminder-age", 0, "Age at which unactivated accounts get a reminder email before deletion (0 disables)")
+	// Weekly digest configuration
+	flag.DurationVar(&cfg.digest.interval, "digest-interval", 5*time.Minute, "How often due weekly digest emails are sent (0 disables)")
+	// Password policy configuration
+	flag.Float64Var(&cfg.passwords.minEntropy, "password-min-entropy", passwords.DefaultMinEntropy, "Minimum estimated password strength in bits")
+	flag.StringVar(&cfg.passwords.breachAPIURL, "password-breach-api-url", os.Getenv("MUSICALZOE_PASSWORD_BREACH_API_URL"), "HIBP compatible range API for breached password checks, e.g. https://api.pwnedpasswords.com (empty disables)")
+	// OpenID Connect providers
+	flag.StringVar(&cfg.oidc.redirectBaseURL, "oidc-redirect-base-url", "http://localhost:4000/v1/api/authentication/oidc", "Base URL of the OIDC callbacks, each provider redirects to <base>/<name>/callback")
+	flag.Func("oidc-provider", "OIDC provider as name=..,issuer=..,client-id=..,client-secret=.. (repeatable)", func(val string) error {
+		provider, err := sso.ParseProviderConfig(val)
+		if err != nil {
+			return err
+		}
+		cfg.oidc.providers = append(cfg.oidc.providers, provider)
+		return nil
+	})
 	// CORS configuration
 	flag.Func("cors-trusted-origins", "Trusted CORS origins (space separated)", func(val string) error {
 		cfg.cors.trustedOrigins = strings.Fields(val)
@@ -119,6 +220,13 @@ func main() {
 	})
 	// Parse the flags
 	flag.Parse()
+	// reminders are only sent ahead of a purge, so they only need checking when one is set
+	if cfg.janitor.unactivatedUserMaxAge > 0 && cfg.janitor.activationReminderAge >= cfg.janitor.unactivatedUserMaxAge {
+		logger.Fatal("activation-reminder-age must be less than unactivated-user-max-age")
+	}
+	if cfg.outbox.workers < 1 || cfg.outbox.maxAttempts < 1 || cfg.outbox.pollInterval <= 0 {
+		logger.Fatal("email-workers, email-max-attempts and email-poll-interval must be positive")
+	}
 
 	logger.Info("Database configuration",
 		zap.String("dsn", cfg.db.dsn),
@@ -145,20 +253,32 @@ func main() {
 	}
 
 	// Load additional configuration from environment variables
-	loadConfig(&cfg)
+	loadConfig(&cfg, logger)
 	// create our connection pull
 	db, err := openDB(cfg)
 	if err != nil {
 		logger.Fatal(err.Error(), zap.String("dsn", cfg.db.dsn))
 	}
+	// Pick how emails are delivered
+	transport, err := newMailTransport(cfg, logger)
+	if err != nil {
+		logger.Fatal(err.Error(), zap.String("transport", cfg.mailer.transport))
+	}
+	// Build the identity providers, discovery happens on first use
+	providers, err := sso.New(cfg.oidc.redirectBaseURL, cfg.oidc.providers)
+	if err != nil {
+		logger.Fatal(err.Error())
+	}
 	// Init our exp metrics variables for server metrics.
 	publishMetrics()
 	// instantiate the application struct for dependency injection
 	app := &application{
-		config: cfg,
-		logger: logger,
-		models: data.NewModels(db),
-		mailer: mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
+		config:    cfg,
+		logger:    logger,
+		models:    data.NewModels(db),
+		mailer:    mailer.New(transport, cfg.smtp.sender),
+		sso:       providers,
+		passwords: passwords.New(cfg.passwords.minEntropy, cfg.passwords.breachAPIURL),
 	}
 	// Print the version information
 	logger.Info("Starting LeadHub Service",
@@ -195,6 +315,24 @@ func openDB(cfg config) (*database.Queries, error) {
 	return queries, nil
 }
 
+// newMailTransport() builds the mail transport chosen with -mailer-transport. The file,
+// log and memory transports never send anything, which is useful when there is no SMTP
+// server to hand.
+func newMailTransport(cfg config, logger *zap.Logger) (mailer.Transport, error) {
+	switch cfg.mailer.transport {
+	case mailer.TransportSMTP:
+		return mailer.NewSMTPTransport(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password), nil
+	case mailer.TransportFile:
+		return mailer.NewFileTransport(cfg.mailer.outboxDir)
+	case mailer.TransportLog:
+		return mailer.NewLogTransport(logger), nil
+	case mailer.TransportMemory:
+		return mailer.NewMemoryTransport(), nil
+	default:
+		return nil, fmt.Errorf("unknown mailer transport %q, must be one of %s", cfg.mailer.transport, strings.Join(mailer.Transports, ", "))
+	}
+}
+
 // publishMetrics sets up the expvar variables for the application
 // It sets the version, the number of active goroutines, and the current Unix timestamp.
 func publishMetrics() {
@@ -210,7 +348,7 @@ func publishMetrics() {
 }
 
 // loadConfig loads additional configuration values from environment variables
-func loadConfig(cfg *config) {
+func loadConfig(cfg *config, logger *zap.Logger) {
 	// Set API configuration
 	cfg.api.name = getEnvDefault("MUSICALZOE_API_NAME", "MUSICALZOE API")
 	cfg.api.author = getEnvDefault("MUSICALZOE_API_AUTHOR", "Blue-Davinci")
@@ -230,6 +368,18 @@ func loadConfig(cfg *config) {
 			cfg.cors.trustedOrigins[i] = strings.TrimSpace(origin)
 		}
 	}
+
+	// Add OIDC providers from the environment (semicolon-separated), unless set by flag
+	if providersStr := os.Getenv("MUSICALZOE_OIDC_PROVIDERS"); providersStr != "" && len(cfg.oidc.providers) == 0 {
+		for _, val := range strings.Split(providersStr, ";") {
+			provider, err := sso.ParseProviderConfig(strings.TrimSpace(val))
+			if err != nil {
+				logger.Warn("ignoring invalid OIDC provider", zap.Error(err))
+				continue
+			}
+			cfg.oidc.providers = append(cfg.oidc.providers, provider)
+		}
+	}
 }
 
 // getEnvDefault gets an environment variable with a default fallback
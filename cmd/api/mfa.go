@@ -0,0 +1,354 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Blue-Davinci/musical-zoe/internal/data"
+	"github.com/Blue-Davinci/musical-zoe/internal/validator"
+	"github.com/tomasen/realip"
+	"go.uber.org/zap"
+)
+
+// setupMFAHandler() starts TOTP enrollment for the authenticated user. It generates a
+// fresh secret, saves it against the user (still disabled) and returns the otpauth URL
+// and a QR code that can be scanned by an authenticator app. MFA is only switched on
+// once the user proves they can produce a valid code via verifyMFAHandler().
+func (app *application) setupMFAHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	// users who already have MFA enabled must not be able to silently rotate the secret
+	if user.MFAEnabled {
+		app.mfaAlreadyEnabledResponse(w, r)
+		return
+	}
+	setup, err := data.GenerateMFASetup(app.config.api.name, user.Email)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	// store the pending secret
+	user.MFASecret = setup.Secret
+	err = app.models.Users.UpdateUser(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrGeneralEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"mfa": setup}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// verifyMFAHandler() completes TOTP enrollment. The user submits a code from their
+// authenticator app and, if it matches the pending secret, MFA is enabled on the account.
+func (app *application) verifyMFAHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Code string `json:"code"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if data.ValidateTOTPCode(v, input.Code); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	user := app.contextGetUser(r)
+	if user.MFAEnabled {
+		app.mfaAlreadyEnabledResponse(w, r)
+		return
+	}
+	// the user needs to have started enrollment first
+	if user.MFASecret == "" {
+		v.AddError("mfa", "multi-factor authentication setup has not been started")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	ok, err := app.verifyTOTP(user, input.Code)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !ok {
+		app.recordAuditEvent(r, data.AuditEventMFAEnrollmentFailure, user.ID, user.Email, map[string]any{"reason": "invalid mfa code"})
+		app.invalidMFACodeResponse(w, r)
+		return
+	}
+	user.MFAEnabled = true
+	err = app.models.Users.UpdateUser(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrGeneralEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	// hand out the initial set of single-use recovery codes
+	recoveryCodes, err := app.models.Tokens.NewRecoveryCodes(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	emailData := map[string]any{
+		"userName": user.Name,
+	}
+	err = app.sendEmail(user.Email, "user_mfa_enabled.tmpl", user.Locale, emailData)
+	if err != nil {
+		app.logger.Error("failed to send mfa acknowledgment email", zap.String("email", user.Email), zap.Error(err))
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{
+		"message":        "multi-factor authentication has been enabled",
+		"recovery_codes": recoveryCodes,
+	}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createMFAAuthenticationApiKeyHandler() is the second step of an MFA login. It exchanges
+// the short-lived mfa-login token issued by createAuthenticationApiKeyHandler() and a
+// valid TOTP code for a normal authentication bearer token. Wrong codes are limited in
+// the same way as wrong passwords, see failedMFAResponse().
+func (app *application) createMFAAuthenticationApiKeyHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		TokenPlaintext string `json:"token"`
+		Code           string `json:"code"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	data.ValidateTokenPlaintext(v, input.TokenPlaintext)
+	data.ValidateTOTPCode(v, input.Code)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	// get the user associated with the mfa-login token
+	user, err := app.models.Users.GetForToken(data.ScopeMFALogin, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrGeneralRecordNotFound):
+			app.invalidCredentialsResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	ipAddress := realip.FromRequest(r)
+	if app.loginThrottledResponse(w, r, user.Email, ipAddress) {
+		return
+	}
+	ok, err := app.verifyTOTP(user, input.Code)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !ok {
+		app.failedMFAResponse(w, r, user, ipAddress, input.TokenPlaintext, "invalid mfa code", app.invalidMFACodeResponse)
+		return
+	}
+	// the mfa-login token is single use
+	err = app.models.Tokens.DeleteAllForUser(data.ScopeMFALogin, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.createAuthenticationApiKeyResponse(w, r, user, "")
+}
+
+// failedMFAResponse() records a wrong TOTP or recovery code entered at the second login
+// step and responds to it. The failure counts towards the lockout of the user's email
+// like a wrong password, and once DefaultMFAMaxAttempts wrong codes have been entered
+// against the mfa-login token it is deleted, so that a correct password is only ever
+// good for a handful of guesses.
+func (app *application) failedMFAResponse(w http.ResponseWriter, r *http.Request, user *data.User, ipAddress, tokenPlaintext, reason string, invalidCodeResponse func(http.ResponseWriter, *http.Request)) {
+	attempts, err := app.models.Tokens.RecordFailedAttempt(data.ScopeMFALogin, tokenPlaintext)
+	if err != nil && !errors.Is(err, data.ErrGeneralRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	// a token that has gone since it was looked up has been used up by another attempt
+	exhausted := attempts >= data.DefaultMFAMaxAttempts || errors.Is(err, data.ErrGeneralRecordNotFound)
+	if exhausted {
+		_, err = app.models.Tokens.DeleteForUser(data.ScopeMFALogin, user.ID, tokenPlaintext)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+	locked, err := app.recordLoginFailure(r, user.Email, ipAddress, user, reason)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	switch {
+	case locked:
+		app.accountLockedResponse(w, r, app.config.lockout.duration)
+	case exhausted:
+		app.invalidCredentialsResponse(w, r)
+	default:
+		invalidCodeResponse(w, r)
+	}
+}
+
+// verifyTOTP() checks a TOTP code for the user and uses up its time step, so that a code
+// which has been accepted once, for example one read over the user's shoulder, can't be
+// used again.
+func (app *application) verifyTOTP(user *data.User, code string) (bool, error) {
+	step, ok := user.MatchTOTP(code, time.Now())
+	if !ok {
+		return false, nil
+	}
+	return app.models.Users.UseTOTPStep(user.ID, step)
+}
+
+// getRecoveryCodesHandler() returns how many unused recovery codes the user has left.
+// The codes themselves are only stored as hashes and can never be shown again.
+func (app *application) getRecoveryCodesHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	remaining, err := app.models.Tokens.CountForUser(data.ScopeRecovery, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"recovery_codes": envelope{
+		"mfa_enabled": user.MFAEnabled,
+		"remaining":   remaining,
+	}}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// regenerateRecoveryCodesHandler() invalidates the user's existing recovery codes and
+// issues a fresh set. A valid TOTP code is required so that a stolen bearer token alone
+// is not enough to take over the account's recovery options, and wrong codes count
+// towards the login lockout.
+func (app *application) regenerateRecoveryCodesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Code string `json:"code"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if data.ValidateTOTPCode(v, input.Code); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	user := app.contextGetUser(r)
+	if !user.MFAEnabled {
+		v.AddError("mfa", "multi-factor authentication must be enabled to use recovery codes")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	// wrong codes are throttled like a login, or the code could be guessed with the
+	// bearer token alone
+	ipAddress := realip.FromRequest(r)
+	if app.loginThrottledResponse(w, r, user.Email, ipAddress) {
+		return
+	}
+	ok, err := app.verifyTOTP(user, input.Code)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !ok {
+		app.failedReconfirmationResponse(w, r, user, ipAddress, "invalid mfa code", app.invalidMFACodeResponse)
+		return
+	}
+	recoveryCodes, err := app.models.Tokens.NewRecoveryCodes(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusCreated, envelope{"recovery_codes": recoveryCodes}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createRecoveryAuthenticationApiKeyHandler() is an alternative second login step for
+// users who have lost access to their authenticator app. It exchanges the mfa-login
+// token and one of the user's single-use recovery codes for a bearer token, and emails
+// the user so that any unexpected use of a recovery code is noticed. Wrong codes are
+// limited in the same way as wrong TOTP codes.
+func (app *application) createRecoveryAuthenticationApiKeyHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		TokenPlaintext string `json:"token"`
+		RecoveryCode   string `json:"recovery_code"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	data.ValidateTokenPlaintext(v, input.TokenPlaintext)
+	data.ValidateRecoveryCode(v, input.RecoveryCode)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	// get the user associated with the mfa-login token
+	user, err := app.models.Users.GetForToken(data.ScopeMFALogin, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrGeneralRecordNotFound):
+			app.invalidCredentialsResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	ipAddress := realip.FromRequest(r)
+	if app.loginThrottledResponse(w, r, user.Email, ipAddress) {
+		return
+	}
+	// consume the recovery code
+	ok, err := app.models.Tokens.UseRecoveryCode(user.ID, input.RecoveryCode)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !ok {
+		app.failedMFAResponse(w, r, user, ipAddress, input.TokenPlaintext, "invalid recovery code", app.invalidRecoveryCodeResponse)
+		return
+	}
+	// the mfa-login token is single use
+	err = app.models.Tokens.DeleteAllForUser(data.ScopeMFALogin, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	remaining, err := app.models.Tokens.CountForUser(data.ScopeRecovery, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	emailData := map[string]any{
+		"userName":       user.Name,
+		"remainingCodes": remaining,
+		"usedAt":         time.Now(),
+	}
+	err = app.sendEmail(user.Email, "user_recovery_code_used.tmpl", user.Locale, emailData)
+	if err != nil {
+		app.logger.Error("failed to send recovery acknowledgment email", zap.String("email", user.Email), zap.Error(err))
+	}
+	app.createAuthenticationApiKeyResponse(w, r, user, "")
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Blue-Davinci/musical-zoe/internal/data"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/pquerna/otp/totp"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+const testMFASecret = "JBSWY3DPEHPK3PXP"
+
+func TestCreateMFAAuthenticationApiKeyHandler(t *testing.T) {
+	user := testUser{ID: 7, Name: "Zoe", Email: "zoe@example.com", Password: "pa55word1234", Activated: true, MFASecret: testMFASecret, Version: 1}
+	validCode, err := totp.GenerateCode(testMFASecret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrongCode := "000000"
+	if wrongCode == validCode {
+		wrongCode = "111111"
+	}
+	mfaToken := "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+	tests := []struct {
+		name           string
+		code           string
+		expect         func(mock sqlmock.Sqlmock)
+		expectedStatus int
+		expectedError  string
+	}{
+		{
+			name: "wrong code is counted against the token",
+			code: wrongCode,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectLoginNotThrottled(mock)
+				mock.ExpectQuery(query("IncrementApiKeyFailedAttempts")).WillReturnRows(sqlmock.NewRows([]string{"failed_attempts"}).AddRow(1))
+				expectLoginFailure(mock, 1)
+			},
+			expectedStatus: http.StatusUnauthorized,
+			expectedError:  "invalid or expired multi-factor authentication code",
+		},
+		{
+			name: "token is deleted after too many wrong codes",
+			code: wrongCode,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectLoginNotThrottled(mock)
+				mock.ExpectQuery(query("IncrementApiKeyFailedAttempts")).WillReturnRows(sqlmock.NewRows([]string{"failed_attempts"}).AddRow(5))
+				mock.ExpectExec(query("DeleteApiKeyForUser")).WillReturnResult(sqlmock.NewResult(0, 1))
+				expectLoginFailure(mock, 2)
+			},
+			expectedStatus: http.StatusUnauthorized,
+			expectedError:  "invalid authentication credentials",
+		},
+		{
+			name: "wrong codes lock the account",
+			code: wrongCode,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectLoginNotThrottled(mock)
+				mock.ExpectQuery(query("IncrementApiKeyFailedAttempts")).WillReturnRows(sqlmock.NewRows([]string{"failed_attempts"}).AddRow(3))
+				expectLoginFailure(mock, 5)
+				mock.ExpectExec(query("UpsertLoginLockout")).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery(query("InsertEmailOutboxMessage")).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+			},
+			expectedStatus: http.StatusLocked,
+			expectedError:  "this account is temporarily locked",
+		},
+		{
+			name: "replayed code is rejected",
+			code: validCode,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectLoginNotThrottled(mock)
+				mock.ExpectExec(query("UseMFAStep")).WithArgs(int64(7), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(query("IncrementApiKeyFailedAttempts")).WillReturnRows(sqlmock.NewRows([]string{"failed_attempts"}).AddRow(1))
+				expectLoginFailure(mock, 1)
+			},
+			expectedStatus: http.StatusUnauthorized,
+			expectedError:  "invalid or expired multi-factor authentication code",
+		},
+		{
+			name: "locked account is refused before the code is checked",
+			code: validCode,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(query("GetLoginLockout")).WillReturnRows(sqlmock.NewRows([]string{"locked_until"}).AddRow(time.Now().Add(time.Minute)))
+			},
+			expectedStatus: http.StatusLocked,
+			expectedError:  "this account is temporarily locked",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, mock := newTestApplication(t)
+			mock.ExpectQuery(query("GetForToken")).WillReturnRows(user.rows(t))
+			tt.expect(mock)
+
+			req := newJSONRequest(t, http.MethodPost, "/v1/api/authentication/mfa", map[string]string{"token": mfaToken, "code": tt.code})
+			rr := httptest.NewRecorder()
+			app.createMFAAuthenticationApiKeyHandler(rr, req)
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body)
+			}
+			if !strings.Contains(rr.Body.String(), tt.expectedError) {
+				t.Errorf("expected error %q, got %s", tt.expectedError, rr.Body)
+			}
+		})
+	}
+}
+
+func TestPasswordLoginDoesNotResetMFAFailures(t *testing.T) {
+	user := testUser{ID: 7, Name: "Zoe", Email: "zoe@example.com", Password: "pa55word1234", Activated: true, MFASecret: testMFASecret, Version: 1}
+	wrongCode := "000000"
+	if validCode, _ := totp.GenerateCode(testMFASecret, time.Now()); wrongCode == validCode {
+		wrongCode = "111111"
+	}
+	app, mock := newTestApplication(t)
+	// an unexpected query, such as the failures being cleared, is only logged
+	core, logs := observer.New(zap.ErrorLevel)
+	app.logger = zap.New(core)
+	// keep the email below its lockout so that the network limit is what stops the guesses
+	app.config.lockout.threshold = 10
+	app.config.lockout.ipThreshold = 2 * (data.DefaultMFAMaxAttempts - 1)
+
+	var failures int64
+	expectThrottleCheck := func() {
+		mock.ExpectQuery(query("GetLoginLockout")).WillReturnRows(sqlmock.NewRows([]string{"locked_until"}))
+		mock.ExpectQuery(query("CountLoginFailuresForIP")).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(failures))
+	}
+	login := func() *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		app.createAuthenticationApiKeyHandler(rr, newJSONRequest(t, http.MethodPost, "/v1/api/authentication", map[string]string{"email": user.Email, "password": user.Password}))
+		return rr
+	}
+
+	// the password is right every time, the code never is
+	for range 2 {
+		expectThrottleCheck()
+		mock.ExpectQuery(query("GetUserByEmail")).WillReturnRows(user.rows(t))
+		mock.ExpectQuery(query("InsertApiKey")).WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(1, time.Now()))
+		if rr := login(); rr.Code != http.StatusAccepted {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusAccepted, rr.Code, rr.Body)
+		}
+		for attempt := 1; attempt < data.DefaultMFAMaxAttempts; attempt++ {
+			mock.ExpectQuery(query("GetForToken")).WillReturnRows(user.rows(t))
+			expectThrottleCheck()
+			mock.ExpectQuery(query("IncrementApiKeyFailedAttempts")).WillReturnRows(sqlmock.NewRows([]string{"failed_attempts"}).AddRow(attempt))
+			failures++
+			expectLoginFailure(mock, failures)
+			rr := httptest.NewRecorder()
+			app.createMFAAuthenticationApiKeyHandler(rr, newJSONRequest(t, http.MethodPost, "/v1/api/authentication/mfa", map[string]string{"token": "ABCDEFGHIJKLMNOPQRSTUVWXYZ", "code": wrongCode}))
+			if rr.Code != http.StatusUnauthorized {
+				t.Fatalf("expected status %d, got %d: %s", http.StatusUnauthorized, rr.Code, rr.Body)
+			}
+		}
+	}
+	expectThrottleCheck()
+	if rr := login(); rr.Code != http.StatusTooManyRequests {
+		t.Errorf("expected status %d, got %d: %s", http.StatusTooManyRequests, rr.Code, rr.Body)
+	}
+	for _, entry := range logs.All() {
+		t.Errorf("unexpected error logged: %s %v", entry.Message, entry.ContextMap())
+	}
+}
+
+func TestCreateRecoveryAuthenticationApiKeyHandler(t *testing.T) {
+	user := testUser{ID: 7, Name: "Zoe", Email: "zoe@example.com", Password: "pa55word1234", Activated: true, MFASecret: testMFASecret, Version: 1}
+	mfaToken := "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+	tests := []struct {
+		name           string
+		expect         func(mock sqlmock.Sqlmock)
+		expectedStatus int
+		expectedError  string
+	}{
+		{
+			name: "wrong code is counted against the token",
+			expect: func(mock sqlmock.Sqlmock) {
+				expectLoginNotThrottled(mock)
+				mock.ExpectExec(query("DeleteApiKeyForUser")).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(query("IncrementApiKeyFailedAttempts")).WillReturnRows(sqlmock.NewRows([]string{"failed_attempts"}).AddRow(1))
+				expectLoginFailure(mock, 1)
+			},
+			expectedStatus: http.StatusUnauthorized,
+			expectedError:  "invalid or already used recovery code",
+		},
+		{
+			name: "token is deleted after too many wrong codes",
+			expect: func(mock sqlmock.Sqlmock) {
+				expectLoginNotThrottled(mock)
+				mock.ExpectExec(query("DeleteApiKeyForUser")).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(query("IncrementApiKeyFailedAttempts")).WillReturnRows(sqlmock.NewRows([]string{"failed_attempts"}).AddRow(5))
+				mock.ExpectExec(query("DeleteApiKeyForUser")).WillReturnResult(sqlmock.NewResult(0, 1))
+				expectLoginFailure(mock, 2)
+			},
+			expectedStatus: http.StatusUnauthorized,
+			expectedError:  "invalid authentication credentials",
+		},
+		{
+			name: "valid code logs in and is acknowledged by email",
+			expect: func(mock sqlmock.Sqlmock) {
+				expectLoginNotThrottled(mock)
+				mock.ExpectExec(query("DeleteApiKeyForUser")).WithArgs(int64(7), sqlmock.AnyArg(), data.ScopeRecovery).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(query("DeletAllAPIKeysForUser")).WithArgs(data.ScopeMFALogin, int64(7)).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery(query("CountApiKeysForUser")).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(9))
+				expectEmailQueued(mock)
+				expectNewSession(mock)
+			},
+			expectedStatus: http.StatusCreated,
+			expectedError:  "api_key",
+		},
+		{
+			name: "locked account is refused before the code is used",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(query("GetLoginLockout")).WillReturnRows(sqlmock.NewRows([]string{"locked_until"}).AddRow(time.Now().Add(time.Minute)))
+			},
+			expectedStatus: http.StatusLocked,
+			expectedError:  "this account is temporarily locked",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, mock := newTestApplication(t)
+			mock.ExpectQuery(query("GetForToken")).WillReturnRows(user.rows(t))
+			tt.expect(mock)
+
+			req := newJSONRequest(t, http.MethodPost, "/v1/api/authentication/recovery", map[string]string{"token": mfaToken, "recovery_code": "ABCDE-FGHIJ"})
+			rr := httptest.NewRecorder()
+			app.createRecoveryAuthenticationApiKeyHandler(rr, req)
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body)
+			}
+			if !strings.Contains(rr.Body.String(), tt.expectedError) {
+				t.Errorf("expected error %q, got %s", tt.expectedError, rr.Body)
+			}
+		})
+	}
+}
+
+func TestRegenerateRecoveryCodesHandler(t *testing.T) {
+	withMFA := testUser{ID: 7, Name: "Zoe", Email: "zoe@example.com", Password: "pa55word1234", Activated: true, MFASecret: testMFASecret, Version: 1}
+	withoutMFA := testUser{ID: 8, Name: "Max", Email: "max@example.com", Password: "pa55word1234", Activated: true, Version: 1}
+	validCode, err := totp.GenerateCode(testMFASecret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrongCode := "000000"
+	if wrongCode == validCode {
+		wrongCode = "111111"
+	}
+
+	tests := []struct {
+		name           string
+		user           testUser
+		code           string
+		expect         func(mock sqlmock.Sqlmock)
+		expectedStatus int
+		expectedCodes  int
+	}{
+		{
+			name: "replaces the whole set",
+			user: withMFA,
+			code: validCode,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectLoginNotThrottled(mock)
+				mock.ExpectExec(query("UseMFAStep")).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(query("DeletAllAPIKeysForUser")).WithArgs(data.ScopeRecovery, int64(7)).WillReturnResult(sqlmock.NewResult(0, 10))
+				for range data.DefaultRecoveryCodeCount {
+					mock.ExpectQuery(query("InsertApiKey")).WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(1, time.Now()))
+				}
+			},
+			expectedStatus: http.StatusCreated,
+			expectedCodes:  data.DefaultRecoveryCodeCount,
+		},
+		{
+			name: "wrong code keeps the old set and counts as a failed login",
+			user: withMFA,
+			code: wrongCode,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectLoginNotThrottled(mock)
+				expectLoginFailure(mock, 1)
+			},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "wrong codes lock the account",
+			user: withMFA,
+			code: wrongCode,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectLoginNotThrottled(mock)
+				expectLoginFailure(mock, 5)
+				mock.ExpectExec(query("UpsertLoginLockout")).WillReturnResult(sqlmock.NewResult(0, 1))
+				expectEmailQueued(mock)
+			},
+			expectedStatus: http.StatusLocked,
+		},
+		{
+			name: "locked account is refused before the code is checked",
+			user: withMFA,
+			code: validCode,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(query("GetLoginLockout")).WillReturnRows(sqlmock.NewRows([]string{"locked_until"}).AddRow(time.Now().Add(time.Minute)))
+			},
+			expectedStatus: http.StatusLocked,
+		},
+		{
+			name:           "mfa not enabled",
+			user:           withoutMFA,
+			code:           validCode,
+			expect:         func(mock sqlmock.Sqlmock) {},
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, mock := newTestApplication(t)
+			u := tt.user.load(t, app, mock)
+			tt.expect(mock)
+			req := newJSONRequest(t, http.MethodPost, "/v1/api/mfa/recovery-codes", map[string]string{"code": tt.code})
+			rr := httptest.NewRecorder()
+			app.regenerateRecoveryCodesHandler(rr, app.contextSetUser(req, u))
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body)
+			}
+			var response struct {
+				RecoveryCodes []string `json:"recovery_codes"`
+			}
+			err := json.Unmarshal(rr.Body.Bytes(), &response)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(response.RecoveryCodes) != tt.expectedCodes {
+				t.Errorf("expected %d recovery codes, got %d", tt.expectedCodes, len(response.RecoveryCodes))
+			}
+		})
+	}
+}
+
+func TestVerifyMFAHandlerAuditsWrongCodesAsEnrollmentFailures(t *testing.T) {
+	user := testUser{ID: 7, Name: "Zoe", Email: "zoe@example.com", Password: "pa55word1234", Activated: true, MFASecret: testMFASecret, Version: 1}
+	wrongCode := "000000"
+	if validCode, _ := totp.GenerateCode(testMFASecret, time.Now()); wrongCode == validCode {
+		wrongCode = "111111"
+	}
+	app, mock := newTestApplication(t)
+	u := user.load(t, app, mock)
+	// enrollment has been started but not finished
+	u.MFAEnabled = false
+	mock.ExpectQuery(query("InsertAuditEvent")).
+		WithArgs(int64(7), user.Email, data.AuditEventMFAEnrollmentFailure, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(1, time.Now()))
+
+	req := newJSONRequest(t, http.MethodPost, "/v1/api/mfa/verify", map[string]string{"code": wrongCode})
+	rr := httptest.NewRecorder()
+	app.verifyMFAHandler(rr, app.contextSetUser(req, u))
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected status %d, got %d: %s", http.StatusUnauthorized, rr.Code, rr.Body)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"crypto/rand"
 	"errors"
 	"expvar"
 	"fmt"
@@ -8,9 +9,24 @@ import (
 	"strconv"
 
 	"github.com/Blue-Davinci/musical-zoe/internal/data"
+	"github.com/Blue-Davinci/musical-zoe/internal/validator"
 	"github.com/felixge/httpsnoop"
 )
 
+// requestID() gives every request an ID, echoed back in the X-Request-ID response
+// header, so that audit events and logs can be tied to a single request. A well-formed
+// ID sent by a proxy in the request header is kept, otherwise a new one is generated.
+func (app *application) requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(requestIDHeader)
+		if !validator.Matches(requestID, requestIDRX) {
+			requestID = rand.Text()
+		}
+		w.Header().Set(requestIDHeader, requestID)
+		next.ServeHTTP(w, app.contextSetRequestID(r, requestID))
+	})
+}
+
 func (app *application) recoverPanic(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Create a deferred function (which will always be run in the event of a panic
@@ -42,9 +58,10 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 		// caches that the response may vary based on the value of the Authorization
 		// header in the request.
 		w.Header().Add("Vary", "Authorization")
+		w.Header().Add("Vary", apiKeyHeader)
 		// Retrieve the value of the Authorization header from the request. This will
 		// return the empty string "" if there is no such header found.
-		user, err := app.aunthenticatorHelper(r)
+		user, apiKey, err := app.aunthenticatorHelper(r)
 		if user == data.AnonymousUser {
 			r = app.contextSetUser(r, data.AnonymousUser)
 			next.ServeHTTP(w, r)
@@ -64,6 +81,9 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 		// Call the contextSetUser() helper to add the user information to the request
 		// context.
 		r = app.contextSetUser(r, user)
+		if apiKey != nil {
+			r = app.contextSetApiKey(r, apiKey)
+		}
 		// Call the next handler in the chain.
 		next.ServeHTTP(w, r)
 	})
@@ -82,6 +102,12 @@ func (app *application) requireAuthenticatedUser(next http.Handler) http.Handler
 			app.authenticationRequiredResponse(w, r)
 			return
 		}
+		// Personal API keys only work on routes that explicitly accept them through
+		// requireApiKeyScope(); everything else needs a bearer token.
+		if app.contextGetApiKey(r) != nil && !app.contextApiKeyScopeChecked(r) {
+			app.apiKeyNotAllowedResponse(w, r)
+			return
+		}
 		next.ServeHTTP(w, r)
 	})
 }
@@ -101,6 +127,48 @@ func (app *application) requireActivatedUser(next http.Handler) http.Handler {
 	})
 }
 
+// requireApiKeyScope() opts a route in to personal API key authentication. Requests
+// made with a key must hold the given scope; bearer token requests pass straight
+// through. It must run before requireAuthenticatedUser().
+func (app *application) requireApiKeyScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			apiKey := app.contextGetApiKey(r)
+			if apiKey != nil {
+				if !apiKey.HasScope(scope) {
+					app.apiKeyScopeRequiredResponse(w, r, scope)
+					return
+				}
+				r = app.contextSetApiKeyScopeChecked(r)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// requirePermission() checks that the user holds a specific permission code. It is meant
+// to be appended to the dynamic middleware chain, so by the time it runs the user is
+// already known to be authenticated and activated.
+func (app *application) requirePermission(code string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user := app.contextGetUser(r)
+			// Get the slice of permissions for the user.
+			permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+			// If the user doesn't have the required permission, return a 403 Forbidden.
+			if !permissions.Include(code) {
+				app.notPermittedResponse(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 // The metrics() middleware will be used to collect and expose various metrics about the
 // API server, such as the total number of requests received, the total number of
 func (app *application) metrics(next http.Handler) http.Handler {
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/Blue-Davinci/musical-zoe/internal/data"
+	"github.com/Blue-Davinci/musical-zoe/internal/sso"
+	"github.com/Blue-Davinci/musical-zoe/internal/validator"
+	"github.com/go-chi/chi"
+	"go.uber.org/zap"
+)
+
+// getOIDCProvidersHandler() lists the identity providers users can sign in with.
+func (app *application) getOIDCProvidersHandler(w http.ResponseWriter, r *http.Request) {
+	err := app.writeJSON(w, http.StatusOK, envelope{"providers": app.sso.Names()}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// beginOIDCLoginHandler() starts an authorization code login with an identity provider.
+// A fresh state, PKCE verifier and nonce are saved for the callback and the client is
+// redirected to the provider's consent page.
+func (app *application) beginOIDCLoginHandler(w http.ResponseWriter, r *http.Request) {
+	provider, err := app.sso.Get(chi.URLParam(r, "provider"))
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	state := sso.GenerateSecret()
+	request := &data.AuthRequest{
+		Provider:     provider.Name(),
+		CodeVerifier: sso.GenerateSecret(),
+		Nonce:        sso.GenerateSecret(),
+	}
+	err = app.models.Identities.SaveAuthRequest(state, request)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	authURL, err := provider.AuthCodeURL(r.Context(), state, request.CodeVerifier, request.Nonce)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// completeOIDCLoginHandler() handles the provider's redirect back to us. The code is
+// exchanged and the ID token verified, then the identity is matched to a user: first by
+// an existing link, then by a verified email address, and finally by creating a new,
+// already activated account. The response is the same as a password login.
+func (app *application) completeOIDCLoginHandler(w http.ResponseWriter, r *http.Request) {
+	provider, err := app.sso.Get(chi.URLParam(r, "provider"))
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	qs := r.URL.Query()
+	if qs.Get("error") != "" {
+		app.oidcLoginFailedResponse(w, r)
+		return
+	}
+	v := validator.New()
+	v.Check(qs.Get("code") != "", "code", "must be provided")
+	v.Check(qs.Get("state") != "", "state", "must be provided")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	// each state can only be used once, and only with the provider it was issued for
+	request, err := app.models.Identities.ConsumeAuthRequest(qs.Get("state"))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrGeneralRecordNotFound):
+			v.AddError("state", "invalid or expired login state")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if request.Provider != provider.Name() {
+		v.AddError("state", "invalid or expired login state")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	claims, err := provider.Exchange(r.Context(), qs.Get("code"), request.CodeVerifier, request.Nonce)
+	if err != nil {
+		app.logger.Info("oidc code exchange failed", zap.String("provider", provider.Name()), zap.Error(err))
+		app.oidcLoginFailedResponse(w, r)
+		return
+	}
+	user, err := app.models.Identities.GetUser(provider.Name(), claims.Subject)
+	switch {
+	case err == nil:
+		err = app.models.Identities.RecordLogin(provider.Name(), claims.Subject, claims.Email)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	case errors.Is(err, data.ErrGeneralRecordNotFound):
+		// linking by email is only safe when the provider vouches for the address
+		if !claims.EmailVerified {
+			v.AddError("email", "must be verified by the identity provider")
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+		user, err = app.findOrCreateOIDCUser(claims, app.readAcceptLanguage(r))
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		// a suspended account doesn't get a new way in
+		if user.Suspended {
+			app.suspendedAccountResponse(w, r)
+			return
+		}
+		_, err = app.models.Identities.Link(user.ID, provider.Name(), claims.Subject, claims.Email)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	default:
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if user.Suspended {
+		app.suspendedAccountResponse(w, r)
+		return
+	}
+	if !user.Activated {
+		app.inactiveAccountResponse(w, r)
+		return
+	}
+	if user.MFAEnabled {
+		app.createMFAChallengeResponse(w, r, user)
+		return
+	}
+	app.createAuthenticationApiKeyResponse(w, r, user, "")
+}
+
+// findOrCreateOIDCUser() returns the user registered with a provider-verified email,
+// claiming it with claimUnactivatedUser() if it was never activated, since the provider
+// has proven ownership of the address. Suspended users are returned untouched. If
+// there is no such user, an activated one is created in the given locale with a random
+// password that can be replaced through the password reset flow.
+func (app *application) findOrCreateOIDCUser(claims *sso.Claims, locale string) (*data.User, error) {
+	user, err := app.models.Users.GetByEmail(claims.Email)
+	if err == nil {
+		if !user.Activated && !user.Suspended {
+			err = app.claimUnactivatedUser(user)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return user, nil
+	}
+	if !errors.Is(err, data.ErrGeneralRecordNotFound) {
+		return nil, err
+	}
+	name := claims.Name
+	if name == "" {
+		name, _, _ = strings.Cut(claims.Email, "@")
+	}
+	user = &data.User{
+		Name:      name,
+		Email:     claims.Email,
+		Activated: true,
+		Locale:    locale,
+	}
+	err = user.Password.Set(sso.GenerateSecret())
+	if err != nil {
+		return nil, err
+	}
+	err = app.models.Users.Insert(user)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// claimUnactivatedUser() activates an account on behalf of the owner of its email
+// address. Whoever registered it never proved they own the address and may have been
+// someone else, so the password they chose is replaced with a random one and everything
+// issued to the account so far is revoked before it is activated.
+func (app *application) claimUnactivatedUser(user *data.User) error {
+	err := app.models.Tokens.DeleteEveryScopeForUser(user.ID)
+	if err != nil {
+		return err
+	}
+	_, err = app.models.ApiKeys.DeleteAllForUser(user.ID)
+	if err != nil {
+		return err
+	}
+	err = user.Password.Set(sso.GenerateSecret())
+	if err != nil {
+		return err
+	}
+	user.MFAEnabled = false
+	user.MFASecret = ""
+	user.PendingEmail = ""
+	user.Activated = true
+	return app.models.Users.UpdateUser(user)
+}
+
+// getUserIdentitiesHandler() lists the identity provider accounts linked to the user.
+func (app *application) getUserIdentitiesHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	identities, err := app.models.Identities.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"identities": identities}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteUserIdentityHandler() unlinks an identity provider account from the user.
+func (app *application) deleteUserIdentityHandler(w http.ResponseWriter, r *http.Request) {
+	identityID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	user := app.contextGetUser(r)
+	err = app.models.Identities.DeleteForUser(identityID, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrGeneralRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "identity successfully unlinked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Blue-Davinci/musical-zoe/internal/sso"
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestFindOrCreateOIDCUser(t *testing.T) {
+	claims := &sso.Claims{Subject: "sub-1", Email: "zoe@example.com", EmailVerified: true, Name: "Zoe"}
+
+	t.Run("activated account is linked as it is", func(t *testing.T) {
+		app, mock := newTestApplication(t)
+		owner := testUser{ID: 1, Name: "Zoe", Email: claims.Email, Password: "owner-password", Activated: true, Version: 3}
+		mock.ExpectQuery(query("GetUserByEmail")).WithArgs(claims.Email).WillReturnRows(owner.rows(t))
+
+		user, err := app.findOrCreateOIDCUser(claims, "en")
+		if err != nil {
+			t.Fatal(err)
+		}
+		match, err := user.Password.Matches("owner-password")
+		if err != nil || !match {
+			t.Errorf("expected the owner's password to be kept, got %v, %v", match, err)
+		}
+	})
+
+	t.Run("unactivated account is claimed", func(t *testing.T) {
+		app, mock := newTestApplication(t)
+		attacker := testUser{ID: 2, Name: "Mallory", Email: claims.Email, Password: "attacker-password", Version: 1}
+		mock.ExpectQuery(query("GetUserByEmail")).WithArgs(claims.Email).WillReturnRows(attacker.rows(t))
+		mock.ExpectExec(query("DeleteApiKeysForUser")).WithArgs(int64(2)).WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectExec(query("DeleteAllPersonalApiKeysForUser")).WithArgs(int64(2)).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(query("UpdateUser")).
+			WillReturnRows(sqlmock.NewRows([]string{"version", "updated_at"}).AddRow(2, time.Now()))
+
+		user, err := app.findOrCreateOIDCUser(claims, "en")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !user.Activated {
+			t.Error("expected the account to be activated")
+		}
+		match, err := user.Password.Matches("attacker-password")
+		if err != nil || match {
+			t.Errorf("expected the registrant's password to be replaced, got %v, %v", match, err)
+		}
+	})
+	t.Run("suspended account is left suspended", func(t *testing.T) {
+		app, mock := newTestApplication(t)
+		suspended := testUser{ID: 3, Name: "Zoe", Email: claims.Email, Password: "owner-password", Suspended: true, Version: 4}
+		mock.ExpectQuery(query("GetUserByEmail")).WithArgs(claims.Email).WillReturnRows(suspended.rows(t))
+
+		user, err := app.findOrCreateOIDCUser(claims, "en")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.Activated || !user.Suspended {
+			t.Errorf("expected the account to stay suspended, got activated=%v suspended=%v", user.Activated, user.Suspended)
+		}
+		// nothing may be revoked or updated
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"github.com/Blue-Davinci/musical-zoe/internal/data"
+	"github.com/Blue-Davinci/musical-zoe/internal/mailer"
+	"github.com/Blue-Davinci/musical-zoe/internal/validator"
+	"go.uber.org/zap"
+)
+
+// emailOutboxMetrics exposes running totals of the email workers' deliveries under
+// "email_outbox" on the /debug/vars endpoint.
+var emailOutboxMetrics = expvar.NewMap("email_outbox")
+
+// sendEmail() renders an email and queues it in the email outbox, from where the email
+// workers deliver it. The email is durable once this returns, so it survives restarts
+// and mail server outages. It is written in the recipient's locale where the template has
+// been translated, and in English otherwise.
+func (app *application) sendEmail(recipient, templateFile, locale string, templateData map[string]any) error {
+	msg, err := app.mailer.Render(recipient, templateFile, locale, templateData)
+	if err != nil {
+		return err
+	}
+	return app.queueEmail(templateFile, msg)
+}
+
+// queueEmail() queues an already rendered email in the email outbox, for callers that
+// need to adjust the message, such as adding headers, before it is sent.
+func (app *application) queueEmail(templateFile string, msg *mailer.Message) error {
+	return app.models.EmailOutbox.Insert(&data.EmailOutboxMessage{
+		MessageID: msg.ID,
+		Recipient: msg.To,
+		Sender:    msg.From,
+		Template:  templateFile,
+		Subject:   msg.Subject,
+		PlainBody: msg.PlainBody,
+		HTMLBody:  msg.HTMLBody,
+		Headers:   msg.Headers,
+		CreatedAt: msg.SentAt,
+	})
+}
+
+// startEmailWorkers() starts the pool of email workers, which deliver queued emails
+// until ctx is cancelled. They are tracked by app.wg so that shutdown waits for any
+// delivery in progress to finish.
+func (app *application) startEmailWorkers(ctx context.Context) {
+	for i := range app.config.outbox.workers {
+		app.wg.Add(1)
+		go func() {
+			defer app.wg.Done()
+			app.runEmailWorker(ctx, i)
+		}()
+	}
+	app.logger.Info("email workers started",
+		zap.Int("workers", app.config.outbox.workers),
+		zap.Duration("poll_interval", app.config.outbox.pollInterval))
+}
+
+// runEmailWorker() delivers due emails one at a time, waiting for the poll interval
+// whenever the queue is empty.
+func (app *application) runEmailWorker(ctx context.Context, worker int) {
+	for {
+		if !app.deliverNextEmail() {
+			select {
+			case <-ctx.Done():
+				app.logger.Info("email worker stopped", zap.Int("worker", worker))
+				return
+			case <-time.After(app.config.outbox.pollInterval):
+			}
+			continue
+		}
+		if ctx.Err() != nil {
+			app.logger.Info("email worker stopped", zap.Int("worker", worker))
+			return
+		}
+	}
+}
+
+// deliverNextEmail() claims the next due email and tries to deliver it. A failed
+// delivery is retried with exponential backoff, and dead-lettered once it has used up
+// the maximum number of attempts. It returns false when there was nothing to deliver.
+func (app *application) deliverNextEmail() bool {
+	defer func() {
+		if err := recover(); err != nil {
+			app.logger.Error("email worker panicked", zap.Any("error", err))
+		}
+	}()
+	message, err := app.models.EmailOutbox.Claim(time.Now().Add(data.DefaultEmailOutboxLease))
+	if err != nil {
+		if !errors.Is(err, data.ErrGeneralRecordNotFound) {
+			app.logger.Error("failed to claim queued email", zap.Error(err))
+		}
+		return false
+	}
+	// the message keeps the ID it was rendered with, so a redelivery can be recognised
+	err = app.mailer.Deliver(&mailer.Message{
+		ID:        message.MessageID,
+		To:        message.Recipient,
+		From:      message.Sender,
+		Subject:   message.Subject,
+		PlainBody: message.PlainBody,
+		HTMLBody:  message.HTMLBody,
+		Headers:   message.Headers,
+		SentAt:    message.CreatedAt,
+	})
+	if err == nil {
+		emailOutboxMetrics.Add("sent", 1)
+		err = app.models.EmailOutbox.MarkSent(message.ID)
+		if err != nil {
+			app.logger.Error("failed to mark queued email sent", zap.Int64("outbox_id", message.ID), zap.Error(err))
+		}
+		return true
+	}
+	emailOutboxMetrics.Add("failed_attempts", 1)
+	dead := int(message.Attempts) >= app.config.outbox.maxAttempts
+	nextAttemptAt := time.Now().Add(emailRetryBackoff(int(message.Attempts)))
+	if dead {
+		emailOutboxMetrics.Add("dead", 1)
+		app.logger.Error("email dead-lettered after repeated failures",
+			zap.Int64("outbox_id", message.ID),
+			zap.String("template", message.Template),
+			zap.Int32("attempts", message.Attempts),
+			zap.Error(err))
+	} else {
+		app.logger.Warn("email delivery failed, will retry",
+			zap.Int64("outbox_id", message.ID),
+			zap.Int32("attempts", message.Attempts),
+			zap.Time("next_attempt_at", nextAttemptAt),
+			zap.Error(err))
+	}
+	markErr := app.models.EmailOutbox.MarkFailed(message.ID, err.Error(), nextAttemptAt, dead)
+	if markErr != nil {
+		app.logger.Error("failed to record email delivery failure", zap.Int64("outbox_id", message.ID), zap.Error(markErr))
+	}
+	return true
+}
+
+// emailRetryBackoff() returns how long to wait before retrying an email that has failed
+// the given number of attempts. The wait doubles with each attempt, up to a cap, plus up
+// to 10% of jitter so that messages which failed together are not retried together.
+func emailRetryBackoff(attempts int) time.Duration {
+	wait := data.DefaultEmailOutboxMaxBackoff
+	if attempts < 1 {
+		attempts = 1
+	}
+	if shift := attempts - 1; shift < 16 {
+		wait = min(data.DefaultEmailOutboxBaseBackoff<<shift, data.DefaultEmailOutboxMaxBackoff)
+	}
+	return wait + rand.N(wait/10+1)
+}
+
+// listEmailOutboxHandler() returns a page of queued emails for operators, filtered by
+// status and recipient, along with the number of emails in each status. Email bodies
+// are never included.
+func (app *application) listEmailOutboxHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.EmailOutboxFilters
+		data.Filters
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+	input.Status = app.readString(qs, "status", "")
+	input.Recipient = app.readString(qs, "recipient", "")
+	input.Page = app.readInt(qs, "page", 1, v)
+	input.PageSize = app.readInt(qs, "page_size", data.DefaultPageSize, v)
+	data.ValidateEmailOutboxFilters(v, input.EmailOutboxFilters)
+	data.ValidateFilters(v, input.Filters)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	messages, metadata, err := app.models.EmailOutbox.GetAll(input.EmailOutboxFilters, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	counts, err := app.models.EmailOutbox.CountByStatus()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"emails": messages, "status_counts": counts, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showEmailOutboxMessageHandler() returns a single queued email, including the error
+// from its last failed attempt.
+func (app *application) showEmailOutboxMessageHandler(w http.ResponseWriter, r *http.Request) {
+	message, ok := app.readEmailOutboxParam(w, r)
+	if !ok {
+		return
+	}
+	err := app.writeJSON(w, http.StatusOK, envelope{"email": message}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// retryEmailOutboxMessageHandler() puts a dead-lettered email back in the queue with a
+// fresh set of attempts. Emails in any other status are refused with a 409 Conflict.
+func (app *application) retryEmailOutboxMessageHandler(w http.ResponseWriter, r *http.Request) {
+	message, ok := app.readEmailOutboxParam(w, r)
+	if !ok {
+		return
+	}
+	retried, err := app.models.EmailOutbox.Retry(message.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !retried {
+		app.emailNotRetryableResponse(w, r)
+		return
+	}
+	app.logger.Info("dead email requeued", zap.Int64("outbox_id", message.ID), zap.Int64("operator_id", app.contextGetUser(r).ID))
+	err = app.writeJSON(w, http.StatusAccepted, envelope{"message": "the email has been queued for delivery"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// retryDeadEmailOutboxHandler() puts every dead-lettered email back in the queue, for
+// use once the cause of a mail outage has been fixed.
+func (app *application) retryDeadEmailOutboxHandler(w http.ResponseWriter, r *http.Request) {
+	retried, err := app.models.EmailOutbox.RetryAllDead()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.logger.Info("dead emails requeued", zap.Int64("count", retried), zap.Int64("operator_id", app.contextGetUser(r).ID))
+	err = app.writeJSON(w, http.StatusAccepted, envelope{"retried": retried}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readEmailOutboxParam() loads the queued email named by the "id" URL parameter, writing
+// a 404 and returning false if there is no such email.
+func (app *application) readEmailOutboxParam(w http.ResponseWriter, r *http.Request) (*data.EmailOutboxMessage, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+	message, err := app.models.EmailOutbox.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrGeneralRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+	return message, true
+}
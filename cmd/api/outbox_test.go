@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Blue-Davinci/musical-zoe/internal/data"
+)
+
+func TestEmailRetryBackoff(t *testing.T) {
+	tests := []struct {
+		name     string
+		attempts int
+		expected time.Duration
+	}{
+		{
+			name:     "first failure",
+			attempts: 1,
+			expected: data.DefaultEmailOutboxBaseBackoff,
+		},
+		{
+			name:     "doubles each attempt",
+			attempts: 3,
+			expected: 4 * data.DefaultEmailOutboxBaseBackoff,
+		},
+		{
+			name:     "capped",
+			attempts: 12,
+			expected: data.DefaultEmailOutboxMaxBackoff,
+		},
+		{
+			name:     "very large attempt count",
+			attempts: 100,
+			expected: data.DefaultEmailOutboxMaxBackoff,
+		},
+		{
+			name:     "zero attempts treated as one",
+			attempts: 0,
+			expected: data.DefaultEmailOutboxBaseBackoff,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for range 20 {
+				got := emailRetryBackoff(tt.attempts)
+				if got < tt.expected || got > tt.expected+tt.expected/10 {
+					t.Fatalf("expected a backoff between %s and %s, got %s",
+						tt.expected, tt.expected+tt.expected/10, got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Blue-Davinci/musical-zoe/internal/data"
+	"github.com/Blue-Davinci/musical-zoe/internal/validator"
+	"github.com/tomasen/realip"
+	"go.uber.org/zap"
+)
+
+// getCurrentUserHandler() returns the profile of the authenticated user. The current
+// version is also sent as an ETag so it can be echoed back in an If-Match header.
+func (app *application) getCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	headers := make(http.Header)
+	headers.Set("ETag", fmt.Sprintf(`"%d"`, user.Version))
+	err := app.writeJSON(w, http.StatusOK, envelope{"user": user.Profile()}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateCurrentUserHandler() partially updates the authenticated user's name, locale
+// and/or password. The client must send an If-Match header, otherwise a 428 Precondition
+// Required is returned, and it must match the user's current version, otherwise a 409
+// Conflict is returned. The version check is repeated in the database so that concurrent
+// updates can never silently overwrite each other. Changing the password requires the
+// current password, wrong guesses of which count towards the login lockout, and signs out
+// all other sessions.
+func (app *application) updateCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	// check the expected version before doing any work
+	expectedVersion, ok, err := app.readIfMatchVersion(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if !ok {
+		app.preconditionRequiredResponse(w, r)
+		return
+	}
+	if expectedVersion != user.Version {
+		app.editConflictResponse(w, r)
+		return
+	}
+	var input struct {
+		Name            *string `json:"name"`
+		Locale          *string `json:"locale"`
+		Password        *string `json:"password"`
+		CurrentPassword *string `json:"current_password"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if input.Name != nil {
+		user.Name = *input.Name
+		data.ValidateName(v, user.Name)
+	}
+	if input.Locale != nil {
+		user.Locale = app.validateLocale(v, *input.Locale)
+	}
+	passwordChanged := false
+	if input.Password != nil {
+		data.ValidatePasswordPlaintext(v, *input.Password)
+		app.validatePasswordPolicy(r, v, *input.Password, user.Name, user.Email)
+		v.Check(input.CurrentPassword != nil && *input.CurrentPassword != "", "current_password", "must be provided to change your password")
+		if !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+		// confirm the user knows their current password, throttled like a login so that a
+		// stolen session can't be used to guess it
+		ipAddress := realip.FromRequest(r)
+		if app.loginThrottledResponse(w, r, user.Email, ipAddress) {
+			return
+		}
+		match, err := user.Password.Matches(*input.CurrentPassword)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if !match {
+			app.failedReconfirmationResponse(w, r, user, ipAddress, "invalid current password", func(w http.ResponseWriter, r *http.Request) {
+				v.AddError("current_password", "is incorrect")
+				app.failedValidationResponse(w, r, v.Errors)
+			})
+			return
+		}
+		err = user.Password.Set(*input.Password)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		passwordChanged = true
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Users.UpdateUser(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrGeneralEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if passwordChanged {
+		app.recordAuditEvent(r, data.AuditEventPasswordChange, user.ID, user.Email, map[string]any{"reason": "profile update"})
+		// sign out every other session but keep the caller logged in
+		token, _ := app.readBearerToken(r)
+		for _, scope := range []string{data.ScopeAuthentication, data.ScopeRefresh} {
+			err = app.models.Tokens.DeleteAllForUserExcept(scope, user.ID, token)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+		}
+		emailData := map[string]any{
+			"loginURL": app.config.url.authenticationURL,
+			"userName": user.Name,
+		}
+		err := app.sendEmail(user.Email, "user_password_change.tmpl", user.Locale, emailData)
+		if err != nil {
+			app.logger.Error("failed to send password change email", zap.String("email", user.Email), zap.Error(err))
+		}
+	}
+	headers := make(http.Header)
+	headers.Set("ETag", fmt.Sprintf(`"%d"`, user.Version))
+	err = app.writeJSON(w, http.StatusOK, envelope{"user": user.Profile()}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// exportCurrentUserHandler() returns a JSON archive of everything we hold about the
+// authenticated user, served as a downloadable attachment. That includes their security
+// events, the devices they have logged in from and any contact messages sent from their
+// email address. Secrets such as the password hash, the MFA secret and token hashes are
+// never included.
+func (app *application) exportCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	token, _ := app.readBearerToken(r)
+	sessions, err := app.models.Tokens.GetSessionsForUser(user.ID, token)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	recoveryCodes, err := app.models.Tokens.CountForUser(data.ScopeRecovery, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	apiKeys, err := app.models.ApiKeys.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	identities, err := app.models.Identities.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	digest, err := app.models.Digests.Get(user.ID)
+	if err != nil && !errors.Is(err, data.ErrGeneralRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	securityEvents, err := app.models.AuditEvents.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	knownDevices, err := app.models.KnownDevices.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	contactMessages, err := app.models.Contact.GetAllForEmail(user.Email)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	export := envelope{
+		"exported_at": time.Now().UTC(),
+		"user":        user.Profile(),
+		"security": envelope{
+			"mfa_enabled":              user.MFAEnabled,
+			"recovery_codes_remaining": recoveryCodes,
+		},
+		"sessions":         sessions,
+		"known_devices":    knownDevices,
+		"security_events":  securityEvents,
+		"api_keys":         apiKeys,
+		"identities":       identities,
+		"digest":           digest,
+		"contact_messages": contactMessages,
+	}
+	headers := make(http.Header)
+	headers.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="musicalzoe-export-%d.json"`, user.ID))
+	err = app.writeJSON(w, http.StatusOK, envelope{"export": export}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteCurrentUserHandler() permanently deletes the authenticated user's account. The
+// password must be re-confirmed, as well as a TOTP code for users with MFA enabled, and
+// wrong ones count towards the login lockout. Deleting the user also removes every token
+// they hold, signing out all sessions.
+func (app *application) deleteCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Password string `json:"password"`
+		Code     string `json:"code"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	user := app.contextGetUser(r)
+	v := validator.New()
+	v.Check(input.Password != "", "password", "must be provided")
+	if user.MFAEnabled {
+		data.ValidateTOTPCode(v, input.Code)
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	// throttled like a login so that a stolen session can't be used to guess them
+	ipAddress := realip.FromRequest(r)
+	if app.loginThrottledResponse(w, r, user.Email, ipAddress) {
+		return
+	}
+	match, err := user.Password.Matches(input.Password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !match {
+		app.failedReconfirmationResponse(w, r, user, ipAddress, "invalid password", app.invalidCredentialsResponse)
+		return
+	}
+	if user.MFAEnabled {
+		ok, err := app.verifyTOTP(user, input.Code)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if !ok {
+			app.failedReconfirmationResponse(w, r, user, ipAddress, "invalid mfa code", app.invalidMFACodeResponse)
+			return
+		}
+	}
+	err = app.deleteAccount(r, user, map[string]any{"reason": "deleted by the user"})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrGeneralRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	emailData := map[string]any{
+		"userName": user.Name,
+	}
+	err = app.sendEmail(user.Email, "user_account_deleted.tmpl", user.Locale, emailData)
+	if err != nil {
+		app.logger.Error("failed to send account deletion email", zap.String("email", user.Email), zap.Error(err))
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "your account and all associated data have been deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteAccount() deletes a user and, through the foreign keys, all of their data. The
+// deletion is audited first, and then the email, IP address and user-agent of every audit
+// event for the user are blanked, that one included, together with the deletion.
+func (app *application) deleteAccount(r *http.Request, user *data.User, metadata map[string]any) error {
+	app.recordAuditEvent(r, data.AuditEventAccountDelete, user.ID, user.Email, metadata)
+	return app.models.Users.DeleteUser(user.ID, user.Email)
+}
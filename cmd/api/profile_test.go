@@ -0,0 +1,264 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/pquerna/otp/totp"
+)
+
+func TestDeleteCurrentUserHandler(t *testing.T) {
+	user := testUser{ID: 7, Name: "Zoe", Email: "zoe@example.com", Password: "pa55word1234", Activated: true, Version: 1}
+	withMFA := testUser{ID: 7, Name: "Zoe", Email: "zoe@example.com", Password: "pa55word1234", Activated: true, MFASecret: testMFASecret, Version: 1}
+	wrongCode := "000000"
+	if validCode, _ := totp.GenerateCode(testMFASecret, time.Now()); wrongCode == validCode {
+		wrongCode = "111111"
+	}
+
+	tests := []struct {
+		name           string
+		user           testUser
+		password       string
+		code           string
+		expect         func(mock sqlmock.Sqlmock)
+		expectedStatus int
+	}{
+		{
+			name:     "audits the deletion and anonymises the user's events",
+			user:     user,
+			password: "pa55word1234",
+			expect: func(mock sqlmock.Sqlmock) {
+				expectLoginNotThrottled(mock)
+				mock.ExpectQuery(query("InsertAuditEvent")).WithArgs(int64(7), "zoe@example.com", "account.delete", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(1, time.Now()))
+				mock.ExpectExec(query("DeleteUser")).WithArgs(int64(7), "zoe@example.com").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery(query("InsertEmailOutboxMessage")).WillReturnRows(sqlmock.NewRows([]string{"id", "status", "next_attempt_at", "updated_at"}).AddRow(1, "pending", time.Now(), time.Now()))
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:     "a failed deletion leaves the audit trail as it was",
+			user:     user,
+			password: "pa55word1234",
+			expect: func(mock sqlmock.Sqlmock) {
+				expectLoginNotThrottled(mock)
+				mock.ExpectQuery(query("InsertAuditEvent")).WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(1, time.Now()))
+				// the events are only blanked by the statement that deletes the user
+				mock.ExpectExec(query("DeleteUser") + `(?s).*UPDATE audit_events.*DELETE FROM users`).WillReturnError(errors.New("connection reset"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			name:     "wrong password deletes nothing and counts as a failed login",
+			user:     user,
+			password: "wrong-password",
+			expect: func(mock sqlmock.Sqlmock) {
+				expectLoginNotThrottled(mock)
+				expectLoginFailure(mock, 1)
+			},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:     "wrong mfa code deletes nothing and counts as a failed login",
+			user:     withMFA,
+			password: "pa55word1234",
+			code:     wrongCode,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectLoginNotThrottled(mock)
+				expectLoginFailure(mock, 1)
+			},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:     "wrong passwords lock the account",
+			user:     user,
+			password: "wrong-password",
+			expect: func(mock sqlmock.Sqlmock) {
+				expectLoginNotThrottled(mock)
+				expectLoginFailure(mock, 5)
+				mock.ExpectExec(query("UpsertLoginLockout")).WillReturnResult(sqlmock.NewResult(0, 1))
+				expectEmailQueued(mock)
+			},
+			expectedStatus: http.StatusLocked,
+		},
+		{
+			name:     "locked account is refused before the password is checked",
+			user:     user,
+			password: "pa55word1234",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(query("GetLoginLockout")).WillReturnRows(sqlmock.NewRows([]string{"locked_until"}).AddRow(time.Now().Add(time.Minute)))
+			},
+			expectedStatus: http.StatusLocked,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, mock := newTestApplication(t)
+			u := tt.user.load(t, app, mock)
+			tt.expect(mock)
+			r := newJSONRequest(t, http.MethodDelete, "/v1/api/me", map[string]string{"password": tt.password, "code": tt.code})
+			rr := httptest.NewRecorder()
+			app.deleteCurrentUserHandler(rr, app.contextSetUser(r, u))
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestExportCurrentUserHandler(t *testing.T) {
+	user := testUser{ID: 7, Name: "Zoe", Email: "zoe@example.com", Password: "pa55word1234", Activated: true, Version: 1}
+	app, mock := newTestApplication(t)
+	u := user.load(t, app, mock)
+	now := time.Now()
+	empty := sqlmock.NewRows([]string{"id"})
+
+	mock.ExpectQuery(query("GetSessionsForUser")).WillReturnRows(empty)
+	mock.ExpectQuery(query("CountApiKeysForUser")).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery(query("GetPersonalApiKeysForUser")).WillReturnRows(empty)
+	mock.ExpectQuery(query("GetUserIdentitiesForUser")).WillReturnRows(empty)
+	mock.ExpectQuery(query("GetDigestSubscription")).WillReturnRows(empty)
+	mock.ExpectQuery(query("GetAuditEventsForUser")).WithArgs(int64(7)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "email", "event_type", "ip_address", "user_agent", "request_id", "metadata", "created_at"}).
+			AddRow(1, 7, "zoe@example.com", "login.success", "203.0.113.7", "Mozilla/5.0", "req-1", []byte(`{}`), now))
+	mock.ExpectQuery(query("GetKnownDevicesForUser")).WithArgs(int64(7)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "fingerprint", "ip_address", "user_agent", "first_seen_at", "last_seen_at", "revoked"}).
+			AddRow(1, 7, []byte("fingerprint"), "203.0.113.7", "Mozilla/5.0", now, now, false))
+	mock.ExpectQuery(query("GetContactMessagesForEmail")).WithArgs("zoe@example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "email", "subject", "message", "ip_address", "user_agent", "resolved_at", "resolved_by", "created_at"}).
+			AddRow(1, "Zoe", "zoe@example.com", "Hello", "A question", "203.0.113.7", "Mozilla/5.0", nil, nil, now))
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/api/me/export", nil)
+	rr := httptest.NewRecorder()
+	app.exportCurrentUserHandler(rr, app.contextSetUser(r, u))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	var response struct {
+		Export struct {
+			SecurityEvents  []map[string]any `json:"security_events"`
+			KnownDevices    []map[string]any `json:"known_devices"`
+			ContactMessages []map[string]any `json:"contact_messages"`
+		} `json:"export"`
+	}
+	err := json.Unmarshal(rr.Body.Bytes(), &response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Export.SecurityEvents) != 1 || response.Export.SecurityEvents[0]["event_type"] != "login.success" {
+		t.Errorf("expected the user's security events, got %v", response.Export.SecurityEvents)
+	}
+	if len(response.Export.KnownDevices) != 1 || response.Export.KnownDevices[0]["ip_address"] != "203.0.113.7" {
+		t.Fatalf("expected the user's known devices, got %v", response.Export.KnownDevices)
+	}
+	if _, ok := response.Export.KnownDevices[0]["fingerprint"]; ok {
+		t.Error("expected the device fingerprint to be left out")
+	}
+	if len(response.Export.ContactMessages) != 1 || response.Export.ContactMessages[0]["subject"] != "Hello" {
+		t.Errorf("expected the user's contact messages, got %v", response.Export.ContactMessages)
+	}
+}
+
+func TestUpdateCurrentUserHandler(t *testing.T) {
+	user := testUser{ID: 7, Name: "Zoe", Email: "zoe@example.com", Password: "pa55word1234", Activated: true, Version: 3}
+	passwordChange := map[string]string{"password": "violet-Harbour-sketch-42", "current_password": "wrong-password"}
+
+	tests := []struct {
+		name           string
+		ifMatch        string
+		body           map[string]string
+		expect         func(mock sqlmock.Sqlmock)
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "missing If-Match",
+			body:           map[string]string{"name": "Zoe B"},
+			expect:         func(mock sqlmock.Sqlmock) {},
+			expectedStatus: http.StatusPreconditionRequired,
+			expectedBody:   "If-Match",
+		},
+		{
+			name:           "stale If-Match",
+			ifMatch:        `"2"`,
+			body:           map[string]string{"name": "Zoe B"},
+			expect:         func(mock sqlmock.Sqlmock) {},
+			expectedStatus: http.StatusConflict,
+			expectedBody:   "edit conflict",
+		},
+		{
+			name:    "current If-Match",
+			ifMatch: `"3"`,
+			body:    map[string]string{"name": "Zoe B"},
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(query("UpdateUser")).WillReturnRows(sqlmock.NewRows([]string{"version", "updated_at"}).AddRow(4, time.Now()))
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   "Zoe B",
+		},
+		{
+			name:    "wrong current password counts as a failed login",
+			ifMatch: `"3"`,
+			body:    passwordChange,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectLoginNotThrottled(mock)
+				expectLoginFailure(mock, 1)
+			},
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedBody:   "is incorrect",
+		},
+		{
+			name:    "wrong current passwords lock the account",
+			ifMatch: `"3"`,
+			body:    passwordChange,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectLoginNotThrottled(mock)
+				expectLoginFailure(mock, 5)
+				mock.ExpectExec(query("UpsertLoginLockout")).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery(query("InsertEmailOutboxMessage")).WillReturnRows(sqlmock.NewRows([]string{"id", "status", "next_attempt_at", "updated_at"}).AddRow(1, "pending", time.Now(), time.Now()))
+			},
+			expectedStatus: http.StatusLocked,
+			expectedBody:   "temporarily locked",
+		},
+		{
+			name:    "locked account is refused before the password is checked",
+			ifMatch: `"3"`,
+			body:    passwordChange,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(query("GetLoginLockout")).WillReturnRows(sqlmock.NewRows([]string{"locked_until"}).AddRow(time.Now().Add(time.Minute)))
+			},
+			expectedStatus: http.StatusLocked,
+			expectedBody:   "temporarily locked",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, mock := newTestApplication(t)
+			u := user.load(t, app, mock)
+			tt.expect(mock)
+			r := newJSONRequest(t, http.MethodPatch, "/v1/api/me", tt.body)
+			if tt.ifMatch != "" {
+				r.Header.Set("If-Match", tt.ifMatch)
+			}
+			rr := httptest.NewRecorder()
+			app.updateCurrentUserHandler(rr, app.contextSetUser(r, u))
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if !strings.Contains(rr.Body.String(), tt.expectedBody) {
+				t.Errorf("expected body to contain %q, got %s", tt.expectedBody, rr.Body.String())
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"expvar"
 	"net/http"
 
+	"github.com/Blue-Davinci/musical-zoe/internal/data"
 	"github.com/go-chi/chi"
 	"github.com/go-chi/cors"
 	"github.com/justinas/alice"
@@ -14,13 +15,13 @@ func (app *application) routes() http.Handler {
 	router.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   app.config.cors.trustedOrigins,
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "PATCH"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"link"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "If-Match", "X-API-Key", "X-Request-ID"},
+		ExposedHeaders:   []string{"link", "ETag", "X-Request-ID"},
 		AllowCredentials: false,
 		MaxAge:           300, // Maximum value not ignored by any of major browsers
 	}))
 	//Use alice to make a global middleware chain.
-	globalMiddleware := alice.New(app.metrics, app.recoverPanic, app.authenticate).Then
+	globalMiddleware := alice.New(app.requestID, app.metrics, app.recoverPanic, app.authenticate).Then
 	// Dynamic Middleware, these will apply to only select routes
 	dynamicMiddleware := alice.New(app.requireAuthenticatedUser, app.requireActivatedUser)
 
@@ -30,8 +31,13 @@ func (app *application) routes() http.Handler {
 	// Make our categorized routes
 	v1Router := chi.NewRouter()
 
-	v1Router.Mount("/", app.generalRoutes())
-	v1Router.Mount("/api", app.userRoutes())
+	v1Router.Mount("/", app.generalRoutes(&dynamicMiddleware))
+	v1Router.Mount("/api", app.userRoutes(&dynamicMiddleware))
+	v1Router.Mount("/admin", app.adminRoutes(&dynamicMiddleware))
+	// Development helpers are never exposed in other environments
+	if app.config.env == "development" {
+		v1Router.Mount("/dev", app.devRoutes())
+	}
 
 	// MUsic
 	v1Router.Mount("/musical", app.musicalRoutes(&dynamicMiddleware))
@@ -44,36 +50,123 @@ func (app *application) routes() http.Handler {
 // generalRoutes() provides a router for the general routes.
 // Mounted rirectly after our version url. They contaon sanity and
 // health checks. Probably add other AOB's here.
-func (app *application) generalRoutes() chi.Router {
+func (app *application) generalRoutes(dynamicMiddleware *alice.Chain) chi.Router {
 	generalRoutes := chi.NewRouter()
-	// /debug/vars : for expvar, wrapping it in a handler func for assertion otherwise it complains
-	generalRoutes.Get("/debug/vars", func(w http.ResponseWriter, r *http.Request) {
-		expvar.Handler().ServeHTTP(w, r)
-	})
+	// /debug/vars : for expvar, restricted to users holding the metrics:read permission
+	generalRoutes.With(dynamicMiddleware.Append(app.requirePermission(data.PermissionMetricsRead)).Then).Get("/debug/vars", expvar.Handler().ServeHTTP)
 	generalRoutes.Get("/health", app.healthcheckHandler)
+	// /contact : the public contact and support form
+	generalRoutes.Post("/contact", app.createContactMessageHandler)
 	return generalRoutes
 }
 
 // userRoutes() is a method that returns a chi.Router that contains all the routes for the users
-func (app *application) userRoutes() chi.Router {
+func (app *application) userRoutes(dynamicMiddleware *alice.Chain) chi.Router {
 	userRoutes := chi.NewRouter()
 	userRoutes.Post("/", app.registerUserHandler)
 	userRoutes.Post("/authentication", app.createAuthenticationApiKeyHandler)
+	// DELETE /authentication : logs out by revoking the current bearer token
+	userRoutes.With(app.requireAuthenticatedUser).Delete("/authentication", app.deleteAuthenticationApiKeyHandler)
+	// /authentication/refresh : rotate a refresh token for a new access token
+	userRoutes.Post("/authentication/refresh", app.createRefreshedAuthenticationApiKeyHandler)
+	// /authentication/magic-link : passwordless login via a single-use emailed link
+	userRoutes.Post("/authentication/magic-link", app.createMagicLinkTokenHandler)
+	userRoutes.Put("/authentication/magic-link", app.redeemMagicLinkTokenHandler)
+	// /authentication/oidc : sign in through a configured OpenID Connect provider
+	userRoutes.Get("/authentication/oidc", app.getOIDCProvidersHandler)
+	userRoutes.Get("/authentication/oidc/{provider}", app.beginOIDCLoginHandler)
+	userRoutes.Get("/authentication/oidc/{provider}/callback", app.completeOIDCLoginHandler)
+	// /authentication/mfa : second login step for users with MFA enabled
+	userRoutes.Post("/authentication/mfa", app.createMFAAuthenticationApiKeyHandler)
+	// /authentication/recovery : second login step using a single-use recovery code
+	userRoutes.Post("/authentication/recovery", app.createRecoveryAuthenticationApiKeyHandler)
 	// /activation : for activating accounts
 	userRoutes.Put("/activated", app.activateUserHandler)
+	// /activation/resend : for requesting a new activation email
+	userRoutes.Post("/activation/resend", app.resendActivationTokenHandler)
+	// /password-reset : for requesting a password reset token
+	userRoutes.Post("/password-reset", app.createPasswordResetTokenHandler)
+	// /password : for setting a new password using a password reset token
+	userRoutes.Put("/password", app.updateUserPasswordHandler)
+	// /mfa : TOTP multi-factor authentication enrollment
+	userRoutes.With(dynamicMiddleware.Then).Post("/mfa/setup", app.setupMFAHandler)
+	userRoutes.With(dynamicMiddleware.Then).Post("/mfa/verify", app.verifyMFAHandler)
+	// /mfa/recovery-codes : view the remaining recovery codes or regenerate the set
+	userRoutes.With(dynamicMiddleware.Then).Get("/mfa/recovery-codes", app.getRecoveryCodesHandler)
+	userRoutes.With(dynamicMiddleware.Then).Post("/mfa/recovery-codes", app.regenerateRecoveryCodesHandler)
+	// /me : view and update the authenticated user's profile
+	userRoutes.With(app.requireAuthenticatedUser).Get("/me", app.getCurrentUserHandler)
+	userRoutes.With(app.requireAuthenticatedUser).Patch("/me", app.updateCurrentUserHandler)
+	userRoutes.With(app.requireAuthenticatedUser).Delete("/me", app.deleteCurrentUserHandler)
+	// /me/export : download a copy of all of the user's data
+	userRoutes.With(app.requireAuthenticatedUser).Get("/me/export", app.exportCurrentUserHandler)
+	// /me/security-events : the user's own security audit history
+	userRoutes.With(app.requireAuthenticatedUser).Get("/me/security-events", app.getSecurityEventsHandler)
+	// /me/identities : list and unlink the user's identity provider accounts
+	userRoutes.With(app.requireAuthenticatedUser).Get("/me/identities", app.getUserIdentitiesHandler)
+	userRoutes.With(app.requireAuthenticatedUser).Delete("/me/identities/{id}", app.deleteUserIdentityHandler)
+	// /me/digest : the user's weekly digest subscription
+	userRoutes.With(dynamicMiddleware.Then).Get("/me/digest", app.getDigestSubscriptionHandler)
+	userRoutes.With(dynamicMiddleware.Then).Put("/me/digest", app.updateDigestSubscriptionHandler)
+	userRoutes.With(dynamicMiddleware.Then).Delete("/me/digest", app.deleteDigestSubscriptionHandler)
+	// /digest/unsubscribe : confirmation page and one-click unsubscribe from a digest email
+	userRoutes.Get("/digest/unsubscribe", app.getDigestUnsubscribeHandler)
+	userRoutes.Post("/digest/unsubscribe", app.unsubscribeDigestHandler)
+	// /me/email : change the user's email address once the new one is confirmed
+	userRoutes.With(dynamicMiddleware.Then).Post("/me/email", app.requestEmailChangeHandler)
+	userRoutes.Put("/me/email", app.confirmEmailChangeHandler)
+	userRoutes.Put("/me/email/cancel", app.cancelEmailChangeHandler)
+	// /sessions : list and revoke the user's active bearer tokens
+	userRoutes.With(app.requireAuthenticatedUser).Get("/sessions", app.getUserSessionsHandler)
+	userRoutes.With(app.requireAuthenticatedUser).Delete("/sessions/{id}", app.deleteUserSessionHandler)
+	// /sessions/revoke : "this wasn't me" link from a new device alert, signs out everywhere
+	userRoutes.Put("/sessions/revoke", app.revokeSessionsHandler)
+	// /keys : manage long-lived personal API keys for server-to-server clients
+	userRoutes.With(dynamicMiddleware.Then).Post("/keys", app.createPersonalApiKeyHandler)
+	userRoutes.With(dynamicMiddleware.Then).Get("/keys", app.getPersonalApiKeysHandler)
+	userRoutes.With(dynamicMiddleware.Then).Get("/keys/{id}", app.getPersonalApiKeyHandler)
+	userRoutes.With(dynamicMiddleware.Then).Patch("/keys/{id}", app.updatePersonalApiKeyHandler)
+	userRoutes.With(dynamicMiddleware.Then).Delete("/keys/{id}", app.deletePersonalApiKeyHandler)
 	return userRoutes
 }
 
+// adminRoutes() provides the operator endpoints. Reads need the admin:read permission
+// and changes need admin:write.
+func (app *application) adminRoutes(dynamicMiddleware *alice.Chain) chi.Router {
+	adminRoutes := chi.NewRouter()
+	adminRead := dynamicMiddleware.Append(app.requirePermission(data.PermissionAdminRead)).Then
+	adminWrite := dynamicMiddleware.Append(app.requirePermission(data.PermissionAdminWrite)).Then
+	// /users : search, inspect and manage user accounts
+	adminRoutes.With(adminRead).Get("/users", app.listUsersHandler)
+	adminRoutes.With(adminRead).Get("/users/{id}", app.showUserHandler)
+	adminRoutes.With(adminWrite).Patch("/users/{id}", app.updateUserActivationHandler)
+	adminRoutes.With(adminWrite).Delete("/users/{id}", app.deleteUserHandler)
+	adminRoutes.With(adminWrite).Post("/users/{id}/password-reset", app.forcePasswordResetHandler)
+	adminRoutes.With(adminWrite).Delete("/users/{id}/tokens", app.revokeUserTokensHandler)
+	// /security-events : query the security audit log across all users
+	adminRoutes.With(adminRead).Get("/security-events", app.listSecurityEventsHandler)
+	// /contact-messages : review contact form messages and mark them resolved
+	adminRoutes.With(adminRead).Get("/contact-messages", app.listContactMessagesHandler)
+	adminRoutes.With(adminWrite).Patch("/contact-messages/{id}", app.updateContactMessageHandler)
+	// /email-outbox : inspect the email queue and retry dead-lettered emails
+	adminRoutes.With(adminRead).Get("/email-outbox", app.listEmailOutboxHandler)
+	adminRoutes.With(adminRead).Get("/email-outbox/{id}", app.showEmailOutboxMessageHandler)
+	adminRoutes.With(adminWrite).Post("/email-outbox/{id}/retry", app.retryEmailOutboxMessageHandler)
+	adminRoutes.With(adminWrite).Post("/email-outbox/retry", app.retryDeadEmailOutboxHandler)
+	return adminRoutes
+}
+
 func (app *application) musicalRoutes(dynamicMiddleware *alice.Chain) chi.Router {
 	musicalRoutes := chi.NewRouter()
+	// These routes also accept personal API keys holding the matching scope.
 	// /musicalnews : for fetching all musical news
-	musicalRoutes.With(dynamicMiddleware.Then).Get("/news", app.getAllMusicalNews)
+	musicalRoutes.With(app.requireApiKeyScope(data.ApiKeyScopeNewsRead), dynamicMiddleware.Then).Get("/news", app.getAllMusicalNews)
 	// /trends : for fetching music trends from Last.fm
-	musicalRoutes.With(dynamicMiddleware.Then).Get("/trends", app.getAllMusicTrends)
+	musicalRoutes.With(app.requireApiKeyScope(data.ApiKeyScopeTrendsRead), dynamicMiddleware.Then).Get("/trends", app.getAllMusicTrends)
 	// /lyrics : for fetching song lyrics
-	musicalRoutes.With(dynamicMiddleware.Then).Get("/lyrics", app.getLyrics)
+	musicalRoutes.With(app.requireApiKeyScope(data.ApiKeyScopeLyricsRead), dynamicMiddleware.Then).Get("/lyrics", app.getLyrics)
 	// /track-info : for fetching detailed track information and metadata
-	musicalRoutes.With(dynamicMiddleware.Then).Get("/track-info", app.getTrackInfo)
+	musicalRoutes.With(app.requireApiKeyScope(data.ApiKeyScopeTrackInfoRead), dynamicMiddleware.Then).Get("/track-info", app.getTrackInfo)
 	return musicalRoutes
 
 }
@@ -1,20 +1,29 @@
 package main
 
 import (
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
+	"github.com/Blue-Davinci/musical-zoe/internal/mailer"
+	"github.com/Blue-Davinci/musical-zoe/internal/sso"
 	"go.uber.org/zap"
 )
 
 func TestRoutes(t *testing.T) {
+	// No identity providers are configured for the tests
+	providers, err := sso.New("", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
 	// Create a test application
 	app := &application{
 		config: config{
 			env: "test",
 		},
 		logger: zap.NewNop(),
+		sso:    providers,
 	}
 
 	// Test cases for route accessibility
@@ -32,6 +41,13 @@ func TestRoutes(t *testing.T) {
 			expectedStatus: http.StatusOK,
 			requiresAuth:   false,
 		},
+		{
+			name:           "metrics without auth",
+			method:         "GET",
+			path:           "/v1/debug/vars",
+			expectedStatus: http.StatusUnauthorized,
+			requiresAuth:   true,
+		},
 		{
 			name:           "music news without auth",
 			method:         "GET",
@@ -60,6 +76,125 @@ func TestRoutes(t *testing.T) {
 			expectedStatus: http.StatusUnauthorized,
 			requiresAuth:   true,
 		},
+		{
+			name:           "mfa setup without auth",
+			method:         "POST",
+			path:           "/v1/api/mfa/setup",
+			expectedStatus: http.StatusUnauthorized,
+			requiresAuth:   true,
+		},
+		{
+			name:           "sessions without auth",
+			method:         "GET",
+			path:           "/v1/api/sessions",
+			expectedStatus: http.StatusUnauthorized,
+			requiresAuth:   true,
+		},
+		{
+			name:           "logout without auth",
+			method:         "DELETE",
+			path:           "/v1/api/authentication",
+			expectedStatus: http.StatusUnauthorized,
+			requiresAuth:   true,
+		},
+		{
+			name:           "api keys without auth",
+			method:         "GET",
+			path:           "/v1/api/keys",
+			expectedStatus: http.StatusUnauthorized,
+			requiresAuth:   true,
+		},
+		{
+			name:           "refresh without body",
+			method:         "POST",
+			path:           "/v1/api/authentication/refresh",
+			expectedStatus: http.StatusBadRequest,
+			requiresAuth:   false,
+		},
+		{
+			name:           "revoke sessions without body",
+			method:         "PUT",
+			path:           "/v1/api/sessions/revoke",
+			expectedStatus: http.StatusBadRequest,
+			requiresAuth:   false,
+		},
+		{
+			name:           "contact without body",
+			method:         "POST",
+			path:           "/v1/contact",
+			expectedStatus: http.StatusBadRequest,
+			requiresAuth:   false,
+		},
+		{
+			name:           "admin contact messages without auth",
+			method:         "GET",
+			path:           "/v1/admin/contact-messages",
+			expectedStatus: http.StatusUnauthorized,
+			requiresAuth:   true,
+		},
+		{
+			name:           "dev outbox outside development",
+			method:         "GET",
+			path:           "/v1/dev/outbox",
+			expectedStatus: http.StatusNotFound,
+			requiresAuth:   false,
+		},
+		{
+			name:           "admin email outbox without auth",
+			method:         "GET",
+			path:           "/v1/admin/email-outbox",
+			expectedStatus: http.StatusUnauthorized,
+			requiresAuth:   true,
+		},
+		{
+			name:           "identities without auth",
+			method:         "GET",
+			path:           "/v1/api/me/identities",
+			expectedStatus: http.StatusUnauthorized,
+			requiresAuth:   true,
+		},
+		{
+			name:           "unknown oidc provider",
+			method:         "GET",
+			path:           "/v1/api/authentication/oidc/unknown",
+			expectedStatus: http.StatusNotFound,
+			requiresAuth:   false,
+		},
+		{
+			name:           "admin users without auth",
+			method:         "GET",
+			path:           "/v1/admin/users",
+			expectedStatus: http.StatusUnauthorized,
+			requiresAuth:   true,
+		},
+		{
+			name:           "security events without auth",
+			method:         "GET",
+			path:           "/v1/api/me/security-events",
+			expectedStatus: http.StatusUnauthorized,
+			requiresAuth:   true,
+		},
+		{
+			name:           "admin security events without auth",
+			method:         "GET",
+			path:           "/v1/admin/security-events",
+			expectedStatus: http.StatusUnauthorized,
+			requiresAuth:   true,
+		},
+		{
+			name:           "digest subscription without auth",
+			method:         "GET",
+			path:           "/v1/api/me/digest",
+			expectedStatus: http.StatusUnauthorized,
+			requiresAuth:   true,
+		},
+		{
+			name:           "digest unsubscribe without token",
+			method:         "POST",
+			path:           "/v1/api/digest/unsubscribe",
+			expectedStatus: http.StatusUnprocessableEntity,
+			requiresAuth:   false,
+		},
 		{
 			name:           "non-existent route",
 			method:         "GET",
@@ -92,6 +227,122 @@ func TestRoutes(t *testing.T) {
 	}
 }
 
+func TestRequestID(t *testing.T) {
+	app := &application{logger: zap.NewNop()}
+
+	tests := []struct {
+		name     string
+		header   string
+		expected string
+	}{
+		{name: "generated when missing", header: "", expected: ""},
+		{name: "kept when valid", header: "proxy-1234.abc", expected: "proxy-1234.abc"},
+		{name: "replaced when invalid", header: "bad id\n", expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fromContext string
+			handler := app.requestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fromContext = app.contextGetRequestID(r)
+			}))
+			req := httptest.NewRequest("GET", "/", nil)
+			if tt.header != "" {
+				req.Header.Set(requestIDHeader, tt.header)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			got := rr.Header().Get(requestIDHeader)
+			if got == "" || got != fromContext {
+				t.Fatalf("expected matching request IDs, got header %q and context %q", got, fromContext)
+			}
+			if tt.expected != "" && got != tt.expected {
+				t.Errorf("expected request ID %q, got %q", tt.expected, got)
+			}
+			if tt.expected == "" && got == tt.header {
+				t.Errorf("expected a generated request ID, got %q", got)
+			}
+		})
+	}
+}
+
+func TestOutboxHandler(t *testing.T) {
+	transport := mailer.NewMemoryTransport()
+	app := &application{
+		logger: zap.NewNop(),
+		mailer: mailer.New(transport, "no-reply@musicalzoe.test"),
+	}
+	for _, recipient := range []string{"zoe@example.com", "other@example.com"} {
+		err := app.mailer.Send(recipient, "user_password_change.tmpl", mailer.DefaultLocale, map[string]any{"userName": "Zoe"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/v1/dev/outbox?to=zoe@example.com", nil)
+	rr := httptest.NewRecorder()
+	app.getOutboxHandler(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	var response struct {
+		Messages []mailer.Message `json:"messages"`
+	}
+	err := json.NewDecoder(rr.Body).Decode(&response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Messages) != 1 || response.Messages[0].To != "zoe@example.com" {
+		t.Errorf("expected only the message to zoe@example.com, got %+v", response.Messages)
+	}
+
+	// transports that send emails on keep nothing to show
+	app.mailer = mailer.New(mailer.NewSMTPTransport("localhost", 25, "", ""), "no-reply@musicalzoe.test")
+	rr = httptest.NewRecorder()
+	app.getOutboxHandler(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, got %d", http.StatusNotFound, rr.Code)
+	}
+}
+
+func TestEmailPreviewRoutes(t *testing.T) {
+	app := &application{
+		logger: zap.NewNop(),
+		mailer: mailer.New(mailer.NewMemoryTransport(), "no-reply@musicalzoe.test"),
+	}
+	router := app.devRoutes()
+
+	tests := []struct {
+		name           string
+		path           string
+		expectedStatus int
+		expectedType   string
+	}{
+		{name: "list templates", path: "/emails", expectedStatus: http.StatusOK, expectedType: "application/json"},
+		{name: "html preview", path: "/emails/user_welcome.tmpl", expectedStatus: http.StatusOK, expectedType: "text/html; charset=utf-8"},
+		{name: "text preview", path: "/emails/user_welcome.tmpl?format=text", expectedStatus: http.StatusOK, expectedType: "text/plain; charset=utf-8"},
+		{name: "json preview", path: "/emails/user_welcome.tmpl?format=json", expectedStatus: http.StatusOK, expectedType: "application/json"},
+		{name: "translated preview", path: "/emails/user_welcome.tmpl?locale=fr", expectedStatus: http.StatusOK, expectedType: "text/html; charset=utf-8"},
+		{name: "unknown format", path: "/emails/user_welcome.tmpl?format=pdf", expectedStatus: http.StatusUnprocessableEntity},
+		{name: "unknown locale", path: "/emails/user_welcome.tmpl?locale=xx", expectedStatus: http.StatusUnprocessableEntity},
+		{name: "unknown template", path: "/emails/nope.tmpl", expectedStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest("GET", tt.path, nil))
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if tt.expectedType != "" && rr.Header().Get("Content-Type") != tt.expectedType {
+				t.Errorf("expected content type %q, got %q", tt.expectedType, rr.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
+
 func TestAuthenticationMiddleware(t *testing.T) {
 	t.Skip("Skipping authentication middleware test due to metrics initialization conflict")
 
@@ -22,6 +22,14 @@ func (app *application) server() error {
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 60 * time.Second,
 	}
+	// start the janitor, digest scheduler and email workers, they are stopped before
+	// we wait for background tasks below
+	janitorCtx, stopJanitor := context.WithCancel(context.Background())
+	app.startJanitor(janitorCtx)
+	digestCtx, stopDigestScheduler := context.WithCancel(context.Background())
+	app.startDigestScheduler(digestCtx)
+	workersCtx, stopEmailWorkers := context.WithCancel(context.Background())
+	app.startEmailWorkers(workersCtx)
 	// make a channel to listen for shutdown signals
 	shutdownChan := make(chan error)
 	// start a background routine, this will listen to any shutdown signals
@@ -42,6 +50,9 @@ func (app *application) server() error {
 			shutdownChan <- err
 		}
 		app.logger.Info("completing background tasks...", zap.String("addr", srv.Addr))
+		stopJanitor()
+		stopDigestScheduler()
+		stopEmailWorkers()
 		// wait for any background tasks to complete
 		app.wg.Wait()
 		// Call Shutdown() on our server, passing in the context we just made.
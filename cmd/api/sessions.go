@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Blue-Davinci/musical-zoe/internal/data"
+	"github.com/Blue-Davinci/musical-zoe/internal/validator"
+	"github.com/tomasen/realip"
+	"go.uber.org/zap"
+)
+
+// deleteAuthenticationApiKeyHandler() logs the user out by revoking the bearer token
+// that was used to authenticate the current request, along with its refresh token.
+// Other sessions remain active.
+func (app *application) deleteAuthenticationApiKeyHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	token, err := app.readBearerToken(r)
+	if err != nil {
+		app.invalidAuthenticationTokenResponse(w, r)
+		return
+	}
+	_, err = app.models.Tokens.DeleteForUser(data.ScopeAuthentication, user.ID, token)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.recordAuditEvent(r, data.AuditEventTokenRevoke, user.ID, user.Email, map[string]any{"reason": "logout"})
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "you have been successfully logged out"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createRefreshedAuthenticationApiKeyHandler() exchanges a refresh token for a new
+// access and refresh token pair. Each refresh token can only be used once; presenting
+// a rotated one again revokes the whole login, on the assumption it was stolen.
+func (app *application) createRefreshedAuthenticationApiKeyHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if data.ValidateTokenPlaintext(v, input.RefreshToken); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	token, err := app.models.Tokens.Rotate(input.RefreshToken)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrGeneralRecordNotFound):
+			app.invalidRefreshTokenResponse(w, r)
+		case errors.Is(err, data.ErrRefreshTokenReused):
+			app.logger.Warn("refresh token reuse detected, token family revoked",
+				zap.Int64("user_id", token.UserID),
+				zap.String("ip_address", realip.FromRequest(r)))
+			app.recordAuditEvent(r, data.AuditEventTokenRevoke, token.UserID, "", map[string]any{"reason": "refresh token reuse"})
+			app.invalidRefreshTokenResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	user, err := app.models.Users.GetByID(token.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrGeneralRecordNotFound):
+			app.invalidRefreshTokenResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.createAuthenticationApiKeyResponse(w, r, user, token.FamilyID)
+}
+
+// getUserSessionsHandler() lists all of the user's active sessions, that is the
+// unexpired authentication tokens, along with where and when they were last used.
+func (app *application) getUserSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	// the current token is only used to flag the matching session
+	token, _ := app.readBearerToken(r)
+	sessions, err := app.models.Tokens.GetSessionsForUser(user.ID, token)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"sessions": sessions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteUserSessionHandler() revokes a single session by its ID. Users can only revoke
+// their own sessions; anything else is reported as not found.
+func (app *application) deleteUserSessionHandler(w http.ResponseWriter, r *http.Request) {
+	sessionID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	user := app.contextGetUser(r)
+	err = app.models.Tokens.DeleteSessionForUser(user.ID, sessionID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrGeneralRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.recordAuditEvent(r, data.AuditEventTokenRevoke, user.ID, user.Email, map[string]any{"reason": "session revoked", "session_id": sessionID})
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "session successfully revoked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// revokeAllTokens() removes every token a user could use to act as themselves, see
+// data.RevocableScopes, along with their personal API keys.
+func (app *application) revokeAllTokens(userID int64) error {
+	for _, scope := range data.RevocableScopes {
+		err := app.models.Tokens.DeleteAllForUser(scope, userID)
+		if err != nil {
+			return err
+		}
+	}
+	_, err := app.models.ApiKeys.DeleteAllForUser(userID)
+	return err
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/Blue-Davinci/musical-zoe/internal/data"
+	"github.com/Blue-Davinci/musical-zoe/internal/database"
+	"github.com/Blue-Davinci/musical-zoe/internal/mailer"
+	"github.com/Blue-Davinci/musical-zoe/internal/passwords"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-chi/chi"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// userColumns are the columns every user query returns, in order.
+var userColumns = []string{"id", "name", "email", "password_hash", "activated", "version", "created_at", "updated_at", "mfa_secret", "mfa_enabled", "pending_email", "locale", "suspended"}
+
+// testUser describes a row of the users table for the mocked database.
+type testUser struct {
+	ID           int64
+	Name         string
+	Email        string
+	Password     string
+	Activated    bool
+	MFASecret    string
+	PendingEmail string
+	Version      int32
+	Suspended    bool
+}
+
+// rows() returns the user as the result of a user query. The password is hashed at the
+// lowest bcrypt cost to keep the tests fast.
+func (u testUser) rows(t *testing.T) *sqlmock.Rows {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	return sqlmock.NewRows(userColumns).AddRow(u.ID, u.Name, u.Email, hash, u.Activated, u.Version, now, now, u.MFASecret, u.MFASecret != "", u.PendingEmail, mailer.DefaultLocale, u.Suspended)
+}
+
+// load() returns the user as a *data.User, read through the mocked database, for tests
+// that need to set them as the authenticated user.
+func (u testUser) load(t *testing.T, app *application, mock sqlmock.Sqlmock) *data.User {
+	t.Helper()
+	mock.ExpectQuery(query("GetUserByEmail")).WillReturnRows(u.rows(t))
+	user, err := app.models.Users.GetByEmail(u.Email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// newTestApplication() returns an application backed by a mocked database and an in
+// memory mailer. Expectations that were set on the mock but never met fail the test.
+func newTestApplication(t *testing.T) (*application, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := config{env: "test"}
+	cfg.lockout.threshold = data.DefaultLoginLockoutThreshold
+	cfg.lockout.window = data.DefaultLoginLockoutWindow
+	cfg.lockout.duration = data.DefaultLoginLockoutDuration
+	cfg.lockout.ipThreshold = data.DefaultLoginIPThreshold
+	app := &application{
+		config:    cfg,
+		logger:    zap.NewNop(),
+		models:    data.NewModels(database.New(db)),
+		mailer:    mailer.New(mailer.NewMemoryTransport(), "no-reply@musicalzoe.test"),
+		passwords: passwords.New(passwords.DefaultMinEntropy, ""),
+	}
+	t.Cleanup(func() {
+		app.wg.Wait()
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		db.Close()
+	})
+	return app, mock
+}
+
+// query() matches the sqlc query with the given name.
+func query(name string) string {
+	return regexp.QuoteMeta("-- name: " + name + " ")
+}
+
+// newJSONRequest() returns a request with the given value encoded as its JSON body.
+func newJSONRequest(t *testing.T, method, target string, body any) *http.Request {
+	t.Helper()
+	js, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return httptest.NewRequest(method, target, bytes.NewReader(js))
+}
+
+// withURLParam() sets a chi URL parameter on the request, as the router would.
+func withURLParam(r *http.Request, key, value string) *http.Request {
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add(key, value)
+	return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+}
+
+// expectLoginFailure() expects a failed login to be audited and counted towards the
+// lockout, with failures being the count for the email afterwards.
+func expectLoginFailure(mock sqlmock.Sqlmock, failures int64) {
+	mock.ExpectQuery(query("InsertAuditEvent")).WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(1, time.Now()))
+	mock.ExpectExec(query("InsertLoginFailure")).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(query("CountLoginFailuresForEmail")).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(failures))
+}
+
+// expectLoginNotThrottled() expects the lockout and IP throttling checks made before a
+// login attempt, and lets the attempt go ahead.
+func expectLoginNotThrottled(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(query("GetLoginLockout")).WillReturnRows(sqlmock.NewRows([]string{"locked_until"}))
+	mock.ExpectQuery(query("CountLoginFailuresForIP")).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+}
+
+// expectNewSession() expects a successful login: a new access and refresh token, the
+// failed login count being reset, the login audit event and the new device check, which
+// finds a device the user has used before.
+func expectNewSession(mock sqlmock.Sqlmock) {
+	for range 2 {
+		mock.ExpectQuery(query("InsertApiKey")).WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(1, time.Now()))
+	}
+	mock.ExpectExec(query("DeleteLoginFailuresForEmail")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(query("DeleteLoginLockout")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(query("InsertAuditEvent")).WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(1, time.Now()))
+	mock.ExpectQuery(query("UpsertKnownDevice")).WillReturnRows(sqlmock.NewRows([]string{"id", "inserted", "was_revoked"}).AddRow(1, false, false))
+}
+
+// expectEmailQueued() expects an email to be written to the outbox.
+func expectEmailQueued(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(query("InsertEmailOutboxMessage")).WillReturnRows(sqlmock.NewRows([]string{"id", "status", "next_attempt_at", "updated_at"}).AddRow(1, "pending", time.Now(), time.Now()))
+}
+
+// expectAllTokensRevoked() expects every revocable token scope and the personal API keys
+// of the user to be deleted.
+func expectAllTokensRevoked(mock sqlmock.Sqlmock, userID int64) {
+	for _, scope := range data.RevocableScopes {
+		mock.ExpectExec(query("DeletAllAPIKeysForUser")).WithArgs(scope, userID).WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectExec(query("DeleteAllPersonalApiKeysForUser")).WithArgs(userID).WillReturnResult(sqlmock.NewResult(0, 1))
+}
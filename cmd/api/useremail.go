@@ -0,0 +1,234 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Blue-Davinci/musical-zoe/internal/data"
+	"github.com/Blue-Davinci/musical-zoe/internal/validator"
+	"github.com/tomasen/realip"
+	"go.uber.org/zap"
+)
+
+// requestEmailChangeHandler() starts an email address change for the authenticated
+// user. The new address is stored as pending and sent a confirmation token, while the
+// current address is notified and given a link to cancel the change. Nothing changes
+// for logins until the new address has been confirmed.
+func (app *application) requestEmailChangeHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	user := app.contextGetUser(r)
+	v := validator.New()
+	data.ValidateEmail(v, input.Email)
+	v.Check(input.Password != "", "password", "must be provided")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	// re-confirm the password before touching the address used to recover the account,
+	// throttled like a login so that a stolen session can't be used to guess it
+	ipAddress := realip.FromRequest(r)
+	if app.loginThrottledResponse(w, r, user.Email, ipAddress) {
+		return
+	}
+	match, err := user.Password.Matches(input.Password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !match {
+		app.failedReconfirmationResponse(w, r, user, ipAddress, "invalid password", app.invalidCredentialsResponse)
+		return
+	}
+	// make sure the new address is actually new and not in use
+	_, err = app.models.Users.GetByEmail(input.Email)
+	switch {
+	case err == nil:
+		v.AddError("email", "a user with this email address already exists")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	case !errors.Is(err, data.ErrGeneralRecordNotFound):
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	user.PendingEmail = input.Email
+	err = app.models.Users.UpdateUser(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrGeneralEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	// only the latest request can be confirmed or cancelled
+	err = app.deleteEmailChangeTokens(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	confirmToken, err := app.models.Tokens.New(user.ID, data.DefaultEmailChangeTokenExpiryTime, data.ScopeEmailChange)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	cancelToken, err := app.models.Tokens.New(user.ID, data.DefaultEmailChangeTokenExpiryTime, data.ScopeEmailCancel)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	// the confirmation goes to the new address
+	confirmData := map[string]any{
+		"userName":         user.Name,
+		"newEmail":         user.PendingEmail,
+		"emailChangeURL":   app.config.url.emailChangeURL + confirmToken.Plaintext,
+		"emailChangeToken": confirmToken.Plaintext,
+	}
+	err = app.sendEmail(user.PendingEmail, "user_email_change_confirm.tmpl", user.Locale, confirmData)
+	if err != nil {
+		app.logger.Error("failed to send email change confirmation", zap.String("email", user.PendingEmail), zap.Error(err))
+	}
+	// and the notice, with a way to cancel, goes to the current address
+	noticeData := map[string]any{
+		"userName":         user.Name,
+		"newEmail":         user.PendingEmail,
+		"emailCancelURL":   app.config.url.emailCancelURL + cancelToken.Plaintext,
+		"emailCancelToken": cancelToken.Plaintext,
+	}
+	err = app.sendEmail(user.Email, "user_email_change_notice.tmpl", user.Locale, noticeData)
+	if err != nil {
+		app.logger.Error("failed to send email change notice", zap.String("email", user.Email), zap.Error(err))
+	}
+	err = app.writeJSON(w, http.StatusAccepted, envelope{"user": user.Profile()}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// confirmEmailChangeHandler() completes an email change. The token that was sent to the
+// new address proves ownership of it, at which point the pending email becomes the
+// user's email.
+func (app *application) confirmEmailChangeHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		TokenPlaintext string `json:"token"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if data.ValidateTokenPlaintext(v, input.TokenPlaintext); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	user, err := app.models.Users.GetForToken(data.ScopeEmailChange, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrGeneralRecordNotFound):
+			v.AddError("token", "invalid or expired email change token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if user.PendingEmail == "" {
+		v.AddError("token", "there is no pending email change for this account")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	user.Email = user.PendingEmail
+	user.PendingEmail = ""
+	err = app.models.Users.UpdateUser(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateEmail):
+			v.AddError("email", "a user with this email address already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrGeneralEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.deleteEmailChangeTokens(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"user": user.Profile()}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// cancelEmailChangeHandler() discards a pending email change using the token that was
+// sent to the user's current address.
+func (app *application) cancelEmailChangeHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		TokenPlaintext string `json:"token"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if data.ValidateTokenPlaintext(v, input.TokenPlaintext); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	user, err := app.models.Users.GetForToken(data.ScopeEmailCancel, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrGeneralRecordNotFound):
+			v.AddError("token", "invalid or expired email change cancellation token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	user.PendingEmail = ""
+	err = app.models.Users.UpdateUser(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrGeneralEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.deleteEmailChangeTokens(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "the pending email change has been cancelled"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteEmailChangeTokens() removes both the confirmation and cancellation tokens of a
+// user's email change once it has been resolved either way.
+func (app *application) deleteEmailChangeTokens(userID int64) error {
+	for _, scope := range []string{data.ScopeEmailChange, data.ScopeEmailCancel} {
+		err := app.models.Tokens.DeleteAllForUser(scope, userID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
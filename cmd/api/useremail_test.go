@@ -0,0 +1,230 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Blue-Davinci/musical-zoe/internal/data"
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// expectEmailChangeTokensDeleted() expects both the confirmation and cancellation
+// tokens of an email change to be removed.
+func expectEmailChangeTokensDeleted(mock sqlmock.Sqlmock, userID int64) {
+	mock.ExpectExec(query("DeletAllAPIKeysForUser")).WithArgs(data.ScopeEmailChange, userID).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(query("DeletAllAPIKeysForUser")).WithArgs(data.ScopeEmailCancel, userID).WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+func TestRequestEmailChangeHandler(t *testing.T) {
+	user := testUser{ID: 7, Name: "Zoe", Email: "zoe@example.com", Password: "pa55word1234", Activated: true, Version: 1}
+	other := testUser{ID: 8, Name: "Max", Email: "max@example.com", Password: "pa55word1234", Activated: true, Version: 1}
+
+	tests := []struct {
+		name           string
+		email          string
+		password       string
+		expect         func(mock sqlmock.Sqlmock)
+		expectedStatus int
+	}{
+		{
+			name:     "new address is stored as pending and both addresses are emailed",
+			email:    "zoe@new.example.com",
+			password: user.Password,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectLoginNotThrottled(mock)
+				mock.ExpectQuery(query("GetUserByEmail")).WithArgs("zoe@new.example.com").WillReturnRows(sqlmock.NewRows(userColumns))
+				mock.ExpectQuery(query("UpdateUser")).
+					WithArgs(sqlmock.AnyArg(), user.Email, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "zoe@new.example.com", sqlmock.AnyArg(), false, user.ID, user.Version).
+					WillReturnRows(sqlmock.NewRows([]string{"version", "updated_at"}).AddRow(2, time.Now()))
+				expectEmailChangeTokensDeleted(mock, user.ID)
+				for range 2 {
+					mock.ExpectQuery(query("InsertApiKey")).WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(1, time.Now()))
+				}
+				expectEmailQueued(mock)
+				expectEmailQueued(mock)
+			},
+			expectedStatus: http.StatusAccepted,
+		},
+		{
+			name:     "wrong password counts as a failed login",
+			email:    "zoe@new.example.com",
+			password: "not-my-password",
+			expect: func(mock sqlmock.Sqlmock) {
+				expectLoginNotThrottled(mock)
+				expectLoginFailure(mock, 1)
+			},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:     "wrong passwords lock the account",
+			email:    "zoe@new.example.com",
+			password: "not-my-password",
+			expect: func(mock sqlmock.Sqlmock) {
+				expectLoginNotThrottled(mock)
+				expectLoginFailure(mock, 5)
+				mock.ExpectExec(query("UpsertLoginLockout")).WillReturnResult(sqlmock.NewResult(0, 1))
+				expectEmailQueued(mock)
+			},
+			expectedStatus: http.StatusLocked,
+		},
+		{
+			name:     "locked account is refused before the password is checked",
+			email:    "zoe@new.example.com",
+			password: user.Password,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(query("GetLoginLockout")).WillReturnRows(sqlmock.NewRows([]string{"locked_until"}).AddRow(time.Now().Add(time.Minute)))
+			},
+			expectedStatus: http.StatusLocked,
+		},
+		{
+			name:     "address used by another account",
+			email:    other.Email,
+			password: user.Password,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectLoginNotThrottled(mock)
+				mock.ExpectQuery(query("GetUserByEmail")).WithArgs(other.Email).WillReturnRows(other.rows(t))
+			},
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "invalid email",
+			email:          "not-an-email",
+			password:       user.Password,
+			expect:         func(mock sqlmock.Sqlmock) {},
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, mock := newTestApplication(t)
+			u := user.load(t, app, mock)
+			tt.expect(mock)
+			r := newJSONRequest(t, http.MethodPost, "/v1/api/me/email", map[string]string{"email": tt.email, "password": tt.password})
+			rr := httptest.NewRecorder()
+			app.requestEmailChangeHandler(rr, app.contextSetUser(r, u))
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestConfirmEmailChangeHandler(t *testing.T) {
+	pending := testUser{ID: 7, Name: "Zoe", Email: "zoe@example.com", Password: "pa55word1234", Activated: true, PendingEmail: "zoe@new.example.com", Version: 2}
+	settled := testUser{ID: 7, Name: "Zoe", Email: "zoe@example.com", Password: "pa55word1234", Activated: true, Version: 2}
+	token := "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+	tests := []struct {
+		name           string
+		token          string
+		expect         func(mock sqlmock.Sqlmock)
+		expectedStatus int
+	}{
+		{
+			name:  "pending email becomes the user's email",
+			token: token,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(query("GetForToken")).WithArgs(sqlmock.AnyArg(), data.ScopeEmailChange, sqlmock.AnyArg()).WillReturnRows(pending.rows(t))
+				mock.ExpectQuery(query("UpdateUser")).
+					WithArgs(sqlmock.AnyArg(), pending.PendingEmail, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "", sqlmock.AnyArg(), false, pending.ID, pending.Version).
+					WillReturnRows(sqlmock.NewRows([]string{"version", "updated_at"}).AddRow(3, time.Now()))
+				expectEmailChangeTokensDeleted(mock, pending.ID)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:  "address taken since the request",
+			token: token,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(query("GetForToken")).WillReturnRows(pending.rows(t))
+				mock.ExpectQuery(query("UpdateUser")).WillReturnError(errors.New(`pq: duplicate key value violates unique constraint "users_email_key"`))
+			},
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:  "no pending email change",
+			token: token,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(query("GetForToken")).WillReturnRows(settled.rows(t))
+			},
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:  "expired or used token",
+			token: token,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(query("GetForToken")).WillReturnRows(sqlmock.NewRows(userColumns))
+			},
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "malformed token",
+			token:          "short",
+			expect:         func(mock sqlmock.Sqlmock) {},
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, mock := newTestApplication(t)
+			tt.expect(mock)
+			r := newJSONRequest(t, http.MethodPut, "/v1/api/me/email", map[string]string{"token": tt.token})
+			rr := httptest.NewRecorder()
+			app.confirmEmailChangeHandler(rr, r)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestCancelEmailChangeHandler(t *testing.T) {
+	pending := testUser{ID: 7, Name: "Zoe", Email: "zoe@example.com", Password: "pa55word1234", Activated: true, PendingEmail: "zoe@new.example.com", Version: 2}
+	token := "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+	tests := []struct {
+		name           string
+		expect         func(mock sqlmock.Sqlmock)
+		expectedStatus int
+	}{
+		{
+			name: "pending email is discarded and the address is kept",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(query("GetForToken")).WithArgs(sqlmock.AnyArg(), data.ScopeEmailCancel, sqlmock.AnyArg()).WillReturnRows(pending.rows(t))
+				mock.ExpectQuery(query("UpdateUser")).
+					WithArgs(sqlmock.AnyArg(), pending.Email, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "", sqlmock.AnyArg(), false, pending.ID, pending.Version).
+					WillReturnRows(sqlmock.NewRows([]string{"version", "updated_at"}).AddRow(3, time.Now()))
+				expectEmailChangeTokensDeleted(mock, pending.ID)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "expired or used token",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(query("GetForToken")).WillReturnRows(sqlmock.NewRows(userColumns))
+			},
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, mock := newTestApplication(t)
+			tt.expect(mock)
+			r := newJSONRequest(t, http.MethodPut, "/v1/api/me/email/cancel", map[string]string{"token": token})
+			rr := httptest.NewRecorder()
+			app.cancelEmailChangeHandler(rr, r)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
@@ -3,10 +3,12 @@ package main
 import (
 	"errors"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/Blue-Davinci/musical-zoe/internal/data"
 	"github.com/Blue-Davinci/musical-zoe/internal/validator"
+	"github.com/tomasen/realip"
 	"go.uber.org/zap"
 )
 
@@ -15,6 +17,7 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		Name     string `json:"name"`
 		Email    string `json:"email"`
 		Password string `json:"password"`
+		Locale   string `json:"locale"`
 	}
 	err := app.readJSON(w, r, &input)
 	if err != nil {
@@ -33,9 +36,17 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		app.serverErrorResponse(w, r, err)
 		return
 	}
-	// Perform validation on the user struct before saving the new user
+	// Perform validation on the user struct before saving the new user. The locale is
+	// optional and taken from the Accept-Language header when it isn't given.
 	v := validator.New()
-	if data.ValidateUser(v, user); !v.Valid() {
+	if input.Locale != "" {
+		user.Locale = app.validateLocale(v, input.Locale)
+	} else {
+		user.Locale = app.readAcceptLanguage(r)
+	}
+	data.ValidateUser(v, user)
+	app.validatePasswordPolicy(r, v, input.Password, user.Name, user.Email)
+	if !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
@@ -53,26 +64,15 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 
 		return
 	}
+	app.recordAuditEvent(r, data.AuditEventRegistration, user.ID, user.Email, nil)
 	// token for the user.
-	token, err := app.models.Tokens.New(user.ID, 3*24*time.Hour, data.ScopeActivation)
+	token, err := app.models.Tokens.New(user.ID, data.DefaultActivationTokenExpiryTime, data.ScopeActivation)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	app.background(func() {
-		data := map[string]any{
-			"activationURL":   app.config.url.activationURL + token.Plaintext,
-			"activationToken": token.Plaintext,
-			"userID":          user.ID,
-			"name":            user.Name,
-		}
-		// Send the welcome email, passing in the map above as dynamic data.
-		err = app.mailer.Send(user.Email, "user_welcome.tmpl", data)
-		if err != nil {
-			app.logger.Error("failed to send welcome email", zap.String("email", user.Email), zap.Error(err))
-		}
-	})
+	app.sendActivationEmail(user, token)
 
 	//write our 202 response back to the user and check for any errors
 	err = app.writeJSON(w, http.StatusAccepted, envelope{"user": user}, nil)
@@ -81,6 +81,83 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 	}
 }
 
+// sendActivationEmail() queues the welcome email containing the activation token.
+func (app *application) sendActivationEmail(user *data.User, token *data.Token) {
+	emailData := map[string]any{
+		"activationURL":   app.config.url.activationURL + token.Plaintext,
+		"activationToken": token.Plaintext,
+		"userID":          strconv.FormatInt(user.ID, 10),
+		"name":            user.Name,
+	}
+	// Send the welcome email, passing in the map above as dynamic data.
+	err := app.sendEmail(user.Email, "user_welcome.tmpl", user.Locale, emailData)
+	if err != nil {
+		app.logger.Error("failed to send welcome email", zap.String("email", user.Email), zap.Error(err))
+	}
+}
+
+// resendActivationTokenHandler() replaces any existing activation tokens for an
+// unactivated account with a new one and re-sends the welcome email. The response is
+// identical whether or not the email belongs to an account, and requests for the same
+// account are throttled to one per activation resend interval.
+func (app *application) resendActivationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if data.ValidateEmail(v, input.Email); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	// the generic message we send back regardless of the outcome
+	message := envelope{"message": "if an unactivated account with that email exists, you will receive a new activation email shortly"}
+	user, err := app.models.Users.GetByEmail(input.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrGeneralRecordNotFound):
+			err = app.writeJSON(w, http.StatusAccepted, message, nil)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+			}
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	// suspended accounts can only be reactivated by an operator
+	if !user.Activated && !user.Suspended {
+		// throttle resends for the same account
+		recentlySent, err := app.models.Tokens.IssuedSince(data.ScopeActivation, user.ID, time.Now().Add(-app.config.activation.resendInterval))
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if !recentlySent {
+			// only the newest activation token should be valid
+			err = app.models.Tokens.DeleteAllForUser(data.ScopeActivation, user.ID)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+			token, err := app.models.Tokens.New(user.ID, data.DefaultActivationTokenExpiryTime, data.ScopeActivation)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+			app.sendActivationEmail(user, token)
+		}
+	}
+	err = app.writeJSON(w, http.StatusAccepted, message, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
 // activateUserHandler() Handles activating a user. Inactive users cannot perform a multitude
 // of functions. This handler accepts a JSON request containing a plaintext activation token
 // and activates the user associated with the token & the activate scope if that token exists.
@@ -107,13 +184,18 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrGeneralRecordNotFound):
-			v.AddError("token", "invalid or expired activation token")
+			v.AddError("token", "invalid or expired activation token, you can request a new one from /v1/api/activation/resend")
 			app.failedValidationResponse(w, r, v.Errors)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
+	// an operator may have suspended the account before it was ever activated
+	if user.Suspended {
+		app.suspendedAccountResponse(w, r)
+		return
+	}
 	app.logger.Info("User Version: ", zap.Int("Version", int(user.Version)))
 	// Update the user's activation status.
 	user.Activated = true
@@ -129,6 +211,7 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 		}
 		return
 	}
+	app.recordAuditEvent(r, data.AuditEventActivation, user.ID, user.Email, nil)
 	// If everything went successfully, then we delete all activation tokens for the
 	// user.
 	err = app.models.Tokens.DeleteAllForUser(data.ScopeActivation, user.ID)
@@ -137,21 +220,19 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 	// Succesful, so we send an email for a succesful activation
-	app.background(func() {
-		// As there are now multiple pieces of data that we want to pass to our email
-		// templates, we create a map to act as a 'holding structure' for the data. This
-		// contains the plaintext version of the activation token for the user, along
-		// with their ID.
-		data := map[string]any{
-			"loginURL": app.config.url.authenticationURL,
-			"userName": user.Name,
-		}
-		// Send the welcome email, passing in the map above as dynamic data.
-		err = app.mailer.Send(user.Email, "user_succesful_activation.tmpl", data)
-		if err != nil {
-			app.logger.Error("Error sending welcome email", zap.String("email", user.Email), zap.Error(err))
-		}
-	})
+	// As there are now multiple pieces of data that we want to pass to our email
+	// templates, we create a map to act as a 'holding structure' for the data. This
+	// contains the plaintext version of the activation token for the user, along
+	// with their ID.
+	emailData := map[string]any{
+		"loginURL": app.config.url.authenticationURL,
+		"userName": user.Name,
+	}
+	// Send the welcome email, passing in the map above as dynamic data.
+	err = app.sendEmail(user.Email, "user_succesful_activation.tmpl", user.Locale, emailData)
+	if err != nil {
+		app.logger.Error("Error sending welcome email", zap.String("email", user.Email), zap.Error(err))
+	}
 	// minimize data we send back to the client
 	newUser := data.UserSubInfo{
 		Name:      user.Name,
@@ -185,13 +266,19 @@ func (app *application) createAuthenticationApiKeyHandler(w http.ResponseWriter,
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
+	// refuse the attempt outright while the email or the client's IP is throttled
+	ipAddress := realip.FromRequest(r)
+	if app.loginThrottledResponse(w, r, input.Email, ipAddress) {
+		return
+	}
 	// get the user from the database
 	user, err := app.models.Users.GetByEmail(input.Email)
 	if err != nil {
 		switch {
-		// if the user is not found, we return an invalid credentials response
+		// if the user is not found, we record the failure and return an invalid
+		// credentials response
 		case errors.Is(err, data.ErrGeneralRecordNotFound):
-			app.invalidCredentialsResponse(w, r)
+			app.failedLoginResponse(w, r, input.Email, ipAddress, nil)
 		default:
 			// otherwsie return a 500 internal server error
 			app.serverErrorResponse(w, r, err)
@@ -206,16 +293,71 @@ func (app *application) createAuthenticationApiKeyHandler(w http.ResponseWriter,
 	}
 	// if password doesn't match then we shout
 	if !match {
-		app.invalidCredentialsResponse(w, r)
+		app.failedLoginResponse(w, r, input.Email, ipAddress, user)
+		return
+	}
+	// If the user has MFA enabled, we don't hand out a bearer token yet. Instead we issue
+	// a short-lived mfa-login token that must be exchanged, together with a valid TOTP
+	// code, via the createMFAAuthenticationApiKeyHandler() endpoint.
+	if user.MFAEnabled {
+		app.createMFAChallengeResponse(w, r, user)
+		return
+	}
+	app.createAuthenticationApiKeyResponse(w, r, user, "")
+}
+
+// createMFAChallengeResponse() issues the short-lived mfa-login token for a user who has
+// passed the first login step but still has to provide a TOTP or recovery code.
+func (app *application) createMFAChallengeResponse(w http.ResponseWriter, r *http.Request, user *data.User) {
+	mfaToken, err := app.models.Tokens.New(user.ID, data.DefaultMFALoginTokenExpiryTime, data.ScopeMFALogin)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusAccepted, envelope{
+		"mfa_required": true,
+		"mfa_token":    mfaToken,
+	}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createAuthenticationApiKeyResponse() generates a short-lived api_key with the scope
+// 'authentication' and a long-lived refresh token for an already verified user, saving
+// them to the DB and writing them back to the client. Fresh logins pass an empty
+// familyID; refreshes pass the family of the refresh token being rotated.
+func (app *application) createAuthenticationApiKeyResponse(w http.ResponseWriter, r *http.Request, user *data.User, familyID string) {
+	// however they got this far, suspended users never get a session
+	if user.Suspended {
+		app.suspendedAccountResponse(w, r)
 		return
 	}
-	// Otherwise, if the password is correct, we generate a new api_key with a 72-hour
-	// expiry time and the scope 'authentication', saving it to the DB
-	bearer_token, err := app.models.Tokens.New(user.ID, 72*time.Hour, data.ScopeAuthentication)
+	bearer_token, refresh_token, err := app.models.Tokens.NewSession(
+		user.ID,
+		app.config.tokens.accessTTL,
+		app.config.tokens.refreshTTL,
+		familyID,
+		realip.FromRequest(r),
+		r.UserAgent(),
+	)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
+	// a fresh login starts a new session, a refresh continues an existing one
+	if familyID == "" {
+		// only a completed login resets the failure count, not a correct password that
+		// still has to be followed by a second factor
+		err = app.models.LoginAttempts.Clear(user.Email)
+		if err != nil {
+			app.logger.Error("failed to clear failed logins", zap.String("email", user.Email), zap.Error(err))
+		}
+		app.recordAuditEvent(r, data.AuditEventLoginSuccess, user.ID, user.Email, map[string]any{"session_id": refresh_token.ID, "path": r.URL.Path})
+		app.notifyNewDevice(r, user)
+	} else {
+		app.recordAuditEvent(r, data.AuditEventTokenCreate, user.ID, user.Email, map[string]any{"session_id": refresh_token.ID, "reason": "refresh"})
+	}
 	// make a user sub info
 	userSubInfo := data.UserSubInfo{
 		Name:      user.Name,
@@ -225,10 +367,157 @@ func (app *application) createAuthenticationApiKeyHandler(w http.ResponseWriter,
 	}
 	// Encode the apikey to json and send it to the user with a 201 Created status code
 	err = app.writeJSON(w, http.StatusCreated, envelope{
-		"api_key": bearer_token,
-		"user":    userSubInfo,
+		"api_key":       bearer_token,
+		"refresh_token": refresh_token,
+		"user":          userSubInfo,
 	}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+// createPasswordResetTokenHandler() generates a password reset token and emails it to the
+// user. To avoid leaking which email addresses are registered, we always respond with
+// the same 202 Accepted message, whether or not a matching activated account exists.
+func (app *application) createPasswordResetTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	// validate the email
+	v := validator.New()
+	if data.ValidateEmail(v, input.Email); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	// the generic message we send back regardless of the outcome
+	message := envelope{"message": "if an activated account with that email exists, you will receive password reset instructions shortly"}
+	// get the user from the database
+	user, err := app.models.Users.GetByEmail(input.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrGeneralRecordNotFound):
+			err = app.writeJSON(w, http.StatusAccepted, message, nil)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+			}
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	// only activated users can reset their passwords
+	if user.Activated {
+		// remove any older reset tokens so only the latest one is valid
+		err = app.models.Tokens.DeleteAllForUser(data.ScopePasswordReset, user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		token, err := app.models.Tokens.New(user.ID, data.DefaultPasswordResetTokenExpiryTime, data.ScopePasswordReset)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		emailData := map[string]any{
+			"passwordResetURL":   app.config.url.passwordResetURL + token.Plaintext,
+			"passwordResetToken": token.Plaintext,
+			"userName":           user.Name,
+		}
+		err = app.sendEmail(user.Email, "user_password_reset.tmpl", user.Locale, emailData)
+		if err != nil {
+			app.logger.Error("failed to send password reset email", zap.String("email", user.Email), zap.Error(err))
+		}
+	}
+	err = app.writeJSON(w, http.StatusAccepted, message, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateUserPasswordHandler() sets a new password for the user that owns the supplied
+// password reset token. On success, every reset and session token belonging to the user
+// is revoked along with their personal API keys, so that anyone holding one has to log
+// in again.
+func (app *application) updateUserPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Password       string `json:"password"`
+		TokenPlaintext string `json:"token"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	// validate the new password and the token
+	v := validator.New()
+	data.ValidatePasswordPlaintext(v, input.Password)
+	data.ValidateTokenPlaintext(v, input.TokenPlaintext)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	// get the user associated with the reset token
+	user, err := app.models.Users.GetForToken(data.ScopePasswordReset, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrGeneralRecordNotFound):
+			v.AddError("token", "invalid or expired password reset token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	// now that we know whose password it is, apply the full password policy
+	if app.validatePasswordPolicy(r, v, input.Password, user.Name, user.Email); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	// set the new password
+	err = user.Password.Set(input.Password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.models.Users.UpdateUser(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrGeneralEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.recordAuditEvent(r, data.AuditEventPasswordChange, user.ID, user.Email, map[string]any{"reason": "password reset"})
+	// the reset token is single use, so remove it along with every session, any login
+	// still in progress and the user's personal API keys
+	err = app.revokeAllTokens(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	// resetting the password also lifts any login lockout
+	err = app.models.LoginAttempts.Clear(user.Email)
+	if err != nil {
+		app.logger.Error("failed to clear failed logins", zap.String("email", user.Email), zap.Error(err))
+	}
+	// let the user know their password has been changed
+	emailData := map[string]any{
+		"loginURL": app.config.url.authenticationURL,
+		"userName": user.Name,
+	}
+	err = app.sendEmail(user.Email, "user_password_change.tmpl", user.Locale, emailData)
+	if err != nil {
+		app.logger.Error("failed to send password change email", zap.String("email", user.Email), zap.Error(err))
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "your password was successfully reset"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Blue-Davinci/musical-zoe/internal/data"
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestCreatePasswordResetTokenHandler(t *testing.T) {
+	activated := testUser{ID: 7, Name: "Zoe", Email: "zoe@example.com", Password: "pa55word1234", Activated: true, Version: 1}
+	unactivated := testUser{ID: 8, Name: "Max", Email: "max@example.com", Password: "pa55word1234", Version: 1}
+
+	tests := []struct {
+		name           string
+		email          string
+		expect         func(mock sqlmock.Sqlmock)
+		expectedStatus int
+	}{
+		{
+			name:  "activated account is sent a new token",
+			email: activated.Email,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(query("GetUserByEmail")).WillReturnRows(activated.rows(t))
+				mock.ExpectExec(query("DeletAllAPIKeysForUser")).WithArgs(data.ScopePasswordReset, int64(7)).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery(query("InsertApiKey")).WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(1, time.Now()))
+				mock.ExpectQuery(query("InsertEmailOutboxMessage")).WillReturnRows(sqlmock.NewRows([]string{"id", "status", "next_attempt_at", "updated_at"}).AddRow(1, "pending", time.Now(), time.Now()))
+			},
+			expectedStatus: http.StatusAccepted,
+		},
+		{
+			name:  "unactivated account is not sent a token",
+			email: unactivated.Email,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(query("GetUserByEmail")).WillReturnRows(unactivated.rows(t))
+			},
+			expectedStatus: http.StatusAccepted,
+		},
+		{
+			name:  "unknown email gets the same response",
+			email: "nobody@example.com",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(query("GetUserByEmail")).WillReturnRows(sqlmock.NewRows(userColumns))
+			},
+			expectedStatus: http.StatusAccepted,
+		},
+		{
+			name:           "invalid email",
+			email:          "not-an-email",
+			expect:         func(mock sqlmock.Sqlmock) {},
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, mock := newTestApplication(t)
+			tt.expect(mock)
+			r := newJSONRequest(t, http.MethodPost, "/v1/api/password-reset", map[string]string{"email": tt.email})
+			rr := httptest.NewRecorder()
+			app.createPasswordResetTokenHandler(rr, r)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestUpdateUserPasswordHandler(t *testing.T) {
+	user := testUser{ID: 7, Name: "Zoe", Email: "zoe@example.com", Password: "pa55word1234", Activated: true, Version: 1}
+	token := "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	newPassword := "violet-Harbour-sketch-42"
+
+	expectReset := func(mock sqlmock.Sqlmock) {
+		mock.ExpectQuery(query("GetForToken")).WithArgs(sqlmock.AnyArg(), data.ScopePasswordReset, sqlmock.AnyArg()).WillReturnRows(user.rows(t))
+		mock.ExpectQuery(query("UpdateUser")).WillReturnRows(sqlmock.NewRows([]string{"version", "updated_at"}).AddRow(2, time.Now()))
+		mock.ExpectQuery(query("InsertAuditEvent")).WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(1, time.Now()))
+		expectAllTokensRevoked(mock, 7)
+		mock.ExpectExec(query("DeleteLoginFailuresForEmail")).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(query("DeleteLoginLockout")).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(query("InsertEmailOutboxMessage")).WillReturnRows(sqlmock.NewRows([]string{"id", "status", "next_attempt_at", "updated_at"}).AddRow(1, "pending", time.Now(), time.Now()))
+	}
+	expectNoToken := func(mock sqlmock.Sqlmock) {
+		mock.ExpectQuery(query("GetForToken")).WithArgs(sqlmock.AnyArg(), data.ScopePasswordReset, sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows(userColumns))
+	}
+
+	type attempt struct {
+		token          string
+		expectedStatus int
+		expectedBody   string
+	}
+	tests := []struct {
+		name     string
+		expect   func(mock sqlmock.Sqlmock)
+		attempts []attempt
+	}{
+		{
+			name:   "resets the password and revokes every session and api key",
+			expect: expectReset,
+			attempts: []attempt{
+				{token: token, expectedStatus: http.StatusOK, expectedBody: "your password was successfully reset"},
+			},
+		},
+		{
+			name: "token can only be used once",
+			expect: func(mock sqlmock.Sqlmock) {
+				expectReset(mock)
+				expectNoToken(mock)
+			},
+			attempts: []attempt{
+				{token: token, expectedStatus: http.StatusOK, expectedBody: "your password was successfully reset"},
+				{token: token, expectedStatus: http.StatusUnprocessableEntity, expectedBody: "invalid or expired password reset token"},
+			},
+		},
+		{
+			name:   "expired or unknown token",
+			expect: expectNoToken,
+			attempts: []attempt{
+				{token: token, expectedStatus: http.StatusUnprocessableEntity, expectedBody: "invalid or expired password reset token"},
+			},
+		},
+		{
+			name:   "malformed token",
+			expect: func(mock sqlmock.Sqlmock) {},
+			attempts: []attempt{
+				{token: "too-short", expectedStatus: http.StatusUnprocessableEntity, expectedBody: "token"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, mock := newTestApplication(t)
+			tt.expect(mock)
+			for _, a := range tt.attempts {
+				r := newJSONRequest(t, http.MethodPut, "/v1/api/password", map[string]string{"password": newPassword, "token": a.token})
+				rr := httptest.NewRecorder()
+				app.updateUserPasswordHandler(rr, r)
+
+				if rr.Code != a.expectedStatus {
+					t.Errorf("expected status %d, got %d: %s", a.expectedStatus, rr.Code, rr.Body.String())
+				}
+				if !strings.Contains(rr.Body.String(), a.expectedBody) {
+					t.Errorf("expected body to contain %q, got %s", a.expectedBody, rr.Body.String())
+				}
+			}
+		})
+	}
+}
+
+func TestResendActivationTokenHandler(t *testing.T) {
+	unactivated := testUser{ID: 8, Name: "Max", Email: "max@example.com", Password: "pa55word1234", Version: 1}
+	activated := testUser{ID: 7, Name: "Zoe", Email: "zoe@example.com", Password: "pa55word1234", Activated: true, Version: 1}
+	suspended := testUser{ID: 9, Name: "Mallory", Email: "mallory@example.com", Password: "pa55word1234", Suspended: true, Version: 2}
+
+	tests := []struct {
+		name   string
+		email  string
+		expect func(mock sqlmock.Sqlmock)
+	}{
+		{
+			name:  "replaces the activation token and resends the email",
+			email: unactivated.Email,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(query("GetUserByEmail")).WillReturnRows(unactivated.rows(t))
+				mock.ExpectQuery(query("CountApiKeysCreatedSince")).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+				mock.ExpectExec(query("DeletAllAPIKeysForUser")).WithArgs(data.ScopeActivation, int64(8)).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery(query("InsertApiKey")).WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(1, time.Now()))
+				expectEmailQueued(mock)
+			},
+		},
+		{
+			name:  "throttled within the resend interval",
+			email: unactivated.Email,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(query("GetUserByEmail")).WillReturnRows(unactivated.rows(t))
+				mock.ExpectQuery(query("CountApiKeysCreatedSince")).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+			},
+		},
+		{
+			name:  "activated account is left alone",
+			email: activated.Email,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(query("GetUserByEmail")).WillReturnRows(activated.rows(t))
+			},
+		},
+		{
+			name:  "suspended account gets no activation token",
+			email: suspended.Email,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(query("GetUserByEmail")).WillReturnRows(suspended.rows(t))
+			},
+		},
+		{
+			name:  "unknown email",
+			email: "nobody@example.com",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(query("GetUserByEmail")).WillReturnRows(sqlmock.NewRows(userColumns))
+			},
+		},
+	}
+
+	var expectedBody string
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, mock := newTestApplication(t)
+			app.config.activation.resendInterval = 5 * time.Minute
+			tt.expect(mock)
+			r := newJSONRequest(t, http.MethodPost, "/v1/api/activation/resend", map[string]string{"email": tt.email})
+			rr := httptest.NewRecorder()
+			app.resendActivationTokenHandler(rr, r)
+
+			if rr.Code != http.StatusAccepted {
+				t.Errorf("expected status %d, got %d: %s", http.StatusAccepted, rr.Code, rr.Body.String())
+			}
+			// every outcome must look the same to the caller
+			if expectedBody == "" {
+				expectedBody = rr.Body.String()
+			}
+			if rr.Body.String() != expectedBody {
+				t.Errorf("expected the same response for every email, got %s", rr.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestActivateUserHandlerPointsExpiredTokensToResend(t *testing.T) {
+	app, mock := newTestApplication(t)
+	mock.ExpectQuery(query("GetForToken")).WithArgs(sqlmock.AnyArg(), data.ScopeActivation, sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows(userColumns))
+	r := newJSONRequest(t, http.MethodPut, "/v1/api/activated", map[string]string{"token": "ABCDEFGHIJKLMNOPQRSTUVWXYZ"})
+	rr := httptest.NewRecorder()
+	app.activateUserHandler(rr, r)
+
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected status %d, got %d: %s", http.StatusUnprocessableEntity, rr.Code, rr.Body.String())
+	}
+	if !strings.Contains(rr.Body.String(), "/v1/api/activation/resend") {
+		t.Errorf("expected the error to point at the resend endpoint, got %s", rr.Body.String())
+	}
+}
+
+func TestActivateUserHandlerRefusesSuspendedUsers(t *testing.T) {
+	app, mock := newTestApplication(t)
+	suspended := testUser{ID: 9, Name: "Mallory", Email: "mallory@example.com", Password: "pa55word1234", Suspended: true, Version: 2}
+	mock.ExpectQuery(query("GetForToken")).WithArgs(sqlmock.AnyArg(), data.ScopeActivation, sqlmock.AnyArg()).WillReturnRows(suspended.rows(t))
+	r := newJSONRequest(t, http.MethodPut, "/v1/api/activated", map[string]string{"token": "ABCDEFGHIJKLMNOPQRSTUVWXYZ"})
+	rr := httptest.NewRecorder()
+	app.activateUserHandler(rr, r)
+
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("expected status %d, got %d: %s", http.StatusForbidden, rr.Code, rr.Body.String())
+	}
+	// the account must not be updated
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
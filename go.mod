@@ -3,18 +3,27 @@ module github.com/Blue-Davinci/musical-zoe
 go 1.24.4
 
 require (
-	github.com/felixge/httpsnoop v1.0.4 // indirect
-	github.com/go-chi/chi v1.5.5 // indirect
-	github.com/go-chi/cors v1.2.1 // indirect
-	github.com/go-mail/mail/v2 v2.3.0 // indirect
+	github.com/DATA-DOG/go-sqlmock v1.5.2
+	github.com/coreos/go-oidc/v3 v3.14.1
+	github.com/felixge/httpsnoop v1.0.4
+	github.com/go-chi/chi v1.5.5
+	github.com/go-chi/cors v1.2.1
+	github.com/go-jose/go-jose/v4 v4.0.5
+	github.com/go-mail/mail/v2 v2.3.0
+	github.com/hashicorp/go-retryablehttp v0.7.7
+	github.com/joho/godotenv v1.5.1
+	github.com/justinas/alice v1.2.0
+	github.com/lib/pq v1.10.9
+	github.com/pquerna/otp v1.5.0
+	github.com/tomasen/realip v0.0.0-20180522021738-f0c99a92ddce
+	go.uber.org/zap v1.27.0
+	golang.org/x/crypto v0.39.0
+	golang.org/x/oauth2 v0.30.0
+)
+
+require (
+	github.com/boombuler/barcode v1.0.1-0.20190219062509-6c824513bacc // indirect
 	github.com/hashicorp/go-cleanhttp v0.5.2 // indirect
-	github.com/hashicorp/go-retryablehttp v0.7.7 // indirect
-	github.com/joho/godotenv v1.5.1 // indirect
-	github.com/justinas/alice v1.2.0 // indirect
-	github.com/lib/pq v1.10.9 // indirect
-	github.com/tomasen/realip v0.0.0-20180522021738-f0c99a92ddce // indirect
 	go.uber.org/multierr v1.10.0 // indirect
-	go.uber.org/zap v1.27.0 // indirect
-	golang.org/x/crypto v0.39.0 // indirect
 	gopkg.in/alexcesaro/quotedprintable.v3 v3.0.0-20150716171945-2caba252f4dc // indirect
 )
@@ -0,0 +1,298 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/Blue-Davinci/musical-zoe/internal/database"
+	"github.com/Blue-Davinci/musical-zoe/internal/validator"
+)
+
+type PersonalApiKeyModel struct {
+	DB *database.Queries
+}
+
+const (
+	DefaultPersonalApiKeyDBContextTimeout = 5 * time.Second
+	MaxPersonalApiKeysPerUser             = 20
+	// PersonalApiKeyPrefix marks a personal API key so it is never confused with a
+	// bearer token, both by us and by secret scanners.
+	PersonalApiKeyPrefix = "mz_"
+	// PersonalApiKeyDisplayLength is how much of the key we keep in plaintext so users
+	// can tell their keys apart.
+	PersonalApiKeyDisplayLength = len(PersonalApiKeyPrefix) + 8
+)
+
+// Define constants for the scopes a personal API key can be restricted to. Each scope
+// grants read access to one of the /v1/musical endpoints.
+const (
+	ApiKeyScopeNewsRead      = "news:read"
+	ApiKeyScopeTrendsRead    = "trends:read"
+	ApiKeyScopeLyricsRead    = "lyrics:read"
+	ApiKeyScopeTrackInfoRead = "track-info:read"
+)
+
+// PersonalApiKeyScopes lists every scope a personal API key may be granted.
+var PersonalApiKeyScopes = []string{
+	ApiKeyScopeNewsRead,
+	ApiKeyScopeTrendsRead,
+	ApiKeyScopeLyricsRead,
+	ApiKeyScopeTrackInfoRead,
+}
+
+// PersonalApiKey is a long-lived, named key that a user creates for server-to-server
+// clients. Only the hash is stored; the plaintext is returned once, on creation.
+type PersonalApiKey struct {
+	ID         int64      `json:"id"`
+	UserID     int64      `json:"-"`
+	Name       string     `json:"name"`
+	Plaintext  string     `json:"key,omitempty"`
+	Hash       []byte     `json:"-"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	Expiry     *time.Time `json:"expiry"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+// HasScope() checks whether the key has been granted a specific scope.
+func (k *PersonalApiKey) HasScope(scope string) bool {
+	return validator.PermittedValue(scope, k.Scopes...)
+}
+
+// ValidatePersonalApiKey() checks the editable fields of a personal API key.
+func ValidatePersonalApiKey(v *validator.Validator, key *PersonalApiKey) {
+	v.Check(strings.TrimSpace(key.Name) != "", "name", "must be provided")
+	v.Check(len(key.Name) <= 100, "name", "must not be more than 100 bytes long")
+	v.Check(len(key.Scopes) > 0, "scopes", "must contain at least one scope")
+	v.Check(validator.Unique(key.Scopes), "scopes", "must not contain duplicate values")
+	for _, scope := range key.Scopes {
+		v.Check(validator.PermittedValue(scope, PersonalApiKeyScopes...), "scopes", "must only contain "+strings.Join(PersonalApiKeyScopes, ", "))
+	}
+}
+
+// ValidatePersonalApiKeyExpiry() checks the optional expiry given when a key is created.
+func ValidatePersonalApiKeyExpiry(v *validator.Validator, expiry *time.Time) {
+	if expiry != nil {
+		v.Check(expiry.After(time.Now()), "expiry", "must be in the future")
+	}
+}
+
+// Check that the plaintext personal API key carries our prefix and has the right length.
+func ValidatePersonalApiKeyPlaintext(v *validator.Validator, keyPlaintext string) {
+	v.Check(keyPlaintext != "", "api_key", "must be provided")
+	v.Check(strings.HasPrefix(keyPlaintext, PersonalApiKeyPrefix), "api_key", "must be valid")
+	v.Check(len(keyPlaintext) == len(PersonalApiKeyPrefix)+32, "api_key", "must be valid")
+}
+
+// New() generates a fresh personal API key for the user and stores its hash. The
+// returned key is the only copy of the plaintext.
+func (m PersonalApiKeyModel) New(userID int64, name string, scopes []string, expiry *time.Time) (*PersonalApiKey, error) {
+	// 20 random bytes encode to exactly 32 base-32 characters
+	randomBytes := make([]byte, 20)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return nil, err
+	}
+	plaintext := PersonalApiKeyPrefix + base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
+	hash := sha256.Sum256([]byte(plaintext))
+	key := &PersonalApiKey{
+		UserID:    userID,
+		Name:      name,
+		Plaintext: plaintext,
+		Hash:      hash[:],
+		Prefix:    plaintext[:PersonalApiKeyDisplayLength],
+		Scopes:    scopes,
+		Expiry:    expiry,
+	}
+	ctx, cancel := contextGenerator(context.Background(), DefaultPersonalApiKeyDBContextTimeout)
+	defer cancel()
+	row, err := m.DB.InsertPersonalApiKey(ctx, database.InsertPersonalApiKeyParams{
+		UserID:    key.UserID,
+		Name:      key.Name,
+		KeyHash:   key.Hash,
+		KeyPrefix: key.Prefix,
+		Scopes:    key.Scopes,
+		Expiry:    toNullTime(key.Expiry),
+	})
+	if err != nil {
+		return nil, err
+	}
+	key.ID = row.ID
+	key.CreatedAt = row.CreatedAt
+	return key, nil
+}
+
+// GetAllForUser() returns every personal API key belonging to a user, newest first,
+// including expired ones so that they can be cleaned up.
+func (m PersonalApiKeyModel) GetAllForUser(userID int64) ([]*PersonalApiKey, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultPersonalApiKeyDBContextTimeout)
+	defer cancel()
+	rows, err := m.DB.GetPersonalApiKeysForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	keys := []*PersonalApiKey{}
+	for _, row := range rows {
+		keys = append(keys, populatePersonalApiKey(row))
+	}
+	return keys, nil
+}
+
+// GetForUser() returns a single personal API key, making sure it belongs to the user.
+func (m PersonalApiKeyModel) GetForUser(keyID, userID int64) (*PersonalApiKey, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultPersonalApiKeyDBContextTimeout)
+	defer cancel()
+	row, err := m.DB.GetPersonalApiKeyByIDForUser(ctx, database.GetPersonalApiKeyByIDForUserParams{
+		ID:     keyID,
+		UserID: userID,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrGeneralRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return populatePersonalApiKey(row), nil
+}
+
+// Update() saves a new name and scope list for an existing key. The expiry is fixed
+// when the key is created and can only be shortened by deleting the key.
+func (m PersonalApiKeyModel) Update(key *PersonalApiKey) error {
+	ctx, cancel := contextGenerator(context.Background(), DefaultPersonalApiKeyDBContextTimeout)
+	defer cancel()
+	rows, err := m.DB.UpdatePersonalApiKey(ctx, database.UpdatePersonalApiKeyParams{
+		Name:   key.Name,
+		Scopes: key.Scopes,
+		ID:     key.ID,
+		UserID: key.UserID,
+	})
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrGeneralRecordNotFound
+	}
+	return nil
+}
+
+// DeleteForUser() revokes a personal API key, returning ErrGeneralRecordNotFound if the
+// user has no key with that ID.
+func (m PersonalApiKeyModel) DeleteForUser(keyID, userID int64) error {
+	ctx, cancel := contextGenerator(context.Background(), DefaultPersonalApiKeyDBContextTimeout)
+	defer cancel()
+	rows, err := m.DB.DeletePersonalApiKeyForUser(ctx, database.DeletePersonalApiKeyForUserParams{
+		ID:     keyID,
+		UserID: userID,
+	})
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrGeneralRecordNotFound
+	}
+	return nil
+}
+
+// DeleteAllForUser() revokes every personal API key a user holds, returning how many
+// were removed.
+func (m PersonalApiKeyModel) DeleteAllForUser(userID int64) (int64, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultPersonalApiKeyDBContextTimeout)
+	defer cancel()
+	return m.DB.DeleteAllPersonalApiKeysForUser(ctx, userID)
+}
+
+// CountForUser() returns how many personal API keys a user currently holds.
+func (m PersonalApiKeyModel) CountForUser(userID int64) (int64, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultPersonalApiKeyDBContextTimeout)
+	defer cancel()
+	return m.DB.CountPersonalApiKeysForUser(ctx, userID)
+}
+
+// GetForPlaintext() looks up an unexpired personal API key by its plaintext and returns
+// both the owning user and the key, so that callers can enforce the key's scopes.
+func (m PersonalApiKeyModel) GetForPlaintext(keyPlaintext string) (*User, *PersonalApiKey, error) {
+	hash := sha256.Sum256([]byte(keyPlaintext))
+	ctx, cancel := contextGenerator(context.Background(), DefaultPersonalApiKeyDBContextTimeout)
+	defer cancel()
+	row, err := m.DB.GetUserForPersonalApiKey(ctx, database.GetUserForPersonalApiKeyParams{
+		KeyHash: hash[:],
+		Now:     sql.NullTime{Time: time.Now(), Valid: true},
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, nil, ErrGeneralRecordNotFound
+		default:
+			return nil, nil, err
+		}
+	}
+	key := &PersonalApiKey{
+		ID:     row.ID,
+		UserID: row.User.ID,
+		Name:   row.Name,
+		Hash:   hash[:],
+		Scopes: row.Scopes,
+		Expiry: fromNullTime(row.Expiry),
+	}
+	return populateUser(row.User), key, nil
+}
+
+// Touch() records that a key was just used. Like sessions, writes are throttled so a
+// busy client doesn't update the row on every request.
+func (m PersonalApiKeyModel) Touch(keyID int64) error {
+	ctx, cancel := contextGenerator(context.Background(), DefaultPersonalApiKeyDBContextTimeout)
+	defer cancel()
+	now := time.Now()
+	return m.DB.UpdatePersonalApiKeyLastUsed(ctx, database.UpdatePersonalApiKeyLastUsedParams{
+		LastUsedAt:  sql.NullTime{Time: now, Valid: true},
+		ID:          keyID,
+		StaleBefore: sql.NullTime{Time: now.Add(-DefaultSessionLastUsedInterval), Valid: true},
+	})
+}
+
+// populatePersonalApiKey() converts one of the personal API key rows returned by sqlc
+// into a PersonalApiKey.
+func populatePersonalApiKey(keyRow any) *PersonalApiKey {
+	switch row := keyRow.(type) {
+	case database.GetPersonalApiKeysForUserRow:
+		return populatePersonalApiKey(database.GetPersonalApiKeyByIDForUserRow(row))
+	case database.GetPersonalApiKeyByIDForUserRow:
+		return &PersonalApiKey{
+			ID:         row.ID,
+			UserID:     row.UserID,
+			Name:       row.Name,
+			Prefix:     row.KeyPrefix,
+			Scopes:     row.Scopes,
+			Expiry:     fromNullTime(row.Expiry),
+			CreatedAt:  row.CreatedAt,
+			LastUsedAt: fromNullTime(row.LastUsedAt),
+		}
+	default:
+		return nil
+	}
+}
+
+// toNullTime() and fromNullTime() convert between optional timestamps in our models
+// and the sql.NullTime values sqlc uses for nullable columns.
+func toNullTime(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: *t, Valid: true}
+}
+
+func fromNullTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
@@ -0,0 +1,183 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/Blue-Davinci/musical-zoe/internal/database"
+	"github.com/Blue-Davinci/musical-zoe/internal/validator"
+)
+
+type AuditEventModel struct {
+	DB *database.Queries
+}
+
+const (
+	DefaultAuditEventDBContextTimeout = 5 * time.Second
+)
+
+// Define constants for the types of audit event we record.
+const (
+	AuditEventRegistration         = "registration"
+	AuditEventActivation           = "activation"
+	AuditEventLoginSuccess         = "login.success"
+	AuditEventLoginFailure         = "login.failure"
+	AuditEventMFAEnrollmentFailure = "mfa.enrollment_failure"
+	AuditEventTokenCreate          = "token.create"
+	AuditEventTokenRevoke          = "token.revoke"
+	AuditEventPasswordChange       = "password.change"
+	AuditEventAccountDelete        = "account.delete"
+)
+
+// AuditEventTypes lists every audit event type, for validating filters.
+var AuditEventTypes = []string{
+	AuditEventRegistration,
+	AuditEventActivation,
+	AuditEventLoginSuccess,
+	AuditEventLoginFailure,
+	AuditEventMFAEnrollmentFailure,
+	AuditEventTokenCreate,
+	AuditEventTokenRevoke,
+	AuditEventPasswordChange,
+	AuditEventAccountDelete,
+}
+
+// AuditEvent is a single entry in the security audit log. UserID is 0 for events that
+// couldn't be tied to an account, such as a failed login for an unknown email.
+type AuditEvent struct {
+	ID        int64          `json:"id"`
+	UserID    int64          `json:"user_id,omitempty"`
+	Email     string         `json:"email,omitempty"`
+	EventType string         `json:"event_type"`
+	IPAddress string         `json:"ip_address"`
+	UserAgent string         `json:"user_agent"`
+	RequestID string         `json:"request_id"`
+	Metadata  map[string]any `json:"metadata"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+// AuditEventFilters narrows down the events returned by GetAll(). Zero and nil fields
+// match every event.
+type AuditEventFilters struct {
+	UserID        int64
+	EventType     string
+	Email         string
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+}
+
+func ValidateAuditEventFilters(v *validator.Validator, f AuditEventFilters) {
+	if f.EventType != "" {
+		v.Check(validator.PermittedValue(f.EventType, AuditEventTypes...), "event_type", "must be a known event type")
+	}
+	if f.Email != "" {
+		ValidateEmail(v, f.Email)
+	}
+}
+
+func (f AuditEventFilters) params() database.CountAuditEventsParams {
+	params := database.CountAuditEventsParams{
+		EventType:     f.EventType,
+		Email:         f.Email,
+		CreatedAfter:  toNullTime(f.CreatedAfter),
+		CreatedBefore: toNullTime(f.CreatedBefore),
+	}
+	if f.UserID != 0 {
+		params.UserID = sql.NullInt64{Int64: f.UserID, Valid: true}
+	}
+	return params
+}
+
+// Insert() appends an event to the audit log, filling in its ID and creation time.
+func (m AuditEventModel) Insert(event *AuditEvent) error {
+	ctx, cancel := contextGenerator(context.Background(), DefaultAuditEventDBContextTimeout)
+	defer cancel()
+	metadata := event.Metadata
+	if metadata == nil {
+		metadata = map[string]any{}
+	}
+	metadataJSON, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+	row, err := m.DB.InsertAuditEvent(ctx, database.InsertAuditEventParams{
+		UserID:    sql.NullInt64{Int64: event.UserID, Valid: event.UserID != 0},
+		Email:     event.Email,
+		EventType: event.EventType,
+		IpAddress: event.IPAddress,
+		UserAgent: event.UserAgent,
+		RequestID: event.RequestID,
+		Metadata:  metadataJSON,
+	})
+	if err != nil {
+		return err
+	}
+	event.ID = row.ID
+	event.CreatedAt = row.CreatedAt
+	return nil
+}
+
+// GetAll() returns a page of audit events matching the filters, newest first, along
+// with the pagination metadata.
+func (m AuditEventModel) GetAll(eventFilters AuditEventFilters, filters Filters) ([]*AuditEvent, Metadata, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultAuditEventDBContextTimeout)
+	defer cancel()
+	params := eventFilters.params()
+	totalRecords, err := m.DB.CountAuditEvents(ctx, params)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	rows, err := m.DB.ListAuditEvents(ctx, database.ListAuditEventsParams{
+		UserID:        params.UserID,
+		EventType:     params.EventType,
+		Email:         params.Email,
+		CreatedAfter:  params.CreatedAfter,
+		CreatedBefore: params.CreatedBefore,
+		Limit:         filters.limit(),
+		Offset:        filters.offset(),
+	})
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	events, err := auditEventsFromRows(rows)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	return events, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+// GetAllForUser() returns every event recorded for a user, newest first, for their data
+// export.
+func (m AuditEventModel) GetAllForUser(userID int64) ([]*AuditEvent, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultAuditEventDBContextTimeout)
+	defer cancel()
+	rows, err := m.DB.GetAuditEventsForUser(ctx, sql.NullInt64{Int64: userID, Valid: true})
+	if err != nil {
+		return nil, err
+	}
+	return auditEventsFromRows(rows)
+}
+
+func auditEventsFromRows(rows []database.AuditEvent) ([]*AuditEvent, error) {
+	events := []*AuditEvent{}
+	for _, row := range rows {
+		event := &AuditEvent{
+			ID:        row.ID,
+			UserID:    row.UserID.Int64,
+			Email:     row.Email,
+			EventType: row.EventType,
+			IPAddress: row.IpAddress,
+			UserAgent: row.UserAgent,
+			RequestID: row.RequestID,
+			CreatedAt: row.CreatedAt,
+		}
+		err := json.Unmarshal(row.Metadata, &event.Metadata)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
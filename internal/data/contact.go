@@ -0,0 +1,158 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/Blue-Davinci/musical-zoe/internal/database"
+	"github.com/Blue-Davinci/musical-zoe/internal/validator"
+)
+
+type ContactMessageModel struct {
+	DB *database.Queries
+}
+
+const (
+	DefaultContactMessageDBContextTimeout = 5 * time.Second
+	DefaultContactIPLimit                 = 5
+	DefaultContactWindow                  = time.Hour
+)
+
+// ContactMessage is a message sent through the public contact form.
+type ContactMessage struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Email      string     `json:"email"`
+	Subject    string     `json:"subject"`
+	Message    string     `json:"message"`
+	IPAddress  string     `json:"ip_address"`
+	UserAgent  string     `json:"user_agent"`
+	Resolved   bool       `json:"resolved"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+	ResolvedBy int64      `json:"resolved_by,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func ValidateContactMessage(v *validator.Validator, message *ContactMessage) {
+	ValidateName(v, message.Name)
+	ValidateEmail(v, message.Email)
+	v.Check(strings.TrimSpace(message.Subject) != "", "subject", "must be provided")
+	v.Check(len(message.Subject) <= 200, "subject", "must not be more than 200 bytes long")
+	v.Check(strings.TrimSpace(message.Message) != "", "message", "must be provided")
+	v.Check(len(message.Message) <= 5000, "message", "must not be more than 5000 bytes long")
+}
+
+func contactMessageFromRow(row database.ContactMessage) *ContactMessage {
+	return &ContactMessage{
+		ID:         row.ID,
+		Name:       row.Name,
+		Email:      row.Email,
+		Subject:    row.Subject,
+		Message:    row.Message,
+		IPAddress:  row.IpAddress,
+		UserAgent:  row.UserAgent,
+		Resolved:   row.ResolvedAt.Valid,
+		ResolvedAt: fromNullTime(row.ResolvedAt),
+		ResolvedBy: row.ResolvedBy.Int64,
+		CreatedAt:  row.CreatedAt,
+	}
+}
+
+// Insert() stores a new contact message, filling in its ID and creation time.
+func (m ContactMessageModel) Insert(message *ContactMessage) error {
+	ctx, cancel := contextGenerator(context.Background(), DefaultContactMessageDBContextTimeout)
+	defer cancel()
+	row, err := m.DB.InsertContactMessage(ctx, database.InsertContactMessageParams{
+		Name:      message.Name,
+		Email:     message.Email,
+		Subject:   message.Subject,
+		Message:   message.Message,
+		IpAddress: message.IPAddress,
+		UserAgent: message.UserAgent,
+	})
+	if err != nil {
+		return err
+	}
+	message.ID = row.ID
+	message.CreatedAt = row.CreatedAt
+	return nil
+}
+
+// CountForIPSince() returns how many contact messages an IP address has sent since the
+// given time, for throttling the contact form.
+func (m ContactMessageModel) CountForIPSince(ipAddress string, since time.Time) (int64, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultContactMessageDBContextTimeout)
+	defer cancel()
+	return m.DB.CountContactMessagesForIPSince(ctx, database.CountContactMessagesForIPSinceParams{
+		IpAddress: ipAddress,
+		CreatedAt: since,
+	})
+}
+
+// GetAll() returns a page of contact messages, newest first, along with the pagination
+// metadata. A nil resolved matches both open and resolved messages.
+func (m ContactMessageModel) GetAll(resolved *bool, filters Filters) ([]*ContactMessage, Metadata, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultContactMessageDBContextTimeout)
+	defer cancel()
+	var resolvedFilter sql.NullBool
+	if resolved != nil {
+		resolvedFilter = sql.NullBool{Bool: *resolved, Valid: true}
+	}
+	totalRecords, err := m.DB.CountContactMessages(ctx, resolvedFilter)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	rows, err := m.DB.ListContactMessages(ctx, database.ListContactMessagesParams{
+		Resolved: resolvedFilter,
+		Limit:    filters.limit(),
+		Offset:   filters.offset(),
+	})
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	messages := []*ContactMessage{}
+	for _, row := range rows {
+		messages = append(messages, contactMessageFromRow(row))
+	}
+	return messages, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+// GetAllForEmail() returns every contact message sent from an email address, newest
+// first.
+func (m ContactMessageModel) GetAllForEmail(email string) ([]*ContactMessage, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultContactMessageDBContextTimeout)
+	defer cancel()
+	rows, err := m.DB.GetContactMessagesForEmail(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	messages := []*ContactMessage{}
+	for _, row := range rows {
+		messages = append(messages, contactMessageFromRow(row))
+	}
+	return messages, nil
+}
+
+// SetResolved() marks a contact message resolved by the given operator, or reopens it.
+// Resolving an already resolved message keeps its original resolution time and operator.
+func (m ContactMessageModel) SetResolved(id int64, resolved bool, operatorID int64) (*ContactMessage, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultContactMessageDBContextTimeout)
+	defer cancel()
+	row, err := m.DB.UpdateContactMessageResolution(ctx, database.UpdateContactMessageResolutionParams{
+		Resolved:   resolved,
+		ResolvedBy: sql.NullInt64{Int64: operatorID, Valid: true},
+		ID:         id,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrGeneralRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return contactMessageFromRow(row), nil
+}
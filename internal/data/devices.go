@@ -0,0 +1,90 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"time"
+
+	"github.com/Blue-Davinci/musical-zoe/internal/database"
+)
+
+type KnownDeviceModel struct {
+	DB *database.Queries
+}
+
+const (
+	DefaultKnownDeviceDBContextTimeout = 5 * time.Second
+)
+
+// KnownDevice is an IP address and user-agent pair a user has logged in from. Revoked
+// devices are reported again the next time they are used.
+type KnownDevice struct {
+	ID          int64     `json:"id"`
+	IPAddress   string    `json:"ip_address"`
+	UserAgent   string    `json:"user_agent"`
+	Revoked     bool      `json:"revoked"`
+	FirstSeenAt time.Time `json:"first_seen_at"`
+	LastSeenAt  time.Time `json:"last_seen_at"`
+}
+
+// Remember() records that a user has logged in from an IP address and user-agent pair.
+// It reports whether the pair is new to a user who already had other known devices, or
+// was revoked since it was last used. The very first device a user logs in from is never
+// reported, as there is nothing to compare it against.
+func (m KnownDeviceModel) Remember(userID int64, ipAddress, userAgent string) (bool, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultKnownDeviceDBContextTimeout)
+	defer cancel()
+	fingerprint := sha256.Sum256([]byte(ipAddress + "\x00" + userAgent))
+	row, err := m.DB.UpsertKnownDevice(ctx, database.UpsertKnownDeviceParams{
+		UserID:      userID,
+		Fingerprint: fingerprint[:],
+		IpAddress:   ipAddress,
+		UserAgent:   userAgent,
+	})
+	if err != nil {
+		return false, err
+	}
+	if row.WasRevoked {
+		return true, nil
+	}
+	if !row.Inserted {
+		return false, nil
+	}
+	count, err := m.DB.CountKnownDevicesForUser(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return count > 1, nil
+}
+
+// GetAllForUser() returns every device a user has logged in from, most recently used
+// first.
+func (m KnownDeviceModel) GetAllForUser(userID int64) ([]*KnownDevice, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultKnownDeviceDBContextTimeout)
+	defer cancel()
+	rows, err := m.DB.GetKnownDevicesForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	devices := []*KnownDevice{}
+	for _, row := range rows {
+		devices = append(devices, &KnownDevice{
+			ID:          row.ID,
+			IPAddress:   row.IpAddress,
+			UserAgent:   row.UserAgent,
+			Revoked:     row.Revoked,
+			FirstSeenAt: row.FirstSeenAt,
+			LastSeenAt:  row.LastSeenAt,
+		})
+	}
+	return devices, nil
+}
+
+// RevokeAllForUser() stops trusting every device a user has logged in from, so the next
+// login from each of them is reported again. The devices are kept, so that a login from
+// a device the user has never used is still compared against them.
+func (m KnownDeviceModel) RevokeAllForUser(userID int64) error {
+	ctx, cancel := contextGenerator(context.Background(), DefaultKnownDeviceDBContextTimeout)
+	defer cancel()
+	return m.DB.RevokeKnownDevicesForUser(ctx, userID)
+}
@@ -0,0 +1,209 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Blue-Davinci/musical-zoe/internal/database"
+	"github.com/Blue-Davinci/musical-zoe/internal/validator"
+)
+
+type DigestSubscriptionModel struct {
+	DB *database.Queries
+}
+
+const (
+	DefaultDigestSubscriptionDBContextTimeout = 5 * time.Second
+	DefaultDigestCountry                      = "us"
+	DefaultDigestSendDay                      = time.Monday
+	DefaultDigestSendHour                     = 8
+	DefaultDigestTimezone                     = "UTC"
+	DefaultDigestMaxGenres                    = 5
+)
+
+// DigestGenres lists the genres the weekly digest can be tailored to.
+var DigestGenres = []string{"classical", "country", "electronic", "hip hop", "indie", "jazz", "metal", "pop", "r&b", "rock"}
+
+// countryCodeRX matches the two letter country codes accepted by News API.
+var countryCodeRX = regexp.MustCompile(`^[a-z]{2}$`)
+
+// DigestSubscription holds a user's weekly digest preferences. The digest is sent on
+// SendDay at SendHour o'clock in Timezone; NextSendAt is only set while subscribed.
+type DigestSubscription struct {
+	UserID     int64        `json:"-"`
+	Subscribed bool         `json:"subscribed"`
+	Genres     []string     `json:"genres"`
+	Country    string       `json:"country"`
+	SendDay    time.Weekday `json:"send_day"`
+	SendHour   int          `json:"send_hour"`
+	Timezone   string       `json:"timezone"`
+	NextSendAt *time.Time   `json:"next_send_at,omitempty"`
+	LastSentAt *time.Time   `json:"last_sent_at,omitempty"`
+	CreatedAt  time.Time    `json:"created_at"`
+	UpdatedAt  time.Time    `json:"updated_at"`
+}
+
+// DueDigest is a digest that is due to be sent, along with the user it goes to. Only
+// the user's ID, name, email and locale are filled in.
+type DueDigest struct {
+	Subscription *DigestSubscription
+	User         *User
+}
+
+// NewDigestSubscription() returns the default preferences for a user who hasn't opted in.
+func NewDigestSubscription(userID int64) *DigestSubscription {
+	return &DigestSubscription{
+		UserID:   userID,
+		Genres:   []string{},
+		Country:  DefaultDigestCountry,
+		SendDay:  DefaultDigestSendDay,
+		SendHour: DefaultDigestSendHour,
+		Timezone: DefaultDigestTimezone,
+	}
+}
+
+// Location() returns the subscription's time zone. Subscriptions are validated before
+// they are saved, so UTC is only returned if the zone has since disappeared.
+func (s *DigestSubscription) Location() *time.Location {
+	location, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return location
+}
+
+func ValidateDigestSubscription(v *validator.Validator, s *DigestSubscription) {
+	v.Check(len(s.Genres) <= DefaultDigestMaxGenres, "genres", "must not contain more than 5 genres")
+	v.Check(validator.Unique(s.Genres), "genres", "must not contain duplicate values")
+	for _, genre := range s.Genres {
+		if !validator.PermittedValue(genre, DigestGenres...) {
+			v.AddError("genres", "must only contain "+strings.Join(DigestGenres, ", "))
+			break
+		}
+	}
+	v.Check(validator.Matches(s.Country, countryCodeRX), "country", "must be a two letter country code")
+	v.Check(s.SendDay >= time.Sunday && s.SendDay <= time.Saturday, "send_day", "must be between 0 (Sunday) and 6 (Saturday)")
+	v.Check(s.SendHour >= 0 && s.SendHour <= 23, "send_hour", "must be between 0 and 23")
+	_, err := time.LoadLocation(s.Timezone)
+	v.Check(s.Timezone != "" && s.Timezone != "Local" && err == nil, "timezone", "must be an IANA time zone such as Europe/Paris")
+}
+
+func digestSubscriptionFromRow(row database.DigestSubscription) *DigestSubscription {
+	subscription := &DigestSubscription{
+		UserID:     row.UserID,
+		Subscribed: row.Subscribed,
+		Genres:     row.Genres,
+		Country:    row.Country,
+		SendDay:    time.Weekday(row.SendDay),
+		SendHour:   int(row.SendHour),
+		Timezone:   row.Timezone,
+		LastSentAt: fromNullTime(row.LastSentAt),
+		CreatedAt:  row.CreatedAt,
+		UpdatedAt:  row.UpdatedAt,
+	}
+	if subscription.Genres == nil {
+		subscription.Genres = []string{}
+	}
+	if row.Subscribed {
+		subscription.NextSendAt = &row.NextSendAt
+	}
+	return subscription
+}
+
+// Get() returns a user's digest preferences, or ErrGeneralRecordNotFound if they have
+// never opted in.
+func (m DigestSubscriptionModel) Get(userID int64) (*DigestSubscription, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultDigestSubscriptionDBContextTimeout)
+	defer cancel()
+	row, err := m.DB.GetDigestSubscription(ctx, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrGeneralRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return digestSubscriptionFromRow(row), nil
+}
+
+// Subscribe() saves the preferences and opts the user in, with the first digest going
+// out at nextSendAt. The subscription is refreshed from the stored row.
+func (m DigestSubscriptionModel) Subscribe(subscription *DigestSubscription, nextSendAt time.Time) error {
+	ctx, cancel := contextGenerator(context.Background(), DefaultDigestSubscriptionDBContextTimeout)
+	defer cancel()
+	row, err := m.DB.UpsertDigestSubscription(ctx, database.UpsertDigestSubscriptionParams{
+		UserID:     subscription.UserID,
+		Genres:     subscription.Genres,
+		Country:    subscription.Country,
+		SendDay:    int16(subscription.SendDay),
+		SendHour:   int16(subscription.SendHour),
+		Timezone:   subscription.Timezone,
+		NextSendAt: nextSendAt,
+	})
+	if err != nil {
+		return err
+	}
+	*subscription = *digestSubscriptionFromRow(row)
+	return nil
+}
+
+// Unsubscribe() opts the user out, keeping their preferences. It reports false if they
+// weren't subscribed.
+func (m DigestSubscriptionModel) Unsubscribe(userID int64) (bool, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultDigestSubscriptionDBContextTimeout)
+	defer cancel()
+	rows, err := m.DB.UnsubscribeDigest(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+// GetDue() returns up to limit digests that are due at now, oldest first. Digests for
+// users who are no longer activated are skipped.
+func (m DigestSubscriptionModel) GetDue(now time.Time, limit int) ([]*DueDigest, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultDigestSubscriptionDBContextTimeout)
+	defer cancel()
+	rows, err := m.DB.GetDueDigestSubscriptions(ctx, database.GetDueDigestSubscriptionsParams{
+		NextSendAt: now,
+		Limit:      int32(limit),
+	})
+	if err != nil {
+		return nil, err
+	}
+	digests := []*DueDigest{}
+	for _, row := range rows {
+		digests = append(digests, &DueDigest{
+			Subscription: digestSubscriptionFromRow(row.DigestSubscription),
+			User: &User{
+				ID:     row.DigestSubscription.UserID,
+				Name:   row.Name,
+				Email:  row.Email,
+				Locale: row.Locale,
+			},
+		})
+	}
+	return digests, nil
+}
+
+// Claim() moves a due digest on to nextSendAt, recording it as sent. It reports false
+// if the digest is no longer due at dueAt, because another instance has claimed it or
+// the user changed their preferences, in which case it must not be sent.
+func (m DigestSubscriptionModel) Claim(userID int64, dueAt, nextSendAt time.Time) (bool, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultDigestSubscriptionDBContextTimeout)
+	defer cancel()
+	rows, err := m.DB.ClaimDigestSubscription(ctx, database.ClaimDigestSubscriptionParams{
+		NextSendAt: nextSendAt,
+		UserID:     userID,
+		DueAt:      dueAt,
+	})
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
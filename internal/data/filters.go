@@ -0,0 +1,57 @@
+package data
+
+import (
+	"math"
+
+	"github.com/Blue-Davinci/musical-zoe/internal/validator"
+)
+
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+// Filters holds the pagination settings for a list endpoint.
+type Filters struct {
+	Page     int
+	PageSize int
+}
+
+// Metadata describes the page of results returned by a list endpoint.
+type Metadata struct {
+	CurrentPage  int   `json:"current_page,omitempty"`
+	PageSize     int   `json:"page_size,omitempty"`
+	FirstPage    int   `json:"first_page,omitempty"`
+	LastPage     int   `json:"last_page,omitempty"`
+	TotalRecords int64 `json:"total_records"`
+}
+
+func ValidateFilters(v *validator.Validator, f Filters) {
+	v.Check(f.Page > 0, "page", "must be greater than zero")
+	v.Check(f.Page <= 10_000_000, "page", "must be a maximum of 10 million")
+	v.Check(f.PageSize > 0, "page_size", "must be greater than zero")
+	v.Check(f.PageSize <= MaxPageSize, "page_size", "must be a maximum of 100")
+}
+
+func (f Filters) limit() int32 {
+	return int32(f.PageSize)
+}
+
+func (f Filters) offset() int32 {
+	return int32((f.Page - 1) * f.PageSize)
+}
+
+// calculateMetadata() works out the pagination metadata from the total number of
+// matching records. An empty Metadata is returned when nothing matched.
+func calculateMetadata(totalRecords int64, page, pageSize int) Metadata {
+	if totalRecords == 0 {
+		return Metadata{}
+	}
+	return Metadata{
+		CurrentPage:  page,
+		PageSize:     pageSize,
+		FirstPage:    1,
+		LastPage:     int(math.Ceil(float64(totalRecords) / float64(pageSize))),
+		TotalRecords: totalRecords,
+	}
+}
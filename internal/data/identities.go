@@ -0,0 +1,195 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/Blue-Davinci/musical-zoe/internal/database"
+)
+
+type IdentityModel struct {
+	DB *database.Queries
+}
+
+const (
+	DefaultIdentityDBContextTimeout  = 5 * time.Second
+	DefaultOIDCAuthRequestExpiryTime = 10 * time.Minute
+)
+
+var (
+	ErrDuplicateIdentity = errors.New("identity already linked")
+)
+
+// Identity is an account at an external OpenID Connect provider that has been linked to
+// a user, letting them sign in through that provider.
+type Identity struct {
+	ID          int64     `json:"id"`
+	UserID      int64     `json:"-"`
+	Provider    string    `json:"provider"`
+	Subject     string    `json:"-"`
+	Email       string    `json:"email"`
+	CreatedAt   time.Time `json:"created_at"`
+	LastLoginAt time.Time `json:"last_login_at"`
+}
+
+// AuthRequest holds the secrets of an in-flight provider login that are needed again
+// when the provider redirects back to us.
+type AuthRequest struct {
+	Provider     string
+	CodeVerifier string
+	Nonce        string
+}
+
+// Link() links a provider account to a user. It returns ErrDuplicateIdentity if the
+// provider account is already linked, to this or any other user.
+func (m IdentityModel) Link(userID int64, provider, subject, email string) (*Identity, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultIdentityDBContextTimeout)
+	defer cancel()
+	row, err := m.DB.InsertUserIdentity(ctx, database.InsertUserIdentityParams{
+		UserID:   userID,
+		Provider: provider,
+		Subject:  subject,
+		Email:    email,
+	})
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "user_identities_provider_subject_key"):
+			return nil, ErrDuplicateIdentity
+		default:
+			return nil, err
+		}
+	}
+	return &Identity{
+		ID:          row.ID,
+		UserID:      userID,
+		Provider:    provider,
+		Subject:     subject,
+		Email:       email,
+		CreatedAt:   row.CreatedAt,
+		LastLoginAt: row.LastLoginAt,
+	}, nil
+}
+
+// GetUser() returns the user a provider account is linked to.
+func (m IdentityModel) GetUser(provider, subject string) (*User, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultIdentityDBContextTimeout)
+	defer cancel()
+	row, err := m.DB.GetUserForIdentity(ctx, database.GetUserForIdentityParams{
+		Provider: provider,
+		Subject:  subject,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrGeneralRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return populateUser(row.User), nil
+}
+
+// RecordLogin() notes a successful login through a linked identity, keeping the email
+// the provider reported up to date.
+func (m IdentityModel) RecordLogin(provider, subject, email string) error {
+	ctx, cancel := contextGenerator(context.Background(), DefaultIdentityDBContextTimeout)
+	defer cancel()
+	return m.DB.UpdateUserIdentityLogin(ctx, database.UpdateUserIdentityLoginParams{
+		Email:    email,
+		Provider: provider,
+		Subject:  subject,
+	})
+}
+
+// GetAllForUser() returns the identities linked to a user, oldest first.
+func (m IdentityModel) GetAllForUser(userID int64) ([]*Identity, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultIdentityDBContextTimeout)
+	defer cancel()
+	rows, err := m.DB.GetUserIdentitiesForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	identities := []*Identity{}
+	for _, row := range rows {
+		identities = append(identities, &Identity{
+			ID:          row.ID,
+			UserID:      row.UserID,
+			Provider:    row.Provider,
+			Subject:     row.Subject,
+			Email:       row.Email,
+			CreatedAt:   row.CreatedAt,
+			LastLoginAt: row.LastLoginAt,
+		})
+	}
+	return identities, nil
+}
+
+// DeleteForUser() unlinks an identity, returning ErrGeneralRecordNotFound if the user
+// has no identity with that ID.
+func (m IdentityModel) DeleteForUser(identityID, userID int64) error {
+	ctx, cancel := contextGenerator(context.Background(), DefaultIdentityDBContextTimeout)
+	defer cancel()
+	rows, err := m.DB.DeleteUserIdentityForUser(ctx, database.DeleteUserIdentityForUserParams{
+		ID:     identityID,
+		UserID: userID,
+	})
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrGeneralRecordNotFound
+	}
+	return nil
+}
+
+// SaveAuthRequest() stores an in-flight provider login under its state value. Only a
+// hash of the state is kept, as we do for tokens.
+func (m IdentityModel) SaveAuthRequest(state string, request *AuthRequest) error {
+	ctx, cancel := contextGenerator(context.Background(), DefaultIdentityDBContextTimeout)
+	defer cancel()
+	hash := sha256.Sum256([]byte(state))
+	return m.DB.InsertOIDCAuthRequest(ctx, database.InsertOIDCAuthRequestParams{
+		StateHash:    hash[:],
+		Provider:     request.Provider,
+		CodeVerifier: request.CodeVerifier,
+		Nonce:        request.Nonce,
+		Expiry:       time.Now().Add(DefaultOIDCAuthRequestExpiryTime),
+	})
+}
+
+// ConsumeAuthRequest() fetches and deletes the login matching a state value, so that
+// each one can only complete once.
+func (m IdentityModel) ConsumeAuthRequest(state string) (*AuthRequest, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultIdentityDBContextTimeout)
+	defer cancel()
+	hash := sha256.Sum256([]byte(state))
+	row, err := m.DB.DeleteOIDCAuthRequest(ctx, database.DeleteOIDCAuthRequestParams{
+		StateHash: hash[:],
+		Expiry:    time.Now(),
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrGeneralRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &AuthRequest{
+		Provider:     row.Provider,
+		CodeVerifier: row.CodeVerifier,
+		Nonce:        row.Nonce,
+	}, nil
+}
+
+// DeleteExpiredAuthRequests() removes provider logins that were started but never
+// completed, returning how many were removed.
+func (m IdentityModel) DeleteExpiredAuthRequests() (int64, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultIdentityDBContextTimeout)
+	defer cancel()
+	return m.DB.DeleteExpiredOIDCAuthRequests(ctx, time.Now())
+}
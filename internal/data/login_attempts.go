@@ -0,0 +1,110 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/Blue-Davinci/musical-zoe/internal/database"
+)
+
+type LoginAttemptModel struct {
+	DB *database.Queries
+}
+
+const (
+	DefaultLoginAttemptDBContextTimeout = 5 * time.Second
+	DefaultLoginLockoutThreshold        = 5
+	DefaultLoginLockoutWindow           = 15 * time.Minute
+	DefaultLoginLockoutDuration         = 15 * time.Minute
+	DefaultLoginIPThreshold             = 50
+)
+
+// RecordFailure() stores a failed login for an email address and IP address and
+// returns how many failures that email has had since the given time, including this one.
+func (m LoginAttemptModel) RecordFailure(email, ipAddress string, since time.Time) (int64, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultLoginAttemptDBContextTimeout)
+	defer cancel()
+	err := m.DB.InsertLoginFailure(ctx, database.InsertLoginFailureParams{
+		Email:     email,
+		IpAddress: ipAddress,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return m.DB.CountLoginFailuresForEmail(ctx, database.CountLoginFailuresForEmailParams{
+		Email:     email,
+		CreatedAt: since,
+	})
+}
+
+// CountFailuresForIP() returns how many failed logins came from an IP address since the
+// given time, across all email addresses.
+func (m LoginAttemptModel) CountFailuresForIP(ipAddress string, since time.Time) (int64, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultLoginAttemptDBContextTimeout)
+	defer cancel()
+	return m.DB.CountLoginFailuresForIP(ctx, database.CountLoginFailuresForIPParams{
+		IpAddress: ipAddress,
+		CreatedAt: since,
+	})
+}
+
+// Lock() locks logins for an email address until the given time.
+func (m LoginAttemptModel) Lock(email string, until time.Time) error {
+	ctx, cancel := contextGenerator(context.Background(), DefaultLoginAttemptDBContextTimeout)
+	defer cancel()
+	return m.DB.UpsertLoginLockout(ctx, database.UpsertLoginLockoutParams{
+		Email:       email,
+		LockedUntil: until,
+	})
+}
+
+// LockedUntil() reports whether logins for an email address are currently locked, and
+// if so until when.
+func (m LoginAttemptModel) LockedUntil(email string) (time.Time, bool, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultLoginAttemptDBContextTimeout)
+	defer cancel()
+	lockedUntil, err := m.DB.GetLoginLockout(ctx, database.GetLoginLockoutParams{
+		Email:       email,
+		LockedUntil: time.Now(),
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return time.Time{}, false, nil
+		default:
+			return time.Time{}, false, err
+		}
+	}
+	return lockedUntil, true, nil
+}
+
+// Clear() forgets the failed logins and any lockout for an email address. It is called
+// after a successful login or password reset.
+func (m LoginAttemptModel) Clear(email string) error {
+	ctx, cancel := contextGenerator(context.Background(), DefaultLoginAttemptDBContextTimeout)
+	defer cancel()
+	err := m.DB.DeleteLoginFailuresForEmail(ctx, email)
+	if err != nil {
+		return err
+	}
+	return m.DB.DeleteLoginLockout(ctx, email)
+}
+
+// Purge() removes failed logins recorded before olderThan and lockouts that have run
+// out, returning how many rows were removed. Failed logins only count towards a lockout
+// within the lockout window, so anything older than that can go.
+func (m LoginAttemptModel) Purge(olderThan time.Time) (int64, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultLoginAttemptDBContextTimeout)
+	defer cancel()
+	attempts, err := m.DB.DeleteLoginFailuresBefore(ctx, olderThan)
+	if err != nil {
+		return 0, err
+	}
+	lockouts, err := m.DB.DeleteExpiredLoginLockouts(ctx, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	return attempts + lockouts, nil
+}
@@ -0,0 +1,106 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"image/png"
+	"time"
+
+	"github.com/Blue-Davinci/musical-zoe/internal/database"
+	"github.com/Blue-Davinci/musical-zoe/internal/validator"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+const (
+	DefaultMFALoginTokenExpiryTime = 5 * time.Minute
+	DefaultMFAQRCodeSize           = 256
+	// DefaultMFAMaxAttempts is how many wrong codes can be entered against one mfa-login
+	// token before it is deleted.
+	DefaultMFAMaxAttempts = 5
+	// DefaultTOTPPeriod is how long each TOTP code is valid for. Codes from the periods
+	// either side of the current one are accepted to allow for clock drift.
+	DefaultTOTPPeriod = 30
+)
+
+// MFASetup holds everything a client needs to enroll a TOTP authenticator app. The
+// Secret is what gets persisted against the user, while the URL and QRCode are only
+// ever returned once during enrollment.
+type MFASetup struct {
+	Secret string `json:"secret"`
+	URL    string `json:"otpauth_url"`
+	QRCode string `json:"qr_code"`
+}
+
+// ValidateTOTPCode() checks that a TOTP code has been provided and is a 6 digit number.
+func ValidateTOTPCode(v *validator.Validator, code string) {
+	v.Check(code != "", "code", "must be provided")
+	v.Check(validator.Matches(code, validator.TOTPCodeRX), "code", "must be a 6 digit code")
+}
+
+// GenerateMFASetup() creates a new TOTP secret for the given account name and returns
+// the otpauth:// URL alongside a base64 encoded PNG QR code data URI of that URL.
+func GenerateMFASetup(issuer, accountName string) (*MFASetup, error) {
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      issuer,
+		AccountName: accountName,
+	})
+	if err != nil {
+		return nil, err
+	}
+	// render the key as a QR code image and encode it as a png
+	img, err := key.Image(DefaultMFAQRCodeSize, DefaultMFAQRCodeSize)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	err = png.Encode(&buf, img)
+	if err != nil {
+		return nil, err
+	}
+	return &MFASetup{
+		Secret: key.Secret(),
+		URL:    key.URL(),
+		QRCode: "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()),
+	}, nil
+}
+
+// MatchTOTP() reports whether the supplied code is valid for the user's MFA secret at
+// time t and, if it is, returns the time step the code belongs to. A user without a
+// secret can never pass verification. It does not stop a code from being used twice,
+// see UseTOTPStep() for that.
+func (u *User) MatchTOTP(code string, t time.Time) (int64, bool) {
+	if u.MFASecret == "" {
+		return 0, false
+	}
+	opts := totp.ValidateOpts{
+		Period:    DefaultTOTPPeriod,
+		Digits:    otp.DigitsSix,
+		Algorithm: otp.AlgorithmSHA1,
+	}
+	for _, skew := range []int64{0, -1, 1} {
+		at := t.Add(time.Duration(skew*DefaultTOTPPeriod) * time.Second)
+		ok, err := totp.ValidateCustom(code, u.MFASecret, at, opts)
+		if err == nil && ok {
+			return at.Unix() / DefaultTOTPPeriod, true
+		}
+	}
+	return 0, false
+}
+
+// UseTOTPStep() records that the user has used the code for a TOTP time step. It
+// reports false if that step, or a later one, has already been used, in which case the
+// code is a replay and must be rejected.
+func (m UserModel) UseTOTPStep(userID, step int64) (bool, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultUserManagerDBContextTimeout)
+	defer cancel()
+	rows, err := m.DB.UseMFAStep(ctx, database.UseMFAStepParams{
+		UserID: userID,
+		Step:   step,
+	})
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
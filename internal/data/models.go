@@ -12,13 +12,31 @@ var (
 )
 
 type Models struct {
-	Users  UserModel
-	Tokens TokenModel
+	Users         UserModel
+	Tokens        TokenModel
+	Permissions   PermissionModel
+	ApiKeys       PersonalApiKeyModel
+	LoginAttempts LoginAttemptModel
+	Identities    IdentityModel
+	AuditEvents   AuditEventModel
+	KnownDevices  KnownDeviceModel
+	Contact       ContactMessageModel
+	EmailOutbox   EmailOutboxModel
+	Digests       DigestSubscriptionModel
 }
 
 func NewModels(db *database.Queries) Models {
 	return Models{
-		Users:  UserModel{DB: db},
-		Tokens: TokenModel{DB: db},
+		Users:         UserModel{DB: db},
+		Tokens:        TokenModel{DB: db},
+		Permissions:   PermissionModel{DB: db},
+		ApiKeys:       PersonalApiKeyModel{DB: db},
+		LoginAttempts: LoginAttemptModel{DB: db},
+		Identities:    IdentityModel{DB: db},
+		AuditEvents:   AuditEventModel{DB: db},
+		KnownDevices:  KnownDeviceModel{DB: db},
+		Contact:       ContactMessageModel{DB: db},
+		EmailOutbox:   EmailOutboxModel{DB: db},
+		Digests:       DigestSubscriptionModel{DB: db},
 	}
 }
@@ -0,0 +1,290 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/Blue-Davinci/musical-zoe/internal/database"
+	"github.com/Blue-Davinci/musical-zoe/internal/validator"
+)
+
+type EmailOutboxModel struct {
+	DB *database.Queries
+}
+
+const (
+	DefaultEmailOutboxDBContextTimeout = 5 * time.Second
+	DefaultEmailOutboxWorkers          = 2
+	DefaultEmailOutboxPollInterval     = 2 * time.Second
+	DefaultEmailOutboxMaxAttempts      = 8
+	DefaultEmailOutboxBaseBackoff      = 30 * time.Second
+	DefaultEmailOutboxMaxBackoff       = 2 * time.Hour
+	DefaultEmailOutboxLease            = 2 * time.Minute
+	DefaultEmailOutboxRetention        = 7 * 24 * time.Hour
+)
+
+// Define constants for the states an outbox message moves through. A message is pending
+// until a worker claims it, sending while a worker holds it, and then either sent or,
+// once it has run out of attempts, dead.
+const (
+	EmailOutboxStatusPending = "pending"
+	EmailOutboxStatusSending = "sending"
+	EmailOutboxStatusSent    = "sent"
+	EmailOutboxStatusDead    = "dead"
+)
+
+// EmailOutboxStatuses lists every outbox status, for validating filters.
+var EmailOutboxStatuses = []string{
+	EmailOutboxStatusPending,
+	EmailOutboxStatusSending,
+	EmailOutboxStatusSent,
+	EmailOutboxStatusDead,
+}
+
+// EmailOutboxMessage is a queued email. The bodies and extra headers often contain
+// single-use links, so they are never written out in JSON and are cleared once the
+// message has been sent.
+type EmailOutboxMessage struct {
+	ID            int64             `json:"id"`
+	MessageID     string            `json:"message_id"`
+	Recipient     string            `json:"recipient"`
+	Sender        string            `json:"-"`
+	Template      string            `json:"template"`
+	Subject       string            `json:"subject"`
+	PlainBody     string            `json:"-"`
+	HTMLBody      string            `json:"-"`
+	Headers       map[string]string `json:"-"`
+	Status        string            `json:"status"`
+	Attempts      int32             `json:"attempts"`
+	LastError     string            `json:"last_error,omitempty"`
+	NextAttemptAt time.Time         `json:"next_attempt_at"`
+	SentAt        *time.Time        `json:"sent_at,omitempty"`
+	CreatedAt     time.Time         `json:"created_at"`
+	UpdatedAt     time.Time         `json:"updated_at"`
+}
+
+// EmailOutboxFilters narrows down the messages returned by GetAll(). Empty fields match
+// every message.
+type EmailOutboxFilters struct {
+	Status    string
+	Recipient string
+}
+
+func ValidateEmailOutboxFilters(v *validator.Validator, f EmailOutboxFilters) {
+	if f.Status != "" {
+		v.Check(validator.PermittedValue(f.Status, EmailOutboxStatuses...), "status", "must be pending, sending, sent or dead")
+	}
+	if f.Recipient != "" {
+		v.Check(validator.Matches(f.Recipient, validator.EmailRX), "recipient", "must be a valid email address")
+	}
+}
+
+func emailOutboxMessageFromRow(row database.EmailOutbox) (*EmailOutboxMessage, error) {
+	var headers map[string]string
+	err := json.Unmarshal(row.Headers, &headers)
+	if err != nil {
+		return nil, err
+	}
+	return &EmailOutboxMessage{
+		ID:            row.ID,
+		MessageID:     row.MessageID,
+		Recipient:     row.Recipient,
+		Sender:        row.Sender,
+		Template:      row.Template,
+		Subject:       row.Subject,
+		PlainBody:     row.PlainBody,
+		HTMLBody:      row.HtmlBody,
+		Headers:       headers,
+		Status:        row.Status,
+		Attempts:      row.Attempts,
+		LastError:     row.LastError,
+		NextAttemptAt: row.NextAttemptAt,
+		SentAt:        fromNullTime(row.SentAt),
+		CreatedAt:     row.CreatedAt,
+		UpdatedAt:     row.UpdatedAt,
+	}, nil
+}
+
+// Insert() queues a rendered message for delivery, filling in its ID and status.
+func (m EmailOutboxModel) Insert(message *EmailOutboxMessage) error {
+	ctx, cancel := contextGenerator(context.Background(), DefaultEmailOutboxDBContextTimeout)
+	defer cancel()
+	headers := []byte("{}")
+	if len(message.Headers) > 0 {
+		var err error
+		headers, err = json.Marshal(message.Headers)
+		if err != nil {
+			return err
+		}
+	}
+	row, err := m.DB.InsertEmailOutboxMessage(ctx, database.InsertEmailOutboxMessageParams{
+		MessageID: message.MessageID,
+		Recipient: message.Recipient,
+		Sender:    message.Sender,
+		Template:  message.Template,
+		Subject:   message.Subject,
+		PlainBody: message.PlainBody,
+		HtmlBody:  message.HTMLBody,
+		Headers:   headers,
+		CreatedAt: message.CreatedAt,
+	})
+	if err != nil {
+		return err
+	}
+	message.ID = row.ID
+	message.Status = row.Status
+	message.NextAttemptAt = row.NextAttemptAt
+	message.UpdatedAt = row.UpdatedAt
+	return nil
+}
+
+// Claim() hands the next due message to a worker, counting the attempt. The message is
+// leased to the worker until lockedUntil; if the worker dies without reporting back,
+// the message becomes claimable again once the lease runs out. It returns
+// ErrGeneralRecordNotFound when nothing is due.
+func (m EmailOutboxModel) Claim(lockedUntil time.Time) (*EmailOutboxMessage, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultEmailOutboxDBContextTimeout)
+	defer cancel()
+	row, err := m.DB.ClaimEmailOutboxMessage(ctx, sql.NullTime{Time: lockedUntil, Valid: true})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrGeneralRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return emailOutboxMessageFromRow(row)
+}
+
+// MarkSent() records that a claimed message was delivered and clears its bodies and
+// headers.
+func (m EmailOutboxModel) MarkSent(id int64) error {
+	ctx, cancel := contextGenerator(context.Background(), DefaultEmailOutboxDBContextTimeout)
+	defer cancel()
+	_, err := m.DB.MarkEmailOutboxMessageSent(ctx, id)
+	return err
+}
+
+// MarkFailed() records a failed delivery of a claimed message. The message is either
+// rescheduled for nextAttemptAt or, if dead is true, dead-lettered.
+func (m EmailOutboxModel) MarkFailed(id int64, lastError string, nextAttemptAt time.Time, dead bool) error {
+	ctx, cancel := contextGenerator(context.Background(), DefaultEmailOutboxDBContextTimeout)
+	defer cancel()
+	status := EmailOutboxStatusPending
+	if dead {
+		status = EmailOutboxStatusDead
+	}
+	_, err := m.DB.MarkEmailOutboxMessageFailed(ctx, database.MarkEmailOutboxMessageFailedParams{
+		ID:            id,
+		Status:        status,
+		LastError:     lastError,
+		NextAttemptAt: nextAttemptAt,
+	})
+	return err
+}
+
+// Get() returns a single queued message.
+func (m EmailOutboxModel) Get(id int64) (*EmailOutboxMessage, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultEmailOutboxDBContextTimeout)
+	defer cancel()
+	row, err := m.DB.GetEmailOutboxMessage(ctx, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrGeneralRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return emailOutboxMessageFromRow(row)
+}
+
+// GetAll() returns a page of queued messages matching the filters, newest first, along
+// with the pagination metadata.
+func (m EmailOutboxModel) GetAll(outboxFilters EmailOutboxFilters, filters Filters) ([]*EmailOutboxMessage, Metadata, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultEmailOutboxDBContextTimeout)
+	defer cancel()
+	totalRecords, err := m.DB.CountEmailOutboxMessages(ctx, database.CountEmailOutboxMessagesParams{
+		Status:    outboxFilters.Status,
+		Recipient: outboxFilters.Recipient,
+	})
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	rows, err := m.DB.ListEmailOutboxMessages(ctx, database.ListEmailOutboxMessagesParams{
+		Status:    outboxFilters.Status,
+		Recipient: outboxFilters.Recipient,
+		Limit:     filters.limit(),
+		Offset:    filters.offset(),
+	})
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	messages := []*EmailOutboxMessage{}
+	for _, row := range rows {
+		message, err := emailOutboxMessageFromRow(row)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		messages = append(messages, message)
+	}
+	return messages, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+// CountByStatus() returns how many messages are in each status. Every status is present
+// in the result, even when no messages have it.
+func (m EmailOutboxModel) CountByStatus() (map[string]int64, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultEmailOutboxDBContextTimeout)
+	defer cancel()
+	rows, err := m.DB.CountEmailOutboxMessagesByStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int64, len(EmailOutboxStatuses))
+	for _, status := range EmailOutboxStatuses {
+		counts[status] = 0
+	}
+	for _, row := range rows {
+		counts[row.Status] = row.Count
+	}
+	return counts, nil
+}
+
+// Retry() moves a dead message back into the queue with a fresh set of attempts. It
+// reports false if the message is not dead.
+func (m EmailOutboxModel) Retry(id int64) (bool, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultEmailOutboxDBContextTimeout)
+	defer cancel()
+	rows, err := m.DB.RetryEmailOutboxMessage(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+// RetryAllDead() moves every dead message back into the queue, returning how many there
+// were.
+func (m EmailOutboxModel) RetryAllDead() (int64, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultEmailOutboxDBContextTimeout)
+	defer cancel()
+	return m.DB.RetryDeadEmailOutboxMessages(ctx)
+}
+
+// DeleteSentBefore() removes messages that were sent before the cutoff.
+func (m EmailOutboxModel) DeleteSentBefore(cutoff time.Time) (int64, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultEmailOutboxDBContextTimeout)
+	defer cancel()
+	return m.DB.DeleteSentEmailOutboxMessagesBefore(ctx, sql.NullTime{Time: cutoff, Valid: true})
+}
+
+// DeleteDeadBefore() removes messages that were dead-lettered before the cutoff, along
+// with the bodies and headers they were kept with so that they could be retried.
+func (m EmailOutboxModel) DeleteDeadBefore(cutoff time.Time) (int64, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultEmailOutboxDBContextTimeout)
+	defer cancel()
+	return m.DB.DeleteDeadEmailOutboxMessagesBefore(ctx, cutoff)
+}
@@ -0,0 +1,65 @@
+package data
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/Blue-Davinci/musical-zoe/internal/database"
+)
+
+type PermissionModel struct {
+	DB *database.Queries
+}
+
+const (
+	DefaultPermissionDBContextTimeout = 5 * time.Second
+)
+
+// Define constants for the permission codes seeded by the permissions migration.
+const (
+	PermissionMetricsRead   = "metrics:read"
+	PermissionAdminRead     = "admin:read"
+	PermissionAdminWrite    = "admin:write"
+	PermissionPremiumAccess = "premium:access"
+)
+
+// Permissions holds the permission codes (like "admin:read") granted to a single user.
+type Permissions []string
+
+// Include() checks whether the Permissions slice contains a specific permission code.
+func (p Permissions) Include(code string) bool {
+	return slices.Contains(p, code)
+}
+
+// GetAllForUser() returns all of the permission codes granted to a specific user.
+func (m PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultPermissionDBContextTimeout)
+	defer cancel()
+	codes, err := m.DB.GetAllPermissionsForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return Permissions(codes), nil
+}
+
+// AddForUser() grants the provided permission codes to a user. Unknown codes are ignored
+// and granting a permission the user already has is a no-op.
+func (m PermissionModel) AddForUser(userID int64, codes ...string) error {
+	ctx, cancel := contextGenerator(context.Background(), DefaultPermissionDBContextTimeout)
+	defer cancel()
+	return m.DB.AddPermissionsForUser(ctx, database.AddPermissionsForUserParams{
+		UserID: userID,
+		Codes:  codes,
+	})
+}
+
+// RemoveForUser() revokes the provided permission codes from a user.
+func (m PermissionModel) RemoveForUser(userID int64, codes ...string) error {
+	ctx, cancel := contextGenerator(context.Background(), DefaultPermissionDBContextTimeout)
+	defer cancel()
+	return m.DB.RemovePermissionsForUser(ctx, database.RemovePermissionsForUserParams{
+		UserID: userID,
+		Codes:  codes,
+	})
+}
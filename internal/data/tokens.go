@@ -4,7 +4,10 @@ import (
 	"context"
 	"crypto/rand"
 	"crypto/sha256"
+	"database/sql"
 	"encoding/base32"
+	"errors"
+	"strings"
 	"time"
 
 	"github.com/Blue-Davinci/musical-zoe/internal/database"
@@ -16,8 +19,19 @@ type TokenModel struct {
 }
 
 const (
-	DefaultTokenExpiryTime       = 72 * time.Hour
-	DefaultTokenDBContextTimeout = 5 * time.Second
+	DefaultAccessTokenExpiryTime        = 15 * time.Minute
+	DefaultRefreshTokenExpiryTime       = 30 * 24 * time.Hour
+	DefaultActivationTokenExpiryTime    = 3 * 24 * time.Hour
+	DefaultPasswordResetTokenExpiryTime = 45 * time.Minute
+	DefaultEmailChangeTokenExpiryTime   = 24 * time.Hour
+	DefaultMagicLinkTokenExpiryTime     = 15 * time.Minute
+	DefaultMagicLinkResendInterval      = time.Minute
+	DefaultRevokeSessionsExpiryTime     = 7 * 24 * time.Hour
+	DefaultUnsubscribeTokenExpiryTime   = 60 * 24 * time.Hour
+	DefaultRecoveryCodeExpiryTime       = 10 * 365 * 24 * time.Hour
+	DefaultRecoveryCodeCount            = 10
+	DefaultSessionLastUsedInterval      = time.Minute
+	DefaultTokenDBContextTimeout        = 5 * time.Second
 )
 
 // Define constants for the token scope.
@@ -27,17 +41,62 @@ const (
 	ScopePasswordReset  = "password-reset"
 	ScopeMFALogin       = "mfa-login"
 	ScopeRecovery       = "recovery-codes"
+	ScopeEmailChange    = "email-change"
+	ScopeEmailCancel    = "email-change-cancel"
+	ScopeRefresh        = "refresh"
+	ScopeMagicLink      = "magic-link"
+	ScopeRevokeSessions = "revoke-sessions"
+	ScopeUnsubscribe    = "digest-unsubscribe"
+)
+
+// RevocableScopes are the token scopes removed whenever all of a user's tokens are
+// revoked, be it after a password reset, a reported login or by an operator: every live
+// session, any login still in progress and any pending password reset or email change.
+// Activation tokens, recovery codes and unsubscribe tokens are left alone as none of them
+// can be used to act as the user.
+var RevocableScopes = []string{
+	ScopeAuthentication,
+	ScopeRefresh,
+	ScopeMFALogin,
+	ScopeMagicLink,
+	ScopeRevokeSessions,
+	ScopePasswordReset,
+	ScopeEmailChange,
+	ScopeEmailCancel,
+}
+
+var (
+	// ErrRefreshTokenReused is returned when a refresh token that has already been
+	// rotated is presented again, which means it has most likely been stolen.
+	ErrRefreshTokenReused = errors.New("refresh token reused")
 )
 
 // Define a Token struct to hold the data for an individual token. This includes the
 // plaintext and hashed versions of the token, associated user ID, expiry time and
 // scope.
 type Token struct {
+	ID        int64     `json:"-"`
 	Plaintext string    `json:"token"`
 	Hash      []byte    `json:"-"`
 	UserID    int64     `json:"-"`
 	Expiry    time.Time `json:"expiry"`
 	Scope     string    `json:"-"`
+	IPAddress string    `json:"-"`
+	UserAgent string    `json:"-"`
+	FamilyID  string    `json:"-"`
+	CreatedAt time.Time `json:"-"`
+}
+
+// Session is the client facing view of an authentication token. It never exposes the
+// token itself, only the metadata a user needs to recognise and revoke a login.
+type Session struct {
+	ID         int64     `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	Expiry     time.Time `json:"expiry"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	IPAddress  string    `json:"ip_address"`
+	UserAgent  string    `json:"user_agent"`
+	Current    bool      `json:"current"`
 }
 
 // Check that the plaintext token has been provided and is exactly 26 bytes long.
@@ -46,6 +105,19 @@ func ValidateTokenPlaintext(v *validator.Validator, tokenPlaintext string) {
 	v.Check(len(tokenPlaintext) == 26, "token", "must be valid")
 }
 
+// Check that a recovery code has been provided and looks like one we generated. Codes
+// are accepted with or without the separating dash and in any letter case.
+func ValidateRecoveryCode(v *validator.Validator, code string) {
+	v.Check(code != "", "recovery_code", "must be provided")
+	v.Check(len(normalizeRecoveryCode(code)) == 10, "recovery_code", "must be valid")
+}
+
+// normalizeRecoveryCode() strips the dash and upper-cases a recovery code so that the
+// same code always produces the same hash regardless of how the user typed it.
+func normalizeRecoveryCode(code string) string {
+	return strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+}
+
 // Create a Token instance containing the user ID, expiry, and scope information.
 // We add the provided ttl (time-to-live) duration parameter to the
 // current time to get the expiry time
@@ -83,17 +155,119 @@ func (m TokenModel) New(userID int64, ttl time.Duration, scope string) (*Token,
 	return api_key, err
 }
 
+// NewSession() creates a short-lived authentication token and a long-lived refresh
+// token for the same login, recording the IP address and user-agent of the client so
+// that the session can later be listed and revoked. Both tokens share a family ID; an
+// empty familyID starts a new family, while a refresh passes the existing one along.
+func (m TokenModel) NewSession(userID int64, accessTTL, refreshTTL time.Duration, familyID, ipAddress, userAgent string) (*Token, *Token, error) {
+	if familyID == "" {
+		var err error
+		familyID, err = generateFamilyID()
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	tokens := make([]*Token, 0, 2)
+	for _, t := range []struct {
+		scope string
+		ttl   time.Duration
+	}{{ScopeAuthentication, accessTTL}, {ScopeRefresh, refreshTTL}} {
+		api_key, err := generateToken(userID, t.ttl, t.scope)
+		if err != nil {
+			return nil, nil, err
+		}
+		api_key.FamilyID = familyID
+		api_key.IPAddress = ipAddress
+		api_key.UserAgent = userAgent
+		err = m.Insert(api_key)
+		if err != nil {
+			return nil, nil, err
+		}
+		tokens = append(tokens, api_key)
+	}
+	return tokens[0], tokens[1], nil
+}
+
+// generateFamilyID() returns a random identifier for a new token family.
+func generateFamilyID() (string, error) {
+	randomBytes := make([]byte, 16)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", err
+	}
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes), nil
+}
+
+// Rotate() exchanges a refresh token. The presented token is marked as rotated, rather
+// than deleted, so that it is recognised if it is ever used again, and the access
+// tokens issued alongside it are retired. The returned token carries the user and
+// family to issue the replacement pair for. If the token had already been rotated the
+// whole family is revoked and ErrRefreshTokenReused is returned.
+func (m TokenModel) Rotate(refreshTokenPlaintext string) (*Token, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultTokenDBContextTimeout)
+	defer cancel()
+	hash := sha256.Sum256([]byte(refreshTokenPlaintext))
+	row, err := m.DB.GetRefreshToken(ctx, database.GetRefreshTokenParams{
+		ApiKey: hash[:],
+		Scope:  ScopeRefresh,
+		Expiry: time.Now(),
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrGeneralRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	token := &Token{ID: row.ID, UserID: row.UserID, FamilyID: row.FamilyID, Scope: ScopeRefresh}
+	if !row.RotatedAt.Valid {
+		// the rotated_at IS NULL guard makes sure only one of two concurrent
+		// refreshes with the same token can win
+		rows, err := m.DB.MarkApiKeyRotated(ctx, database.MarkApiKeyRotatedParams{
+			RotatedAt: sql.NullTime{Time: time.Now(), Valid: true},
+			ID:        row.ID,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if rows == 1 {
+			err = m.DB.DeleteApiKeysForFamily(ctx, database.DeleteApiKeysForFamilyParams{
+				FamilyID: row.FamilyID,
+				Scope:    ScopeAuthentication,
+			})
+			if err != nil {
+				return nil, err
+			}
+			return token, nil
+		}
+	}
+	_, err = m.DB.DeleteApiKeyFamily(ctx, row.FamilyID)
+	if err != nil {
+		return nil, err
+	}
+	return token, ErrRefreshTokenReused
+}
+
 func (m TokenModel) Insert(api_key *Token) error {
 	// create our timeout context. All of them will just be 5 seconds
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	_, err := m.DB.InsertApiKey(ctx, database.InsertApiKeyParams{
-		ApiKey: api_key.Hash,
-		UserID: api_key.UserID,
-		Expiry: api_key.Expiry,
-		Scope:  api_key.Scope,
+	row, err := m.DB.InsertApiKey(ctx, database.InsertApiKeyParams{
+		ApiKey:    api_key.Hash,
+		UserID:    api_key.UserID,
+		Expiry:    api_key.Expiry,
+		Scope:     api_key.Scope,
+		IpAddress: api_key.IPAddress,
+		UserAgent: api_key.UserAgent,
+		FamilyID:  api_key.FamilyID,
 	})
-	return err
+	if err != nil {
+		return err
+	}
+	api_key.ID = row.ID
+	api_key.CreatedAt = row.CreatedAt
+	return nil
 }
 
 // DeleteAllForUser() deletes all tokens for a specific user and scope.
@@ -107,3 +281,223 @@ func (m TokenModel) DeleteAllForUser(scope string, userID int64) error {
 	})
 	return err
 }
+
+// DeleteEveryScopeForUser() deletes every token a user holds, whatever its scope.
+func (m TokenModel) DeleteEveryScopeForUser(userID int64) error {
+	ctx, cancel := contextGenerator(context.Background(), DefaultTokenDBContextTimeout)
+	defer cancel()
+	return m.DB.DeleteApiKeysForUser(ctx, userID)
+}
+
+// NewRecoveryCodes() replaces all of a user's recovery codes with a fresh set. Only the
+// SHA-256 hashes are stored, so the returned plaintext codes (formatted as XXXXX-XXXXX)
+// must be shown to the user straight away as they can never be retrieved again.
+func (m TokenModel) NewRecoveryCodes(userID int64) ([]string, error) {
+	// invalidate any previous set first
+	err := m.DeleteAllForUser(ScopeRecovery, userID)
+	if err != nil {
+		return nil, err
+	}
+	codes := make([]string, 0, DefaultRecoveryCodeCount)
+	for range DefaultRecoveryCodeCount {
+		// 10 base32 characters carry 50 bits of randomness
+		randomBytes := make([]byte, 7)
+		_, err := rand.Read(randomBytes)
+		if err != nil {
+			return nil, err
+		}
+		plaintext := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)[:10]
+		hash := sha256.Sum256([]byte(plaintext))
+		err = m.Insert(&Token{
+			Hash:   hash[:],
+			UserID: userID,
+			Expiry: time.Now().Add(DefaultRecoveryCodeExpiryTime),
+			Scope:  ScopeRecovery,
+		})
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, plaintext[:5]+"-"+plaintext[5:])
+	}
+	return codes, nil
+}
+
+// UseRecoveryCode() consumes a single recovery code belonging to the user. It returns
+// false if the code does not exist, has already been used or belongs to someone else.
+// Deleting the row is what makes each code single use.
+func (m TokenModel) UseRecoveryCode(userID int64, code string) (bool, error) {
+	return m.DeleteForUser(ScopeRecovery, userID, normalizeRecoveryCode(code))
+}
+
+// DeleteAllForUserExcept() deletes all of a user's tokens for a scope apart from the
+// one matching keepTokenPlaintext and the rest of its family. It is used to sign out
+// every other session while keeping the caller logged in.
+func (m TokenModel) DeleteAllForUserExcept(scope string, userID int64, keepTokenPlaintext string) error {
+	ctx, cancel := contextGenerator(context.Background(), DefaultTokenDBContextTimeout)
+	defer cancel()
+	hash := sha256.Sum256([]byte(keepTokenPlaintext))
+	return m.DB.DeleteApiKeysForUserExcept(ctx, database.DeleteApiKeysForUserExceptParams{
+		Scope:  scope,
+		UserID: userID,
+		ApiKey: hash[:],
+	})
+}
+
+// RecordFailedAttempt() counts a wrong code entered against a token and returns how
+// many there have been, including this one. It returns ErrGeneralRecordNotFound if the
+// token no longer exists.
+func (m TokenModel) RecordFailedAttempt(scope, tokenPlaintext string) (int, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultTokenDBContextTimeout)
+	defer cancel()
+	hash := sha256.Sum256([]byte(tokenPlaintext))
+	attempts, err := m.DB.IncrementApiKeyFailedAttempts(ctx, database.IncrementApiKeyFailedAttemptsParams{
+		ApiKey: hash[:],
+		Scope:  scope,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrGeneralRecordNotFound
+		default:
+			return 0, err
+		}
+	}
+	return int(attempts), nil
+}
+
+// DeleteForUser() deletes a single token, identified by its plaintext, that belongs to
+// the given user and scope, together with any tokens in the same family. It reports
+// whether a matching token was found.
+func (m TokenModel) DeleteForUser(scope string, userID int64, tokenPlaintext string) (bool, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultTokenDBContextTimeout)
+	defer cancel()
+	hash := sha256.Sum256([]byte(tokenPlaintext))
+	rows, err := m.DB.DeleteApiKeyForUser(ctx, database.DeleteApiKeyForUserParams{
+		UserID: userID,
+		ApiKey: hash[:],
+		Scope:  scope,
+	})
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+// DeleteSessionForUser() revokes one of the sessions returned by GetSessionsForUser().
+// Depending on how the user logged in, a session ID refers to either a refresh token or
+// an authentication token, so both scopes are tried.
+func (m TokenModel) DeleteSessionForUser(userID, sessionID int64) error {
+	for _, scope := range []string{ScopeRefresh, ScopeAuthentication} {
+		err := m.DeleteByIDForUser(scope, userID, sessionID)
+		if !errors.Is(err, ErrGeneralRecordNotFound) {
+			return err
+		}
+	}
+	return ErrGeneralRecordNotFound
+}
+
+// DeleteByIDForUser() deletes a single token by its ID, making sure it belongs to the
+// given user and scope so that users can never revoke each other's tokens. Tokens in the
+// same family go with it. It returns ErrGeneralRecordNotFound if there was nothing to
+// delete.
+func (m TokenModel) DeleteByIDForUser(scope string, userID, tokenID int64) error {
+	ctx, cancel := contextGenerator(context.Background(), DefaultTokenDBContextTimeout)
+	defer cancel()
+	rows, err := m.DB.DeleteApiKeyByIDForUser(ctx, database.DeleteApiKeyByIDForUserParams{
+		UserID: userID,
+		ID:     tokenID,
+		Scope:  scope,
+	})
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrGeneralRecordNotFound
+	}
+	return nil
+}
+
+// GetSessionsForUser() returns a user's active logins as sessions, most recently used
+// first. A login that can be refreshed is represented by its live refresh token, so it
+// stays listed after its short-lived access token expires; older logins without a
+// family are represented by their authentication token. The session that
+// currentTokenPlaintext belongs to, if any, is flagged as the current one.
+func (m TokenModel) GetSessionsForUser(userID int64, currentTokenPlaintext string) ([]*Session, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultTokenDBContextTimeout)
+	defer cancel()
+	currentHash := sha256.Sum256([]byte(currentTokenPlaintext))
+	rows, err := m.DB.GetSessionsForUser(ctx, database.GetSessionsForUserParams{
+		CurrentApiKey: currentHash[:],
+		UserID:        userID,
+		Expiry:        time.Now(),
+		SessionScope:  ScopeAuthentication,
+		RefreshScope:  ScopeRefresh,
+	})
+	if err != nil {
+		return nil, err
+	}
+	sessions := []*Session{}
+	for _, row := range rows {
+		sessions = append(sessions, &Session{
+			ID:         row.ID,
+			CreatedAt:  row.CreatedAt,
+			Expiry:     row.Expiry,
+			LastUsedAt: row.LastUsedAt,
+			IPAddress:  row.IpAddress,
+			UserAgent:  row.UserAgent,
+			Current:    row.Current,
+		})
+	}
+	return sessions, nil
+}
+
+// Touch() records that a token has just been used. To avoid a write on every single
+// request, the timestamp is only moved forward once DefaultSessionLastUsedInterval has
+// passed since it was last recorded.
+func (m TokenModel) Touch(tokenPlaintext string) error {
+	ctx, cancel := contextGenerator(context.Background(), DefaultTokenDBContextTimeout)
+	defer cancel()
+	hash := sha256.Sum256([]byte(tokenPlaintext))
+	now := time.Now()
+	return m.DB.UpdateApiKeyLastUsed(ctx, database.UpdateApiKeyLastUsedParams{
+		LastUsedAt:  now,
+		ApiKey:      hash[:],
+		StaleBefore: now.Add(-DefaultSessionLastUsedInterval),
+	})
+}
+
+// CountForUser() returns the number of unexpired tokens a user holds for a given scope.
+func (m TokenModel) CountForUser(scope string, userID int64) (int64, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultTokenDBContextTimeout)
+	defer cancel()
+	return m.DB.CountApiKeysForUser(ctx, database.CountApiKeysForUserParams{
+		Scope:  scope,
+		UserID: userID,
+		Expiry: time.Now(),
+	})
+}
+
+// IssuedSince() reports whether a token for the given scope was issued to the user after
+// the provided time. It is used to throttle endpoints that email tokens to users.
+func (m TokenModel) IssuedSince(scope string, userID int64, since time.Time) (bool, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultTokenDBContextTimeout)
+	defer cancel()
+	count, err := m.DB.CountApiKeysCreatedSince(ctx, database.CountApiKeysCreatedSinceParams{
+		Scope:     scope,
+		UserID:    userID,
+		CreatedAt: since,
+	})
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// DeleteExpired() removes every expired token, whatever its scope, returning how many
+// were removed. Rotated refresh tokens are kept for reuse detection until they expire,
+// so they are cleaned up here too.
+func (m TokenModel) DeleteExpired() (int64, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultTokenDBContextTimeout)
+	defer cancel()
+	return m.DB.DeleteExpiredApiKeys(ctx, time.Now())
+}
@@ -72,14 +72,52 @@ func (p *password) Matches(plaintextPassword string) (bool, error) {
 // The user struct represents a user account in our application. It contains fields for
 // the user ID, created timestamp, name, email address, password hash, and activation data
 type User struct {
-	ID        int64     `json:"id"`
-	Name      string    `json:"name"`
-	Email     string    `json:"email"`
-	Password  password  `json:"-"`
-	Activated bool      `json:"-"`
-	Version   int32     `json:"-"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID           int64     `json:"id"`
+	Name         string    `json:"name"`
+	Email        string    `json:"email"`
+	Password     password  `json:"-"`
+	Activated    bool      `json:"-"`
+	MFASecret    string    `json:"-"`
+	MFAEnabled   bool      `json:"-"`
+	PendingEmail string    `json:"-"`
+	Locale       string    `json:"locale"`
+	Suspended    bool      `json:"-"`
+	Version      int32     `json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// UserProfile is the view of a user returned by the /me endpoints. The version is
+// included so that clients can send it back in an If-Match header when updating.
+type UserProfile struct {
+	ID           int64     `json:"id"`
+	Name         string    `json:"name"`
+	Email        string    `json:"email"`
+	Activated    bool      `json:"activated"`
+	MFAEnabled   bool      `json:"mfa_enabled"`
+	PendingEmail string    `json:"pending_email,omitempty"`
+	Locale       string    `json:"locale"`
+	Suspended    bool      `json:"suspended"`
+	Version      int32     `json:"version"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// Profile() returns the UserProfile view of a user.
+func (u *User) Profile() UserProfile {
+	return UserProfile{
+		ID:           u.ID,
+		Name:         u.Name,
+		Email:        u.Email,
+		Activated:    u.Activated,
+		MFAEnabled:   u.MFAEnabled,
+		PendingEmail: u.PendingEmail,
+		Locale:       u.Locale,
+		Suspended:    u.Suspended,
+		Version:      u.Version,
+		CreatedAt:    u.CreatedAt,
+		UpdatedAt:    u.UpdatedAt,
+	}
 }
 
 type UserSubInfo struct {
@@ -94,7 +132,7 @@ func ValidateEmail(v *validator.Validator, email string) {
 	v.Check(validator.Matches(email, validator.EmailRX), "email", "must be a valid email address")
 }
 func ValidateName(v *validator.Validator, name string) {
-	v.Check(name != "", "email", "must be provided")
+	v.Check(name != "", "name", "must be provided")
 	v.Check(len(name) <= 500, "name", "must not be more than 500 bytes long")
 }
 func ValidatePasswordPlaintext(v *validator.Validator, password string) {
@@ -132,6 +170,7 @@ func (m UserModel) Insert(user *User) error {
 		Email:        user.Email,
 		PasswordHash: user.Password.hash,
 		Activated:    user.Activated,
+		Locale:       user.Locale,
 	})
 
 	if err != nil {
@@ -205,6 +244,83 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 	return populatedUser, nil
 }
 
+// GetByID() retrieves a user by their ID, returning ErrGeneralRecordNotFound if no
+// such user exists.
+func (m UserModel) GetByID(userID int64) (*User, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultUserManagerDBContextTimeout)
+	defer cancel()
+	user, err := m.DB.GetUserByID(ctx, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrGeneralRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return populateUser(user), nil
+}
+
+// UserFilters narrows down the users returned by GetAll(). Nil and empty fields match
+// every user.
+type UserFilters struct {
+	Activated     *bool
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	Email         string
+}
+
+// likeEscaper escapes the characters that are special in a LIKE pattern, so that a
+// search matches them literally.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func (f UserFilters) params() database.CountUsersParams {
+	params := database.CountUsersParams{
+		CreatedAfter:  toNullTime(f.CreatedAfter),
+		CreatedBefore: toNullTime(f.CreatedBefore),
+		Email:         likeEscaper.Replace(f.Email),
+	}
+	if f.Activated != nil {
+		params.Activated = sql.NullBool{Bool: *f.Activated, Valid: true}
+	}
+	return params
+}
+
+// GetAll() returns a page of users matching the filters, newest first, along with the
+// pagination metadata. The email filter is a case-insensitive substring match.
+func (m UserModel) GetAll(userFilters UserFilters, filters Filters) ([]*User, Metadata, error) {
+	totalRecords, err := m.Count(userFilters)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	ctx, cancel := contextGenerator(context.Background(), DefaultUserManagerDBContextTimeout)
+	defer cancel()
+	params := userFilters.params()
+	rows, err := m.DB.ListUsers(ctx, database.ListUsersParams{
+		Activated:     params.Activated,
+		CreatedAfter:  params.CreatedAfter,
+		CreatedBefore: params.CreatedBefore,
+		Email:         params.Email,
+		Limit:         filters.limit(),
+		Offset:        filters.offset(),
+	})
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	users := []*User{}
+	for _, row := range rows {
+		users = append(users, populateUser(row))
+	}
+	return users, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+// Count() returns how many users match the filters.
+func (m UserModel) Count(userFilters UserFilters) (int64, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultUserManagerDBContextTimeout)
+	defer cancel()
+	return m.DB.CountUsers(ctx, userFilters.params())
+}
+
 // UpdateUser() updates an existing user in the database.
 func (m UserModel) UpdateUser(user *User) error {
 	// Create a new context with a 5 second timeout
@@ -217,20 +333,92 @@ func (m UserModel) UpdateUser(user *User) error {
 		Email:        user.Email,
 		PasswordHash: user.Password.hash,
 		Activated:    user.Activated,
+		MfaSecret:    user.MFASecret,
+		MfaEnabled:   user.MFAEnabled,
+		PendingEmail: user.PendingEmail,
+		Locale:       user.Locale,
+		Suspended:    user.Suspended,
 		Version:      int32(user.Version),
 	})
 	if err != nil {
 		switch {
+		// no rows means the version changed underneath us
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrGeneralEditConflict
 		case strings.Contains(err.Error(), "users_email_key"):
 			return ErrDuplicateEmail
 		default:
 			return err
 		}
 	}
+	user.Version = updatedUser.Version
 	user.UpdatedAt = updatedUser.UpdatedAt
 	return nil
 }
 
+// DeleteUser() permanently deletes a user. Every api_keys row belonging to the user,
+// whatever its scope, is removed along with it by the ON DELETE CASCADE constraint. The
+// audit events recorded for the user or their email address are kept, still tied to the
+// old user ID, but their email, IP address and user-agent are blanked in the same
+// statement, so that one never happens without the other.
+func (m UserModel) DeleteUser(userID int64, email string) error {
+	ctx, cancel := contextGenerator(context.Background(), DefaultUserManagerDBContextTimeout)
+	defer cancel()
+	rows, err := m.DB.DeleteUser(ctx, database.DeleteUserParams{
+		UserID: sql.NullInt64{Int64: userID, Valid: true},
+		Email:  email,
+	})
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrGeneralRecordNotFound
+	}
+	return nil
+}
+
+// GetForActivationReminder() returns up to limit unactivated users created before
+// createdBefore who haven't been sent an activation reminder yet. Only the ID, name,
+// email, locale and creation time are filled in.
+func (m UserModel) GetForActivationReminder(createdBefore time.Time, limit int) ([]*User, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultUserManagerDBContextTimeout)
+	defer cancel()
+	rows, err := m.DB.GetUsersForActivationReminder(ctx, database.GetUsersForActivationReminderParams{
+		CreatedAt: createdBefore,
+		Limit:     int32(limit),
+	})
+	if err != nil {
+		return nil, err
+	}
+	users := []*User{}
+	for _, row := range rows {
+		users = append(users, &User{
+			ID:        row.ID,
+			Name:      row.Name,
+			Email:     row.Email,
+			Locale:    row.Locale,
+			CreatedAt: row.CreatedAt,
+		})
+	}
+	return users, nil
+}
+
+// MarkActivationReminderSent() records that a user has been sent their activation
+// reminder, so that they aren't sent another.
+func (m UserModel) MarkActivationReminderSent(userID int64) error {
+	ctx, cancel := contextGenerator(context.Background(), DefaultUserManagerDBContextTimeout)
+	defer cancel()
+	return m.DB.InsertActivationReminder(ctx, userID)
+}
+
+// DeleteUnactivated() purges accounts that were created before createdBefore and never
+// activated, returning how many were removed. Suspended accounts are left alone.
+func (m UserModel) DeleteUnactivated(createdBefore time.Time) (int64, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultUserManagerDBContextTimeout)
+	defer cancel()
+	return m.DB.DeleteUnactivatedUsers(ctx, createdBefore)
+}
+
 // populateUser() takes a userRow of type any and attempts to convert it to a User struct.
 // It checks the type of userRow, and if it is of type database.User, it creates a new
 // password struct instance with the user's password hash. It then returns a pointer to a
@@ -243,14 +431,19 @@ func populateUser(userRow any) *User {
 			hash: user.PasswordHash,
 		}
 		return &User{
-			ID:        user.ID,
-			Name:      user.Name,
-			Email:     user.Email,
-			Password:  userPassword,
-			Activated: user.Activated,
-			Version:   user.Version,
-			CreatedAt: user.CreatedAt,
-			UpdatedAt: user.UpdatedAt,
+			ID:           user.ID,
+			Name:         user.Name,
+			Email:        user.Email,
+			Password:     userPassword,
+			Activated:    user.Activated,
+			MFASecret:    user.MfaSecret,
+			MFAEnabled:   user.MfaEnabled,
+			PendingEmail: user.PendingEmail,
+			Locale:       user.Locale,
+			Suspended:    user.Suspended,
+			Version:      user.Version,
+			CreatedAt:    user.CreatedAt,
+			UpdatedAt:    user.UpdatedAt,
 		}
 	default:
 		// return nil if the userRow is not of type database.User
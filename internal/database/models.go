@@ -5,14 +5,142 @@
 package database
 
 import (
+	"database/sql"
+	"encoding/json"
 	"time"
 )
 
+type ActivationReminder struct {
+	UserID int64
+	SentAt time.Time
+}
+
 type ApiKey struct {
-	ApiKey []byte
+	ApiKey         []byte
+	UserID         int64
+	Expiry         time.Time
+	Scope          string
+	ID             int64
+	CreatedAt      time.Time
+	LastUsedAt     time.Time
+	IpAddress      string
+	UserAgent      string
+	FamilyID       string
+	RotatedAt      sql.NullTime
+	FailedAttempts int32
+}
+
+type AuditEvent struct {
+	ID        int64
+	UserID    sql.NullInt64
+	Email     string
+	EventType string
+	IpAddress string
+	UserAgent string
+	RequestID string
+	Metadata  json.RawMessage
+	CreatedAt time.Time
+}
+
+type ContactMessage struct {
+	ID         int64
+	Name       string
+	Email      string
+	Subject    string
+	Message    string
+	IpAddress  string
+	UserAgent  string
+	ResolvedAt sql.NullTime
+	ResolvedBy sql.NullInt64
+	CreatedAt  time.Time
+}
+
+type DigestSubscription struct {
+	UserID     int64
+	Subscribed bool
+	Genres     []string
+	Country    string
+	SendDay    int16
+	SendHour   int16
+	Timezone   string
+	NextSendAt time.Time
+	LastSentAt sql.NullTime
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+type EmailOutbox struct {
+	ID            int64
+	MessageID     string
+	Recipient     string
+	Sender        string
+	Template      string
+	Subject       string
+	PlainBody     string
+	HtmlBody      string
+	Status        string
+	Attempts      int32
+	LastError     string
+	NextAttemptAt time.Time
+	LockedUntil   sql.NullTime
+	SentAt        sql.NullTime
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	Headers       json.RawMessage
+}
+
+type KnownDevice struct {
+	ID          int64
+	UserID      int64
+	Fingerprint []byte
+	IpAddress   string
+	UserAgent   string
+	FirstSeenAt time.Time
+	LastSeenAt  time.Time
+	Revoked     bool
+}
+
+type LoginAttempt struct {
+	ID        int64
+	Email     string
+	IpAddress string
+	CreatedAt time.Time
+}
+
+type LoginLockout struct {
+	Email       string
+	LockedUntil time.Time
+}
+
+type MfaUsedStep struct {
 	UserID int64
-	Expiry time.Time
-	Scope  string
+	Step   int64
+	UsedAt time.Time
+}
+
+type OidcAuthRequest struct {
+	StateHash    []byte
+	Provider     string
+	CodeVerifier string
+	Nonce        string
+	Expiry       time.Time
+}
+
+type Permission struct {
+	ID   int64
+	Code string
+}
+
+type PersonalApiKey struct {
+	ID         int64
+	UserID     int64
+	Name       string
+	KeyHash    []byte
+	KeyPrefix  string
+	Scopes     []string
+	Expiry     sql.NullTime
+	CreatedAt  time.Time
+	LastUsedAt sql.NullTime
 }
 
 type User struct {
@@ -24,4 +152,24 @@ type User struct {
 	Version      int32
 	CreatedAt    time.Time
 	UpdatedAt    time.Time
+	MfaSecret    string
+	MfaEnabled   bool
+	PendingEmail string
+	Locale       string
+	Suspended    bool
+}
+
+type UserIdentity struct {
+	ID          int64
+	UserID      int64
+	Provider    string
+	Subject     string
+	Email       string
+	CreatedAt   time.Time
+	LastLoginAt time.Time
+}
+
+type UsersPermission struct {
+	UserID       int64
+	PermissionID int64
 }
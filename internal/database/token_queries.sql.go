@@ -7,9 +7,48 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 )
 
+const countApiKeysCreatedSince = `-- name: CountApiKeysCreatedSince :one
+SELECT COUNT(*)
+FROM api_keys
+WHERE scope = $1 AND user_id = $2 AND created_at > $3
+`
+
+type CountApiKeysCreatedSinceParams struct {
+	Scope     string
+	UserID    int64
+	CreatedAt time.Time
+}
+
+func (q *Queries) CountApiKeysCreatedSince(ctx context.Context, arg CountApiKeysCreatedSinceParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countApiKeysCreatedSince, arg.Scope, arg.UserID, arg.CreatedAt)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countApiKeysForUser = `-- name: CountApiKeysForUser :one
+SELECT COUNT(*)
+FROM api_keys
+WHERE scope = $1 AND user_id = $2 AND expiry > $3
+`
+
+type CountApiKeysForUserParams struct {
+	Scope  string
+	UserID int64
+	Expiry time.Time
+}
+
+func (q *Queries) CountApiKeysForUser(ctx context.Context, arg CountApiKeysForUserParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countApiKeysForUser, arg.Scope, arg.UserID, arg.Expiry)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const deletAllAPIKeysForUser = `-- name: DeletAllAPIKeysForUser :exec
 DELETE FROM api_keys
 WHERE scope = $1 AND user_id = $2
@@ -25,6 +64,128 @@ func (q *Queries) DeletAllAPIKeysForUser(ctx context.Context, arg DeletAllAPIKey
 	return err
 }
 
+const deleteApiKeyByIDForUser = `-- name: DeleteApiKeyByIDForUser :execrows
+DELETE FROM api_keys
+WHERE user_id = $1
+AND (
+    (id = $2 AND scope = $3)
+    OR family_id IN (
+        SELECT family_id FROM api_keys
+        WHERE id = $2 AND scope = $3 AND user_id = $1 AND family_id <> ''
+    )
+)
+`
+
+type DeleteApiKeyByIDForUserParams struct {
+	UserID int64
+	ID     int64
+	Scope  string
+}
+
+func (q *Queries) DeleteApiKeyByIDForUser(ctx context.Context, arg DeleteApiKeyByIDForUserParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteApiKeyByIDForUser, arg.UserID, arg.ID, arg.Scope)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteApiKeyFamily = `-- name: DeleteApiKeyFamily :execrows
+DELETE FROM api_keys
+WHERE family_id = $1 AND family_id <> ''
+`
+
+func (q *Queries) DeleteApiKeyFamily(ctx context.Context, familyID string) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteApiKeyFamily, familyID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteApiKeyForUser = `-- name: DeleteApiKeyForUser :execrows
+DELETE FROM api_keys
+WHERE user_id = $1
+AND (
+    (api_key = $2 AND scope = $3)
+    OR family_id IN (
+        SELECT family_id FROM api_keys
+        WHERE api_key = $2 AND scope = $3 AND user_id = $1 AND family_id <> ''
+    )
+)
+`
+
+type DeleteApiKeyForUserParams struct {
+	UserID int64
+	ApiKey []byte
+	Scope  string
+}
+
+func (q *Queries) DeleteApiKeyForUser(ctx context.Context, arg DeleteApiKeyForUserParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteApiKeyForUser, arg.UserID, arg.ApiKey, arg.Scope)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteApiKeysForFamily = `-- name: DeleteApiKeysForFamily :exec
+DELETE FROM api_keys
+WHERE family_id = $1 AND scope = $2
+`
+
+type DeleteApiKeysForFamilyParams struct {
+	FamilyID string
+	Scope    string
+}
+
+func (q *Queries) DeleteApiKeysForFamily(ctx context.Context, arg DeleteApiKeysForFamilyParams) error {
+	_, err := q.db.ExecContext(ctx, deleteApiKeysForFamily, arg.FamilyID, arg.Scope)
+	return err
+}
+
+const deleteApiKeysForUser = `-- name: DeleteApiKeysForUser :exec
+DELETE FROM api_keys
+WHERE user_id = $1
+`
+
+func (q *Queries) DeleteApiKeysForUser(ctx context.Context, userID int64) error {
+	_, err := q.db.ExecContext(ctx, deleteApiKeysForUser, userID)
+	return err
+}
+
+const deleteApiKeysForUserExcept = `-- name: DeleteApiKeysForUserExcept :exec
+DELETE FROM api_keys
+WHERE scope = $1 AND user_id = $2 AND api_key <> $3
+AND family_id NOT IN (
+    SELECT family_id FROM api_keys WHERE api_key = $3 AND family_id <> ''
+)
+`
+
+type DeleteApiKeysForUserExceptParams struct {
+	Scope  string
+	UserID int64
+	ApiKey []byte
+}
+
+func (q *Queries) DeleteApiKeysForUserExcept(ctx context.Context, arg DeleteApiKeysForUserExceptParams) error {
+	_, err := q.db.ExecContext(ctx, deleteApiKeysForUserExcept, arg.Scope, arg.UserID, arg.ApiKey)
+	return err
+}
+
+const deleteExpiredApiKeys = `-- name: DeleteExpiredApiKeys :execrows
+DELETE FROM api_keys
+WHERE expiry < $1
+`
+
+func (q *Queries) DeleteExpiredApiKeys(ctx context.Context, expiry time.Time) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteExpiredApiKeys, expiry)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const getForToken = `-- name: GetForToken :one
 SELECT 
     users.id, 
@@ -34,7 +195,12 @@ SELECT
     users.activated, 
     users.version, 
     users.created_at, 
-    users.updated_at
+    users.updated_at,
+    users.mfa_secret,
+    users.mfa_enabled,
+    users.pending_email,
+    users.locale,
+    users.suspended
 FROM users
 INNER JOIN api_keys
 ON users.id = api_keys.user_id
@@ -61,31 +227,213 @@ func (q *Queries) GetForToken(ctx context.Context, arg GetForTokenParams) (User,
 		&i.Version,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.MfaSecret,
+		&i.MfaEnabled,
+		&i.PendingEmail,
+		&i.Locale,
+		&i.Suspended,
 	)
 	return i, err
 }
 
-const insertApiKey = `-- name: InsertApiKey :one
-INSERT INTO api_keys (api_key, user_id, expiry, scope)
-VALUES ($1, $2, $3, $4)
-RETURNING user_id
+const getRefreshToken = `-- name: GetRefreshToken :one
+SELECT id, user_id, family_id, rotated_at
+FROM api_keys
+WHERE api_key = $1 AND scope = $2 AND expiry > $3
 `
 
-type InsertApiKeyParams struct {
+type GetRefreshTokenParams struct {
 	ApiKey []byte
-	UserID int64
+	Scope  string
 	Expiry time.Time
+}
+
+type GetRefreshTokenRow struct {
+	ID        int64
+	UserID    int64
+	FamilyID  string
+	RotatedAt sql.NullTime
+}
+
+func (q *Queries) GetRefreshToken(ctx context.Context, arg GetRefreshTokenParams) (GetRefreshTokenRow, error) {
+	row := q.db.QueryRowContext(ctx, getRefreshToken, arg.ApiKey, arg.Scope, arg.Expiry)
+	var i GetRefreshTokenRow
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.FamilyID,
+		&i.RotatedAt,
+	)
+	return i, err
+}
+
+const getSessionsForUser = `-- name: GetSessionsForUser :many
+SELECT
+    id,
+    created_at,
+    expiry,
+    last_used_at,
+    ip_address,
+    user_agent,
+    (api_key = $1 OR family_id IN (
+        SELECT family_id FROM api_keys WHERE api_key = $1 AND family_id <> ''
+    ))::boolean AS current
+FROM api_keys
+WHERE user_id = $2
+AND expiry > $3
+AND (
+    (scope = $4 AND family_id = '')
+    OR (scope = $5 AND rotated_at IS NULL)
+)
+ORDER BY last_used_at DESC
+`
+
+type GetSessionsForUserParams struct {
+	CurrentApiKey []byte
+	UserID        int64
+	Expiry        time.Time
+	SessionScope  string
+	RefreshScope  string
+}
+
+type GetSessionsForUserRow struct {
+	ID         int64
+	CreatedAt  time.Time
+	Expiry     time.Time
+	LastUsedAt time.Time
+	IpAddress  string
+	UserAgent  string
+	Current    bool
+}
+
+func (q *Queries) GetSessionsForUser(ctx context.Context, arg GetSessionsForUserParams) ([]GetSessionsForUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, getSessionsForUser,
+		arg.CurrentApiKey,
+		arg.UserID,
+		arg.Expiry,
+		arg.SessionScope,
+		arg.RefreshScope,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetSessionsForUserRow
+	for rows.Next() {
+		var i GetSessionsForUserRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.Expiry,
+			&i.LastUsedAt,
+			&i.IpAddress,
+			&i.UserAgent,
+			&i.Current,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const incrementApiKeyFailedAttempts = `-- name: IncrementApiKeyFailedAttempts :one
+UPDATE api_keys
+SET failed_attempts = failed_attempts + 1
+WHERE api_key = $1 AND scope = $2
+RETURNING failed_attempts
+`
+
+type IncrementApiKeyFailedAttemptsParams struct {
+	ApiKey []byte
 	Scope  string
 }
 
-func (q *Queries) InsertApiKey(ctx context.Context, arg InsertApiKeyParams) (int64, error) {
+func (q *Queries) IncrementApiKeyFailedAttempts(ctx context.Context, arg IncrementApiKeyFailedAttemptsParams) (int32, error) {
+	row := q.db.QueryRowContext(ctx, incrementApiKeyFailedAttempts, arg.ApiKey, arg.Scope)
+	var failed_attempts int32
+	err := row.Scan(&failed_attempts)
+	return failed_attempts, err
+}
+
+const insertApiKey = `-- name: InsertApiKey :one
+INSERT INTO api_keys (api_key, user_id, expiry, scope, ip_address, user_agent, family_id)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING id, created_at
+`
+
+type InsertApiKeyParams struct {
+	ApiKey    []byte
+	UserID    int64
+	Expiry    time.Time
+	Scope     string
+	IpAddress string
+	UserAgent string
+	FamilyID  string
+}
+
+type InsertApiKeyRow struct {
+	ID        int64
+	CreatedAt time.Time
+}
+
+func (q *Queries) InsertApiKey(ctx context.Context, arg InsertApiKeyParams) (InsertApiKeyRow, error) {
 	row := q.db.QueryRowContext(ctx, insertApiKey,
 		arg.ApiKey,
 		arg.UserID,
 		arg.Expiry,
 		arg.Scope,
+		arg.IpAddress,
+		arg.UserAgent,
+		arg.FamilyID,
 	)
-	var user_id int64
-	err := row.Scan(&user_id)
-	return user_id, err
+	var i InsertApiKeyRow
+	err := row.Scan(&i.ID, &i.CreatedAt)
+	return i, err
+}
+
+const markApiKeyRotated = `-- name: MarkApiKeyRotated :execrows
+UPDATE api_keys
+SET rotated_at = $1
+WHERE id = $2 AND rotated_at IS NULL
+`
+
+type MarkApiKeyRotatedParams struct {
+	RotatedAt sql.NullTime
+	ID        int64
+}
+
+func (q *Queries) MarkApiKeyRotated(ctx context.Context, arg MarkApiKeyRotatedParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, markApiKeyRotated, arg.RotatedAt, arg.ID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const updateApiKeyLastUsed = `-- name: UpdateApiKeyLastUsed :exec
+UPDATE api_keys
+SET last_used_at = $1
+WHERE (
+    api_key = $2
+    OR family_id IN (SELECT family_id FROM api_keys WHERE api_key = $2 AND family_id <> '')
+)
+AND last_used_at < $3
+`
+
+type UpdateApiKeyLastUsedParams struct {
+	LastUsedAt  time.Time
+	ApiKey      []byte
+	StaleBefore time.Time
+}
+
+func (q *Queries) UpdateApiKeyLastUsed(ctx context.Context, arg UpdateApiKeyLastUsedParams) error {
+	_, err := q.db.ExecContext(ctx, updateApiKeyLastUsed, arg.LastUsedAt, arg.ApiKey, arg.StaleBefore)
+	return err
 }
@@ -7,12 +7,41 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 )
 
+const countUsers = `-- name: CountUsers :one
+SELECT COUNT(*)
+FROM users
+WHERE ($1::boolean IS NULL OR activated = $1)
+AND ($2::timestamptz IS NULL OR created_at >= $2)
+AND ($3::timestamptz IS NULL OR created_at < $3)
+AND ($4::text = '' OR email ILIKE '%' || $4::text || '%')
+`
+
+type CountUsersParams struct {
+	Activated     sql.NullBool
+	CreatedAfter  sql.NullTime
+	CreatedBefore sql.NullTime
+	Email         string
+}
+
+func (q *Queries) CountUsers(ctx context.Context, arg CountUsersParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countUsers,
+		arg.Activated,
+		arg.CreatedAfter,
+		arg.CreatedBefore,
+		arg.Email,
+	)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createUser = `-- name: CreateUser :one
-INSERT INTO users (name, email, password_hash, activated)
-VALUES ($1, $2, $3, $4)
+INSERT INTO users (name, email, password_hash, activated, locale)
+VALUES ($1, $2, $3, $4, $5)
 RETURNING id, created_at, version
 `
 
@@ -21,6 +50,7 @@ type CreateUserParams struct {
 	Email        string
 	PasswordHash []byte
 	Activated    bool
+	Locale       string
 }
 
 type CreateUserRow struct {
@@ -35,14 +65,53 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (CreateU
 		arg.Email,
 		arg.PasswordHash,
 		arg.Activated,
+		arg.Locale,
 	)
 	var i CreateUserRow
 	err := row.Scan(&i.ID, &i.CreatedAt, &i.Version)
 	return i, err
 }
 
+const deleteUnactivatedUsers = `-- name: DeleteUnactivatedUsers :execrows
+DELETE FROM users
+WHERE activated = false
+AND suspended = false
+AND created_at < $1
+`
+
+func (q *Queries) DeleteUnactivatedUsers(ctx context.Context, createdAt time.Time) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteUnactivatedUsers, createdAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteUser = `-- name: DeleteUser :execrows
+WITH anonymised_audit_events AS (
+    UPDATE audit_events
+    SET email = '', ip_address = '', user_agent = ''
+    WHERE user_id = $1 OR email = $2
+)
+DELETE FROM users
+WHERE id = $1
+`
+
+type DeleteUserParams struct {
+	UserID sql.NullInt64
+	Email  string
+}
+
+func (q *Queries) DeleteUser(ctx context.Context, arg DeleteUserParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteUser, arg.UserID, arg.Email)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, name, email, password_hash, activated, version, created_at, updated_at
+SELECT id, name, email, password_hash, activated, version, created_at, updated_at, mfa_secret, mfa_enabled, pending_email, locale, suspended
 FROM users WHERE email = $1
 `
 
@@ -58,18 +127,185 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 		&i.Version,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.MfaSecret,
+		&i.MfaEnabled,
+		&i.PendingEmail,
+		&i.Locale,
+		&i.Suspended,
+	)
+	return i, err
+}
+
+const getUserByID = `-- name: GetUserByID :one
+SELECT id, name, email, password_hash, activated, version, created_at, updated_at, mfa_secret, mfa_enabled, pending_email, locale, suspended
+FROM users WHERE id = $1
+`
+
+func (q *Queries) GetUserByID(ctx context.Context, id int64) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByID, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Email,
+		&i.PasswordHash,
+		&i.Activated,
+		&i.Version,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.MfaSecret,
+		&i.MfaEnabled,
+		&i.PendingEmail,
+		&i.Locale,
+		&i.Suspended,
 	)
 	return i, err
 }
 
+const getUsersForActivationReminder = `-- name: GetUsersForActivationReminder :many
+SELECT users.id, users.name, users.email, users.locale, users.created_at
+FROM users
+LEFT JOIN activation_reminders
+ON activation_reminders.user_id = users.id
+WHERE users.activated = false
+AND users.suspended = false
+AND users.created_at < $1
+AND activation_reminders.user_id IS NULL
+ORDER BY users.created_at
+LIMIT $2
+`
+
+type GetUsersForActivationReminderParams struct {
+	CreatedAt time.Time
+	Limit     int32
+}
+
+type GetUsersForActivationReminderRow struct {
+	ID        int64
+	Name      string
+	Email     string
+	Locale    string
+	CreatedAt time.Time
+}
+
+func (q *Queries) GetUsersForActivationReminder(ctx context.Context, arg GetUsersForActivationReminderParams) ([]GetUsersForActivationReminderRow, error) {
+	rows, err := q.db.QueryContext(ctx, getUsersForActivationReminder, arg.CreatedAt, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetUsersForActivationReminderRow
+	for rows.Next() {
+		var i GetUsersForActivationReminderRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Email,
+			&i.Locale,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const insertActivationReminder = `-- name: InsertActivationReminder :exec
+INSERT INTO activation_reminders (user_id)
+VALUES ($1)
+ON CONFLICT (user_id) DO NOTHING
+`
+
+func (q *Queries) InsertActivationReminder(ctx context.Context, userID int64) error {
+	_, err := q.db.ExecContext(ctx, insertActivationReminder, userID)
+	return err
+}
+
+const listUsers = `-- name: ListUsers :many
+SELECT id, name, email, password_hash, activated, version, created_at, updated_at, mfa_secret, mfa_enabled, pending_email, locale, suspended
+FROM users
+WHERE ($1::boolean IS NULL OR activated = $1)
+AND ($2::timestamptz IS NULL OR created_at >= $2)
+AND ($3::timestamptz IS NULL OR created_at < $3)
+AND ($4::text = '' OR email ILIKE '%' || $4::text || '%')
+ORDER BY created_at DESC, id DESC
+LIMIT $5 OFFSET $6
+`
+
+type ListUsersParams struct {
+	Activated     sql.NullBool
+	CreatedAfter  sql.NullTime
+	CreatedBefore sql.NullTime
+	Email         string
+	Limit         int32
+	Offset        int32
+}
+
+func (q *Queries) ListUsers(ctx context.Context, arg ListUsersParams) ([]User, error) {
+	rows, err := q.db.QueryContext(ctx, listUsers,
+		arg.Activated,
+		arg.CreatedAfter,
+		arg.CreatedBefore,
+		arg.Email,
+		arg.Limit,
+		arg.Offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Email,
+			&i.PasswordHash,
+			&i.Activated,
+			&i.Version,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.MfaSecret,
+			&i.MfaEnabled,
+			&i.PendingEmail,
+			&i.Locale,
+			&i.Suspended,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const updateUser = `-- name: UpdateUser :one
 UPDATE users
 SET 
     name = $1, 
     email = $2, 
     password_hash = $3, 
-    activated = $4
-WHERE id = $5 AND version = $6
+    activated = $4,
+    mfa_secret = $5,
+    mfa_enabled = $6,
+    pending_email = $7,
+    locale = $8,
+    suspended = $9,
+    version = version + 1
+WHERE id = $10 AND version = $11
 RETURNING version, updated_at
 `
 
@@ -78,6 +314,11 @@ type UpdateUserParams struct {
 	Email        string
 	PasswordHash []byte
 	Activated    bool
+	MfaSecret    string
+	MfaEnabled   bool
+	PendingEmail string
+	Locale       string
+	Suspended    bool
 	ID           int64
 	Version      int32
 }
@@ -93,6 +334,11 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (UpdateU
 		arg.Email,
 		arg.PasswordHash,
 		arg.Activated,
+		arg.MfaSecret,
+		arg.MfaEnabled,
+		arg.PendingEmail,
+		arg.Locale,
+		arg.Suspended,
 		arg.ID,
 		arg.Version,
 	)
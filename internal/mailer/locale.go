@@ -0,0 +1,154 @@
+package mailer
+
+import (
+	"io/fs"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultLocale is the locale emails fall back to. Every template has an English version,
+// so a template without a translation for the recipient's locale is sent in English.
+const DefaultLocale = "en"
+
+// Date is a time that is shown as a date alone, without the time of day, when it is
+// passed to a template. Unlike a time.Time, which is shown in UTC, the date is the one in
+// the time's own location.
+type Date time.Time
+
+// localeFormat describes how dates and numbers are written in a locale. The layouts use
+// the English month name from the reference time, which is replaced by the localized one.
+type localeFormat struct {
+	dateLayout     string
+	dateTimeLayout string
+	months         [12]string
+	decimal        string
+	thousands      string
+}
+
+// localeFormats holds the locales that emails can be formatted for.
+var localeFormats = map[string]localeFormat{
+	"de": {
+		dateLayout:     "2. January 2006",
+		dateTimeLayout: "2. January 2006 um 15:04 MST",
+		months:         [12]string{"Januar", "Februar", "März", "April", "Mai", "Juni", "Juli", "August", "September", "Oktober", "November", "Dezember"},
+		decimal:        ",",
+		thousands:      ".",
+	},
+	"en": {
+		dateLayout:     "January 2, 2006",
+		dateTimeLayout: "January 2, 2006 at 15:04 MST",
+		months:         [12]string{"January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"},
+		decimal:        ".",
+		thousands:      ",",
+	},
+	"es": {
+		dateLayout:     "2 de January de 2006",
+		dateTimeLayout: "2 de January de 2006, 15:04 MST",
+		months:         [12]string{"enero", "febrero", "marzo", "abril", "mayo", "junio", "julio", "agosto", "septiembre", "octubre", "noviembre", "diciembre"},
+		decimal:        ",",
+		thousands:      ".",
+	},
+	"fr": {
+		dateLayout:     "2 January 2006",
+		dateTimeLayout: "2 January 2006 à 15:04 MST",
+		months:         [12]string{"janvier", "février", "mars", "avril", "mai", "juin", "juillet", "août", "septembre", "octobre", "novembre", "décembre"},
+		decimal:        ",",
+		thousands:      "\u202f",
+	},
+}
+
+// Locales lists the supported locales in alphabetical order.
+var Locales = []string{"de", "en", "es", "fr"}
+
+// NormalizeLocale() reduces a language tag such as "fr-CA" or "FR" to the supported
+// locale it belongs to. The second return value is false if the language isn't supported.
+func NormalizeLocale(tag string) (string, bool) {
+	locale, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+	locale, _, _ = strings.Cut(locale, "_")
+	if _, ok := localeFormats[locale]; !ok {
+		return "", false
+	}
+	return locale, true
+}
+
+// resolveLocale() returns locale if it is supported and DefaultLocale otherwise.
+func resolveLocale(locale string) string {
+	if locale, ok := NormalizeLocale(locale); ok {
+		return locale
+	}
+	return DefaultLocale
+}
+
+// resolveTemplate() returns the translation of templateFile for locale, such as
+// user_welcome.fr.tmpl for user_welcome.tmpl, or templateFile itself if there isn't one.
+func resolveTemplate(templateFile, locale string) string {
+	if locale == DefaultLocale {
+		return templateFile
+	}
+	translated := strings.TrimSuffix(templateFile, ".tmpl") + "." + locale + ".tmpl"
+	if _, err := fs.Stat(templateFS, "templates/"+translated); err != nil {
+		return templateFile
+	}
+	return translated
+}
+
+// localize() returns a copy of the template data with dates and numbers written the way
+// the locale writes them. Values of other types, and data that isn't a map, are passed
+// through unchanged. Identifiers that happen to be numbers should be passed as strings so
+// that they aren't given thousands separators.
+func localize(data any, locale string) any {
+	values, ok := data.(map[string]any)
+	if !ok {
+		return data
+	}
+	format := localeFormats[locale]
+	localized := make(map[string]any, len(values))
+	for key, value := range values {
+		switch value := value.(type) {
+		case time.Time:
+			localized[key] = format.formatTime(value.UTC(), format.dateTimeLayout)
+		case Date:
+			localized[key] = format.formatTime(time.Time(value), format.dateLayout)
+		case int:
+			localized[key] = format.formatNumber(strconv.FormatInt(int64(value), 10))
+		case int32:
+			localized[key] = format.formatNumber(strconv.FormatInt(int64(value), 10))
+		case int64:
+			localized[key] = format.formatNumber(strconv.FormatInt(value, 10))
+		case float64:
+			localized[key] = format.formatNumber(strconv.FormatFloat(value, 'f', -1, 64))
+		default:
+			localized[key] = value
+		}
+	}
+	return localized
+}
+
+// formatTime() writes t using layout, with the month name translated.
+func (f localeFormat) formatTime(t time.Time, layout string) string {
+	return strings.Replace(t.Format(layout), t.Month().String(), f.months[t.Month()-1], 1)
+}
+
+// formatNumber() adds the locale's thousands separator to a number written by strconv
+// and swaps in its decimal separator.
+func (f localeFormat) formatNumber(number string) string {
+	sign := ""
+	if strings.HasPrefix(number, "-") {
+		sign, number = "-", number[1:]
+	}
+	integer, fraction, hasFraction := strings.Cut(number, ".")
+	var b strings.Builder
+	b.WriteString(sign)
+	for i, digit := range integer {
+		if i > 0 && (len(integer)-i)%3 == 0 {
+			b.WriteString(f.thousands)
+		}
+		b.WriteRune(digit)
+	}
+	if hasFraction {
+		b.WriteString(f.decimal)
+		b.WriteString(fraction)
+	}
+	return b.String()
+}
@@ -0,0 +1,95 @@
+package mailer
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNormalizeLocale(t *testing.T) {
+	tests := []struct {
+		tag    string
+		locale string
+		ok     bool
+	}{
+		{"en", "en", true},
+		{"FR", "fr", true},
+		{"fr-CA", "fr", true},
+		{"de_AT", "de", true},
+		{" es ", "es", true},
+		{"pt-BR", "", false},
+		{"", "", false},
+		{"*", "", false},
+	}
+	for _, tt := range tests {
+		locale, ok := NormalizeLocale(tt.tag)
+		if locale != tt.locale || ok != tt.ok {
+			t.Errorf("NormalizeLocale(%q) = %q, %v; want %q, %v", tt.tag, locale, ok, tt.locale, tt.ok)
+		}
+	}
+}
+
+func TestLocalize(t *testing.T) {
+	at := time.Date(2026, time.March, 5, 14, 7, 0, 0, time.UTC)
+	data := map[string]any{
+		"sentAt":  at,
+		"date":    Date(at),
+		"count":   1234567,
+		"small":   int64(42),
+		"ratio":   -1234.5,
+		"userID":  "12345",
+		"missing": nil,
+	}
+	tests := []struct {
+		locale string
+		want   map[string]any
+	}{
+		{"en", map[string]any{"sentAt": "March 5, 2026 at 14:07 UTC", "date": "March 5, 2026", "count": "1,234,567", "small": "42", "ratio": "-1,234.5"}},
+		{"fr", map[string]any{"sentAt": "5 mars 2026 à 14:07 UTC", "date": "5 mars 2026", "count": "1\u202f234\u202f567", "small": "42", "ratio": "-1\u202f234,5"}},
+		{"de", map[string]any{"sentAt": "5. März 2026 um 14:07 UTC", "date": "5. März 2026", "count": "1.234.567", "small": "42", "ratio": "-1.234,5"}},
+		{"es", map[string]any{"sentAt": "5 de marzo de 2026, 14:07 UTC", "date": "5 de marzo de 2026", "count": "1.234.567", "small": "42", "ratio": "-1.234,5"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.locale, func(t *testing.T) {
+			localized := localize(data, tt.locale).(map[string]any)
+			for key, want := range tt.want {
+				if localized[key] != want {
+					t.Errorf("%s: got %q, want %q", key, localized[key], want)
+				}
+			}
+			if localized["userID"] != "12345" || localized["missing"] != nil {
+				t.Error("expected other values to be passed through unchanged")
+			}
+		})
+	}
+	if _, ok := data["sentAt"].(time.Time); !ok {
+		t.Error("expected the original data to be left alone")
+	}
+	// dates stay in their own location, while times are shown in UTC
+	auckland := at.Add(12 * time.Hour).In(time.FixedZone("NZDT", 13*60*60))
+	localized := localize(map[string]any{"date": Date(auckland), "sentAt": auckland}, "en").(map[string]any)
+	if localized["date"] != "March 6, 2026" || localized["sentAt"] != "March 6, 2026 at 02:07 UTC" {
+		t.Errorf("unexpected date %q and time %q", localized["date"], localized["sentAt"])
+	}
+}
+
+func TestRenderFallsBackToEnglish(t *testing.T) {
+	m := New(NewMemoryTransport(), "no-reply@musicalzoe.test")
+	for _, locale := range []string{"", "pt", "fr"} {
+		// user_password_change.tmpl has no translations
+		msg, err := m.Render("zoe@example.com", "user_password_change.tmpl", locale, map[string]any{"userName": "Zoe"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(msg.HTMLBody, "Follow us:") {
+			t.Errorf("locale %q: expected the English template", locale)
+		}
+	}
+	msg, err := m.Render("zoe@example.com", "user_welcome.tmpl", "fr-CA", map[string]any{"name": "Zoé"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Subject != "Bienvenue sur musicalzoe !" {
+		t.Errorf("expected the French welcome email, got subject %q", msg.Subject)
+	}
+}
@@ -1,92 +1,154 @@
-package mailer
-
-import (
-	"bytes"
-	"embed"
-	"html/template"
-	"time"
-
-	mail "github.com/go-mail/mail/v2"
-)
-
-// Below we declare a new variable with the type embed.FS (embedded file system) to hold
-// our email templates.
-
-//go:embed "templates/*"
-var templateFS embed.FS
-
-// Define a Mailer struct which contains a mail.Dialer instance (used to connect to a
-// SMTP server) and the sender information for your emails
-type Mailer struct {
-	dialer *mail.Dialer
-	sender string
-}
-
-func New(host string, port int, username, password, sender string) Mailer {
-	// Initialize a new mail.Dialer instance with the given SMTP server settings. We
-	// also configure this to use a 5-second timeout whenever we send an email.
-	dialer := mail.NewDialer(host, port, username, password)
-	dialer.Timeout = 5 * time.Second
-	// Return a Mailer instance containing the dialer and sender information.
-	return Mailer{
-		dialer: dialer,
-		sender: sender,
-	}
-}
-
-// Define a Send() method on the Mailer type. This takes the recipient email address
-// as the first parameter, the name of the file containing the templates, and any
-// dynamic data for the templates as an any parameter.
-func (m Mailer) Send(recipient, templateFile string, data any) error {
-	// Use the ParseFS() method to parse the required template file from the embedded
-	// file system.
-	tmpl, err := template.New("email").ParseFS(templateFS, "templates/"+templateFile)
-	if err != nil {
-		return err
-	}
-	// Execute the named template "subject", passing in the dynamic data and storing the
-	// result in a bytes.Buffer variable.
-	subject := new(bytes.Buffer)
-	err = tmpl.ExecuteTemplate(subject, "subject", data)
-	if err != nil {
-		return err
-	}
-	// Follow the same pattern to execute the "plainBody" template and store the result
-	// in the plainBody variable.
-	plainBody := new(bytes.Buffer)
-	err = tmpl.ExecuteTemplate(plainBody, "plainBody", data)
-	if err != nil {
-		return err
-	}
-	// And likewise with the "htmlBody" template.
-	htmlBody := new(bytes.Buffer)
-	err = tmpl.ExecuteTemplate(htmlBody, "htmlBody", data)
-	if err != nil {
-		return err
-	}
-	// Use the mail.NewMessage() function to initialize a new mail.Message instance.
-	// Then we use the SetHeader() method to set the email recipient, sender and subject
-	// headers, the SetBody() method to set the plain-text body, and the AddAlternative()
-	// method to set the HTML body. It's important to note that AddAlternative() should
-	// always be called *after* SetBody().
-	msg := mail.NewMessage()
-	msg.SetHeader("To", recipient)
-	msg.SetHeader("From", m.sender)
-	msg.SetHeader("Subject", subject.String())
-	msg.SetBody("text/plain", plainBody.String())
-	msg.AddAlternative("text/html", htmlBody.String())
-	// Call the DialAndSend() method on the dialer, passing in the message to send. This
-	// opens a connection to the SMTP server, sends the message, then closes the
-	// connection. If there is a timeout, it will return a "dial tcp: i/o timeout"
-	// error.
-	for i := 1; i <= 3; i++ {
-		err = m.dialer.DialAndSend(msg)
-		// If everything worked, return nil.
-		if nil == err {
-			return nil
-		}
-		// If it didn't work, sleep for a short time and retry.
-		time.Sleep(500 * time.Millisecond)
-	}
-	return err
-}
+package mailer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"embed"
+	"html/template"
+	texttemplate "text/template"
+	"time"
+)
+
+// Below we declare a new variable with the type embed.FS (embedded file system) to hold
+// our email templates.
+
+//go:embed "templates/*"
+var templateFS embed.FS
+
+// Message is a rendered email, ready to be handed to a Transport. Headers holds any
+// extra headers to send, such as List-Unsubscribe.
+type Message struct {
+	ID        string            `json:"id"`
+	To        string            `json:"to"`
+	From      string            `json:"from"`
+	Subject   string            `json:"subject"`
+	PlainBody string            `json:"plain_body"`
+	HTMLBody  string            `json:"html_body"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	SentAt    time.Time         `json:"sent_at"`
+}
+
+// Transport delivers rendered messages. SMTPTransport sends them for real, while the
+// file, log and memory transports keep them local for development and tests.
+type Transport interface {
+	Deliver(msg *Message) error
+}
+
+// Outbox is implemented by transports that keep the messages they deliver, so that they
+// can be inspected during development and in tests. Messages are returned in the order
+// they were delivered.
+type Outbox interface {
+	Messages() ([]Message, error)
+}
+
+// Define a Mailer struct which contains the transport used to deliver messages and the
+// sender information for your emails
+type Mailer struct {
+	transport Transport
+	sender    string
+}
+
+func New(transport Transport, sender string) Mailer {
+	return Mailer{
+		transport: transport,
+		sender:    sender,
+	}
+}
+
+// Outbox() returns the mailer's transport as an Outbox, if it keeps delivered messages.
+func (m Mailer) Outbox() (Outbox, bool) {
+	outbox, ok := m.transport.(Outbox)
+	return outbox, ok
+}
+
+// Define a Send() method on the Mailer type. This takes the recipient email address
+// as the first parameter, the name of the file containing the templates, the recipient's
+// locale and any dynamic data for the templates as an any parameter. The message is
+// delivered straight away, with no retries; queue it in the email outbox instead when it
+// must not be lost.
+func (m Mailer) Send(recipient, templateFile, locale string, data any) error {
+	msg, err := m.Render(recipient, templateFile, locale, data)
+	if err != nil {
+		return err
+	}
+	return m.Deliver(msg)
+}
+
+// Render() executes the subject, plainBody and htmlBody templates in templateFile and
+// returns the resulting message, ready to be delivered or queued. The translation of the
+// template for locale is used when there is one, falling back to English, and dates and
+// numbers in the data are formatted for the locale. Each rendered message gets a unique ID.
+func (m Mailer) Render(recipient, templateFile, locale string, data any) (*Message, error) {
+	return m.render(recipient, templateFile, locale, data, false)
+}
+
+// render() does the work for Render() and Preview(). In strict mode a template that
+// refers to a key missing from the data is an error rather than an empty value.
+func (m Mailer) render(recipient, templateFile, locale string, data any, strict bool) (*Message, error) {
+	locale = resolveLocale(locale)
+	data = localize(data, locale)
+	file := "templates/" + resolveTemplate(templateFile, locale)
+	funcs := map[string]any{
+		"locale": func() string { return locale },
+	}
+	// The subject and plain text body are not HTML, so they are executed with
+	// text/template, which leaves characters such as the + in a URL or the ' in a
+	// name alone rather than escaping them.
+	text := texttemplate.New("email").Funcs(funcs)
+	if strict {
+		text = text.Option("missingkey=error")
+	}
+	text, err := text.ParseFS(templateFS, file)
+	if err != nil {
+		return nil, err
+	}
+	// Execute the named template "subject", passing in the dynamic data and storing the
+	// result in a bytes.Buffer variable.
+	subject := new(bytes.Buffer)
+	err = text.ExecuteTemplate(subject, "subject", data)
+	if err != nil {
+		return nil, err
+	}
+	// Follow the same pattern to execute the "plainBody" template and store the result
+	// in the plainBody variable.
+	plainBody := new(bytes.Buffer)
+	err = text.ExecuteTemplate(plainBody, "plainBody", data)
+	if err != nil {
+		return nil, err
+	}
+	// Use the ParseFS() method to parse the shared layout and partials together with the
+	// required template file from the embedded file system. The email template defines
+	// "title" and "content", and the layout builds "htmlBody" from them. Being parsed
+	// last, it can also replace the partials' blocks.
+	html := template.New("email").Funcs(funcs)
+	if strict {
+		html = html.Option("missingkey=error")
+	}
+	html, err = html.ParseFS(templateFS, "templates/layouts/*.tmpl", "templates/partials/*.tmpl", file)
+	if err != nil {
+		return nil, err
+	}
+	// And execute the "htmlBody" template, which html/template escapes as it goes.
+	htmlBody := new(bytes.Buffer)
+	err = html.ExecuteTemplate(htmlBody, "htmlBody", data)
+	if err != nil {
+		return nil, err
+	}
+	msg := &Message{
+		ID:        rand.Text(),
+		To:        recipient,
+		From:      m.sender,
+		Subject:   subject.String(),
+		PlainBody: plainBody.String(),
+		HTMLBody:  htmlBody.String(),
+		SentAt:    time.Now().UTC(),
+	}
+	return msg, nil
+}
+
+// Deliver() hands a rendered message to the mailer's transport. Delivering the same
+// message again, for example after an ambiguous failure, keeps its ID and Message-ID
+// header so that it can be recognised as a duplicate.
+func (m Mailer) Deliver(msg *Message) error {
+	return m.transport.Deliver(msg)
+}
@@ -0,0 +1,220 @@
+package mailer
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestSendWithMemoryTransport(t *testing.T) {
+	transport := NewMemoryTransport()
+	m := New(transport, "musicalzoe <no-reply@musicalzoe.test>")
+
+	err := m.Send("zoe@example.com", "user_welcome.tmpl", DefaultLocale, map[string]any{
+		"name":          "Zoe",
+		"userID":        "42",
+		"activationURL": "http://localhost:4000/v1/api/activated/token=ABC",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages, err := transport.Messages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(messages))
+	}
+	msg := messages[0]
+	if msg.To != "zoe@example.com" {
+		t.Errorf("expected recipient zoe@example.com, got %q", msg.To)
+	}
+	if msg.Subject != "Welcome to musicalzoe!" {
+		t.Errorf("unexpected subject %q", msg.Subject)
+	}
+	if !strings.Contains(msg.PlainBody, "token=ABC") || !strings.Contains(msg.HTMLBody, "token=ABC") {
+		t.Error("expected both bodies to contain the activation link")
+	}
+	if msg.ID == "" || msg.SentAt.IsZero() {
+		t.Error("expected the message to have an ID and send time")
+	}
+
+	transport.Reset()
+	messages, _ = transport.Messages()
+	if len(messages) != 0 {
+		t.Errorf("expected no messages after reset, got %d", len(messages))
+	}
+}
+
+func TestMemoryTransportConcurrentDelivery(t *testing.T) {
+	transport := NewMemoryTransport()
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			transport.Deliver(&Message{To: "zoe@example.com"})
+		}()
+	}
+	wg.Wait()
+	messages, _ := transport.Messages()
+	if len(messages) != 20 {
+		t.Errorf("expected 20 messages, got %d", len(messages))
+	}
+}
+
+func TestDeliveryIsIdempotent(t *testing.T) {
+	memory := NewMemoryTransport()
+	file, err := NewFileTransport(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, transport := range map[string]interface {
+		Transport
+		Outbox
+	}{"memory": memory, "file": file} {
+		t.Run(name, func(t *testing.T) {
+			m := New(transport, "no-reply@musicalzoe.test")
+			msg, err := m.Render("zoe@example.com", "user_password_change.tmpl", DefaultLocale, map[string]any{"userName": "Zoe"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for range 2 {
+				err = m.Deliver(msg)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			messages, err := transport.Messages()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(messages) != 1 || messages[0].ID != msg.ID {
+				t.Errorf("expected the message to be delivered once, got %d messages", len(messages))
+			}
+		})
+	}
+}
+
+func TestFileTransportRoundTrip(t *testing.T) {
+	transport, err := NewFileTransport(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := New(transport, "no-reply@musicalzoe.test")
+
+	for _, name := range []string{"Zoe", "Zoë"} {
+		err = m.Send("zoe@example.com", "user_welcome.tmpl", DefaultLocale, map[string]any{
+			"name":          name,
+			"userID":        "42",
+			"activationURL": "http://localhost:4000/v1/api/activated/token=" + strings.Repeat("A", 80),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	messages, err := transport.Messages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 2 {
+		t.Fatalf("expected 2 messages, got %d", len(messages))
+	}
+	msg := messages[1]
+	if msg.To != "zoe@example.com" || msg.From != "no-reply@musicalzoe.test" {
+		t.Errorf("unexpected addresses: to %q, from %q", msg.To, msg.From)
+	}
+	if msg.Subject != "Welcome to musicalzoe!" {
+		t.Errorf("unexpected subject %q", msg.Subject)
+	}
+	if !strings.Contains(msg.PlainBody, "Hi Zoë,") {
+		t.Errorf("expected the plain body to be decoded, got %q", msg.PlainBody)
+	}
+	if !strings.Contains(msg.HTMLBody, "token="+strings.Repeat("A", 80)) {
+		t.Error("expected the html body to contain the unwrapped activation link")
+	}
+	if msg.ID == "" || msg.SentAt.IsZero() {
+		t.Error("expected the message ID and send time to be read back")
+	}
+}
+
+func TestFileTransportKeepsHeaders(t *testing.T) {
+	transport, err := NewFileTransport(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := New(transport, "no-reply@musicalzoe.test")
+	msg, err := m.Render("zoe@example.com", "user_password_change.tmpl", DefaultLocale, map[string]any{"userName": "Zoe"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg.Headers = map[string]string{
+		"List-Unsubscribe":      "<http://localhost:4000/v1/api/digest/unsubscribe?token=ABC>",
+		"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+	}
+	err = m.Deliver(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages, err := transport.Messages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(messages))
+	}
+	if len(messages[0].Headers) != 2 {
+		t.Errorf("expected only the extra headers to be read back, got %v", messages[0].Headers)
+	}
+	for name, value := range msg.Headers {
+		if messages[0].Headers[name] != value {
+			t.Errorf("expected %s to be %q, got %q", name, value, messages[0].Headers[name])
+		}
+	}
+}
+
+func TestRenderEscapesOnlyHTML(t *testing.T) {
+	m := New(NewMemoryTransport(), "no-reply@musicalzoe.test")
+	msg, err := m.Render("support@musicalzoe.test", "contact_support_notification.tmpl", DefaultLocale, map[string]any{
+		"messageID": "42",
+		"name":      "Zoe O'Brien",
+		"email":     "zoe@example.com",
+		"subject":   "Tracks & <lyrics>",
+		"message":   "https://www.last.fm/music/M83/_/Midnight+City",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Zoe O'Brien", "Tracks & <lyrics>", "Midnight+City"} {
+		if !strings.Contains(msg.Subject+msg.PlainBody, want) {
+			t.Errorf("expected the subject or plain body to contain %q unescaped", want)
+		}
+	}
+	if strings.Contains(msg.HTMLBody, "<lyrics>") || !strings.Contains(msg.HTMLBody, "&lt;lyrics&gt;") {
+		t.Error("expected the html body to be escaped")
+	}
+}
+
+func TestContactAcknowledgmentQuotesNothingFromTheSender(t *testing.T) {
+	m := New(NewMemoryTransport(), "no-reply@musicalzoe.test")
+	msg, err := m.Render("zoe@example.com", "contact_acknowledgment.tmpl", DefaultLocale, map[string]any{
+		"messageID": "42",
+		"name":      "Win a prize at https://spam.example",
+		"subject":   "Claim your prize",
+		"message":   "Visit https://spam.example now",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, body := range []string{msg.Subject, msg.PlainBody, msg.HTMLBody} {
+		if strings.Contains(body, "spam.example") || strings.Contains(body, "prize") {
+			t.Errorf("expected the acknowledgment not to quote the sender, got %q", body)
+		}
+	}
+	if !strings.Contains(msg.PlainBody, "#42") {
+		t.Error("expected the acknowledgment to carry the reference number")
+	}
+}
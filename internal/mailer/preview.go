@@ -0,0 +1,159 @@
+package mailer
+
+import (
+	"fmt"
+	"io/fs"
+	"slices"
+	"strings"
+	"time"
+)
+
+// PreviewRecipient is the recipient shown on previewed emails.
+const PreviewRecipient = "zoe@example.com"
+
+// sampleTime is the moment previewed emails are sent at.
+var sampleTime = time.Date(2026, time.October, 16, 9, 30, 0, 0, time.UTC)
+
+// sampleData holds realistic data for every email template, so that any of them can be
+// previewed without going through the flow that normally sends it. A template added
+// without sample data fails the template tests.
+var sampleData = map[string]map[string]any{
+	"contact_acknowledgment.tmpl": {
+		"messageID": "42",
+	},
+	"contact_support_notification.tmpl": {
+		"messageID": "42",
+		"name":      "Zoe",
+		"email":     PreviewRecipient,
+		"subject":   "Lyrics missing for a track",
+		"message":   "The lyrics for \"Midnight City\" by M83 aren't showing up.\nCould you take a look?",
+		"ipAddress": "203.0.113.7",
+		"sentAt":    sampleTime,
+	},
+	"user_account_deleted.tmpl": {
+		"userName": "Zoe",
+	},
+	"user_account_locked.tmpl": {
+		"userName":    "Zoe",
+		"attempts":    5,
+		"ipAddress":   "203.0.113.7",
+		"lockedUntil": sampleTime.Add(15 * time.Minute),
+	},
+	"user_activation_reminder.tmpl": {
+		"userName":        "Zoe",
+		"activationURL":   "http://localhost:4000/v1/api/activated/token=PREVIEWTOKEN",
+		"activationToken": "PREVIEWTOKEN",
+		"deletionDate":    Date(sampleTime.AddDate(0, 0, 7)),
+	},
+	"user_email_change_confirm.tmpl": {
+		"userName":         "Zoe",
+		"newEmail":         "zoe.new@example.com",
+		"emailChangeURL":   "http://localhost:4000/v1/api/me/email/token=PREVIEWTOKEN",
+		"emailChangeToken": "PREVIEWTOKEN",
+	},
+	"user_email_change_notice.tmpl": {
+		"userName":         "Zoe",
+		"newEmail":         "zoe.new@example.com",
+		"emailCancelURL":   "http://localhost:4000/v1/api/me/email/cancel/token=PREVIEWTOKEN",
+		"emailCancelToken": "PREVIEWTOKEN",
+	},
+	"user_magic_link.tmpl": {
+		"userName":       "Zoe",
+		"magicLinkURL":   "http://localhost:4000/v1/api/authentication/magic-link/token=PREVIEWTOKEN",
+		"magicLinkToken": "PREVIEWTOKEN",
+	},
+	"user_mfa_enabled.tmpl": {
+		"userName": "Zoe",
+	},
+	"user_new_device_login.tmpl": {
+		"userName":          "Zoe",
+		"device":            "Mozilla/5.0 (X11; Linux x86_64) Firefox/131.0",
+		"ipAddress":         "203.0.113.7",
+		"loginTime":         sampleTime,
+		"revokeSessionsURL": "http://localhost:4000/v1/api/sessions/revoke/token=PREVIEWTOKEN",
+	},
+	"user_password_change.tmpl": {
+		"userName": "Zoe",
+		"loginURL": "http://localhost:4000/v1/api/authentication",
+	},
+	"user_password_reset.tmpl": {
+		"userName":           "Zoe",
+		"passwordResetURL":   "http://localhost:4000/v1/api/password/token=PREVIEWTOKEN",
+		"passwordResetToken": "PREVIEWTOKEN",
+	},
+	"user_recovery_code_used.tmpl": {
+		"userName":       "Zoe",
+		"remainingCodes": 7,
+		"usedAt":         sampleTime,
+	},
+	"user_succesful_activation.tmpl": {
+		"userName": "Zoe",
+		"loginURL": "http://localhost:4000/v1/api/authentication",
+	},
+	"user_weekly_digest.tmpl": {
+		"userName": "Zoe",
+		"weekOf":   Date(sampleTime),
+		"tracks": []map[string]string{
+			{"name": "Midnight City", "artist": "M83", "url": "https://www.last.fm/music/M83/_/Midnight+City"},
+			{"name": "Dreams", "artist": "Fleetwood Mac", "url": "https://www.last.fm/music/Fleetwood+Mac/_/Dreams"},
+		},
+		"artists": []map[string]string{
+			{"name": "M83", "url": "https://www.last.fm/music/M83"},
+			{"name": "Fleetwood Mac", "url": "https://www.last.fm/music/Fleetwood+Mac"},
+		},
+		"headlines": []map[string]string{
+			{"title": "M83 announce a new tour", "source": "Pitchfork", "url": "https://example.com/news/m83-tour"},
+		},
+		"genres":         "electronic, indie",
+		"country":        "US",
+		"unsubscribeURL": "http://localhost:4000/v1/api/digest/unsubscribe?token=PREVIEWTOKEN",
+	},
+	"user_welcome.tmpl": {
+		"name":            "Zoe",
+		"userID":          "42",
+		"activationURL":   "http://localhost:4000/v1/api/activated/token=PREVIEWTOKEN",
+		"activationToken": "PREVIEWTOKEN",
+	},
+}
+
+// Templates() lists the email templates that can be rendered, in alphabetical order.
+// Translations such as user_welcome.fr.tmpl are not listed separately; they are picked
+// by the locale an email is rendered for.
+func Templates() ([]string, error) {
+	files, err := fs.Glob(templateFS, "templates/*.tmpl")
+	if err != nil {
+		return nil, err
+	}
+	templates := []string{}
+	for _, file := range files {
+		name := file[len("templates/"):]
+		if strings.Count(name, ".") == 1 {
+			templates = append(templates, name)
+		}
+	}
+	slices.Sort(templates)
+	return templates, nil
+}
+
+// Translations() lists the locales that templateFile has been translated into, in
+// alphabetical order. English, the default, is not included.
+func Translations(templateFile string) []string {
+	translations := []string{}
+	for _, locale := range Locales {
+		if locale != DefaultLocale && resolveTemplate(templateFile, locale) != templateFile {
+			translations = append(translations, locale)
+		}
+	}
+	return translations
+}
+
+// Preview() renders a template for locale with its sample data. Unlike Render(), a
+// template that refers to data the sample doesn't provide is an error, so previews catch
+// typos.
+func (m Mailer) Preview(templateFile, locale string) (*Message, error) {
+	data, ok := sampleData[templateFile]
+	if !ok {
+		return nil, fmt.Errorf("no sample data for template %q", templateFile)
+	}
+	return m.render(PreviewRecipient, templateFile, locale, data, true)
+}
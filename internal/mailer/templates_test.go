@@ -0,0 +1,121 @@
+package mailer
+
+import (
+	"io/fs"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestTemplatesRenderWithLayout(t *testing.T) {
+	templates, err := Templates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(templates) == 0 {
+		t.Fatal("expected to find email templates")
+	}
+	m := New(NewMemoryTransport(), "no-reply@musicalzoe.test")
+
+	for _, name := range templates {
+		t.Run(name, func(t *testing.T) {
+			msg, err := m.Preview(name, DefaultLocale)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.TrimSpace(msg.Subject) == "" || strings.Contains(msg.Subject, "\n") {
+				t.Errorf("expected a single line subject, got %q", msg.Subject)
+			}
+			if strings.TrimSpace(msg.PlainBody) == "" {
+				t.Error("expected a plain text body")
+			}
+			for _, want := range []string{"<!DOCTYPE html>", `<div class="header">`, `<div class="content">`, "Follow us:", "</html>"} {
+				if !strings.Contains(msg.HTMLBody, want) {
+					t.Errorf("expected the html body to contain %q from the base layout", want)
+				}
+			}
+			if strings.Contains(msg.HTMLBody, "<title></title>") {
+				t.Error("expected the template to define a title")
+			}
+		})
+	}
+}
+
+func TestSampleDataMatchesTemplates(t *testing.T) {
+	templates, err := Templates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name := range sampleData {
+		if !slices.Contains(templates, name) {
+			t.Errorf("sample data for %q has no matching template", name)
+		}
+	}
+}
+
+func TestPreviewRejectsMissingData(t *testing.T) {
+	m := New(NewMemoryTransport(), "no-reply@musicalzoe.test")
+	_, err := m.Preview("user_does_not_exist.tmpl", DefaultLocale)
+	if err == nil {
+		t.Error("expected an error for a template without sample data")
+	}
+	// strict rendering fails on a missing key, while Render leaves it empty
+	_, err = m.render(PreviewRecipient, "user_mfa_enabled.tmpl", DefaultLocale, map[string]any{}, true)
+	if err == nil {
+		t.Error("expected strict rendering to fail on a missing key")
+	}
+	_, err = m.Render(PreviewRecipient, "user_mfa_enabled.tmpl", DefaultLocale, map[string]any{})
+	if err != nil {
+		t.Errorf("expected Render to tolerate a missing key, got %v", err)
+	}
+}
+
+func TestTranslationsRender(t *testing.T) {
+	templates, err := Templates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := fs.Glob(templateFS, "templates/*.*.tmpl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("expected to find translated email templates")
+	}
+	m := New(NewMemoryTransport(), "no-reply@musicalzoe.test")
+
+	for _, file := range files {
+		name := file[len("templates/"):]
+		t.Run(name, func(t *testing.T) {
+			base, locale, _ := strings.Cut(name, ".")
+			base += ".tmpl"
+			locale = strings.TrimSuffix(locale, ".tmpl")
+			if !slices.Contains(templates, base) {
+				t.Fatalf("expected an English %s to fall back to", base)
+			}
+			if !slices.Contains(Locales, locale) || locale == DefaultLocale {
+				t.Fatalf("unexpected locale %q", locale)
+			}
+			english, err := m.Preview(base, DefaultLocale)
+			if err != nil {
+				t.Fatal(err)
+			}
+			msg, err := m.Preview(base, locale)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if msg.Subject == english.Subject || msg.PlainBody == english.PlainBody {
+				t.Error("expected the translation to be used")
+			}
+			if !strings.Contains(msg.HTMLBody, `<html lang="`+locale+`">`) {
+				t.Errorf("expected the html body to be marked as %q", locale)
+			}
+			if strings.Contains(msg.HTMLBody, "Follow us:") {
+				t.Error("expected the footer to be translated")
+			}
+			if !slices.Contains(Translations(base), locale) {
+				t.Errorf("expected %s to list %q as a translation", base, locale)
+			}
+		})
+	}
+}
@@ -0,0 +1,252 @@
+package mailer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	gomail "github.com/go-mail/mail/v2"
+	"go.uber.org/zap"
+)
+
+// Define the names of the transports that can be selected with the -mailer-transport
+// flag.
+const (
+	TransportSMTP   = "smtp"
+	TransportFile   = "file"
+	TransportLog    = "log"
+	TransportMemory = "memory"
+)
+
+// Transports lists every transport name, for validating configuration.
+var Transports = []string{TransportSMTP, TransportFile, TransportLog, TransportMemory}
+
+// toMailMessage() converts a rendered message into the go-mail representation used by
+// the SMTP and file transports.
+func toMailMessage(msg *Message) *gomail.Message {
+	// Use the gomail.NewMessage() function to initialize a new gomail.Message instance.
+	// Then we use the SetHeader() method to set the email recipient, sender and subject
+	// headers, the SetBody() method to set the plain-text body, and the AddAlternative()
+	// method to set the HTML body. It's important to note that AddAlternative() should
+	// always be called *after* SetBody().
+	m := gomail.NewMessage()
+	m.SetHeader("To", msg.To)
+	m.SetHeader("From", msg.From)
+	m.SetHeader("Subject", msg.Subject)
+	m.SetHeader("Message-ID", "<"+msg.ID+"@musicalzoe>")
+	m.SetDateHeader("Date", msg.SentAt)
+	for name, value := range msg.Headers {
+		m.SetHeader(name, value)
+	}
+	m.SetBody("text/plain", msg.PlainBody)
+	m.AddAlternative("text/html", msg.HTMLBody)
+	return m
+}
+
+// SMTPTransport sends messages through an SMTP server.
+type SMTPTransport struct {
+	dialer *gomail.Dialer
+}
+
+func NewSMTPTransport(host string, port int, username, password string) *SMTPTransport {
+	// Initialize a new gomail.Dialer instance with the given SMTP server settings. We
+	// also configure this to use a 5-second timeout whenever we send an email.
+	dialer := gomail.NewDialer(host, port, username, password)
+	dialer.Timeout = 5 * time.Second
+	return &SMTPTransport{dialer: dialer}
+}
+
+// Deliver() makes a single attempt at sending the message, retries are left to the
+// email outbox.
+func (t *SMTPTransport) Deliver(msg *Message) error {
+	// Call the DialAndSend() method on the dialer, passing in the message to send. This
+	// opens a connection to the SMTP server, sends the message, then closes the
+	// connection. If there is a timeout, it will return a "dial tcp: i/o timeout"
+	// error.
+	return t.dialer.DialAndSend(toMailMessage(msg))
+}
+
+// FileTransport writes each message to its own .eml file in a directory, which can be
+// opened with any mail client. The files are named so that they sort by the time the
+// message was rendered, and a message that already has a file is not written again.
+type FileTransport struct {
+	dir string
+}
+
+func NewFileTransport(dir string) (*FileTransport, error) {
+	err := os.MkdirAll(dir, 0o750)
+	if err != nil {
+		return nil, err
+	}
+	return &FileTransport{dir: dir}, nil
+}
+
+func (t *FileTransport) Deliver(msg *Message) error {
+	name := fmt.Sprintf("%s-%s.eml", msg.SentAt.UTC().Format("20060102T150405.000000000"), msg.ID)
+	file, err := os.OpenFile(filepath.Join(t.dir, name), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o640)
+	if err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			return nil
+		}
+		return err
+	}
+	_, err = toMailMessage(msg).WriteTo(file)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Messages() reads back every .eml file in the outbox directory.
+func (t *FileTransport) Messages() ([]Message, error) {
+	paths, err := filepath.Glob(filepath.Join(t.dir, "*.eml"))
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(paths)
+	messages := make([]Message, 0, len(paths))
+	for _, path := range paths {
+		msg, err := readEMLFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", filepath.Base(path), err)
+		}
+		messages = append(messages, *msg)
+	}
+	return messages, nil
+}
+
+// standardHeaders are the headers every message is written with, anything else read
+// back from a file goes in Message.Headers.
+var standardHeaders = []string{"To", "From", "Subject", "Message-Id", "Date", "Mime-Version", "Content-Type", "Content-Transfer-Encoding"}
+
+// readEMLFile() parses a message written by FileTransport.
+func readEMLFile(path string) (*Message, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	parsed, err := mail.ReadMessage(file)
+	if err != nil {
+		return nil, err
+	}
+	decoder := new(mime.WordDecoder)
+	subject, err := decoder.DecodeHeader(parsed.Header.Get("Subject"))
+	if err != nil {
+		return nil, err
+	}
+	msg := &Message{
+		ID:      strings.TrimSuffix(strings.TrimPrefix(parsed.Header.Get("Message-ID"), "<"), "@musicalzoe>"),
+		To:      parsed.Header.Get("To"),
+		From:    parsed.Header.Get("From"),
+		Subject: subject,
+	}
+	msg.SentAt, err = parsed.Header.Date()
+	if err != nil {
+		return nil, err
+	}
+	for name := range parsed.Header {
+		if !slices.Contains(standardHeaders, name) {
+			if msg.Headers == nil {
+				msg.Headers = map[string]string{}
+			}
+			msg.Headers[name] = parsed.Header.Get(name)
+		}
+	}
+	_, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, err
+	}
+	parts := multipart.NewReader(parsed.Body, params["boundary"])
+	for {
+		part, err := parts.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		var body io.Reader = part
+		if part.Header.Get("Content-Transfer-Encoding") == "quoted-printable" {
+			body = quotedprintable.NewReader(part)
+		}
+		content, err := io.ReadAll(body)
+		if err != nil {
+			return nil, err
+		}
+		mediaType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		switch mediaType {
+		case "text/plain":
+			msg.PlainBody = string(content)
+		case "text/html":
+			msg.HTMLBody = string(content)
+		}
+	}
+	return msg, nil
+}
+
+// LogTransport writes each message to the application log instead of sending it, so
+// that links such as activation URLs can be copied from the log during development.
+type LogTransport struct {
+	logger *zap.Logger
+}
+
+func NewLogTransport(logger *zap.Logger) *LogTransport {
+	return &LogTransport{logger: logger}
+}
+
+func (t *LogTransport) Deliver(msg *Message) error {
+	t.logger.Info("email captured by log transport",
+		zap.String("message_id", msg.ID),
+		zap.String("to", msg.To),
+		zap.String("subject", msg.Subject),
+		zap.String("plain_body", msg.PlainBody))
+	return nil
+}
+
+// MemoryTransport keeps messages in memory, ignoring a message whose ID it already
+// holds. It is safe for concurrent use, so tests can assert on the emails sent by
+// background goroutines.
+type MemoryTransport struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func NewMemoryTransport() *MemoryTransport {
+	return &MemoryTransport{}
+}
+
+func (t *MemoryTransport) Deliver(msg *Message) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if msg.ID != "" && slices.ContainsFunc(t.messages, func(m Message) bool { return m.ID == msg.ID }) {
+		return nil
+	}
+	t.messages = append(t.messages, *msg)
+	return nil
+}
+
+func (t *MemoryTransport) Messages() ([]Message, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return slices.Clone(t.messages), nil
+}
+
+// Reset() discards every message delivered so far.
+func (t *MemoryTransport) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.messages = nil
+}
@@ -0,0 +1,71 @@
+package passwords
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultBreachLookupTimeout = 3 * time.Second
+)
+
+// BreachChecker looks passwords up in a Have I Been Pwned compatible range API. Only
+// the first five characters of the password's SHA-1 hash are ever sent, the API answers
+// with every breached hash suffix sharing that prefix and the match is made locally.
+type BreachChecker struct {
+	baseURL string
+	client  *http.Client
+}
+
+// NewBreachChecker() returns a checker for the range API at baseURL, for example
+// https://api.pwnedpasswords.com or a local mirror serving the same /range/ endpoint.
+func NewBreachChecker(baseURL string) *BreachChecker {
+	return &BreachChecker{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		client:  &http.Client{Timeout: DefaultBreachLookupTimeout},
+	}
+}
+
+// Breached() reports whether password appears in the breach corpus.
+func (c *BreachChecker) Breached(ctx context.Context, password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/range/"+prefix, nil)
+	if err != nil {
+		return false, err
+	}
+	// padding hides how many suffixes the prefix really has from anyone watching
+	req.Header.Set("Add-Padding", "true")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("breach lookup returned status %d", resp.StatusCode)
+	}
+	// each line is SUFFIX:COUNT, padding entries have a count of 0
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		candidate, count, ok := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if !ok || !strings.EqualFold(candidate, suffix) {
+			continue
+		}
+		n, err := strconv.Atoi(count)
+		if err != nil {
+			return false, fmt.Errorf("breach lookup returned an invalid count %q", count)
+		}
+		return n > 0, nil
+	}
+	return false, scanner.Err()
+}
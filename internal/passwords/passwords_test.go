@@ -0,0 +1,84 @@
+package passwords
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Blue-Davinci/musical-zoe/internal/validator"
+)
+
+func TestPolicyValidate(t *testing.T) {
+	policy := New(DefaultMinEntropy, "")
+
+	tests := []struct {
+		name     string
+		password string
+		personal []string
+		valid    bool
+	}{
+		{"strong password", "Violet-Harbor-92", nil, true},
+		{"common password", "Password", nil, false},
+		{"common password with suffix", "Password123!", nil, false},
+		{"low entropy", "hjkqpvxm", nil, false},
+		{"repeated characters", "ZZZZZZZZZZZZZZZZ", nil, false},
+		{"sequential characters", "abcdefghijklmnop", nil, false},
+		{"contains name", "Carol-Orbit-47x", []string{"Carol Davies", "c.davies@example.com"}, false},
+		{"contains email local part", "x-Davies-Orbit-47", []string{"Carol", "c.davies@example.com"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			err := policy.Validate(context.Background(), v, tt.password, tt.personal...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if v.Valid() != tt.valid {
+				t.Errorf("expected valid=%t, got errors %v", tt.valid, v.Errors)
+			}
+		})
+	}
+}
+
+func TestBreachChecker(t *testing.T) {
+	breached := "Violet-Harbor-92"
+	sum := sha1.Sum([]byte(breached))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	var requested string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = r.URL.Path
+		// one real match and one padding entry
+		fmt.Fprintf(w, "%s:3\r\n%s:0\r\n", hash[5:], strings.Repeat("0", 35))
+	}))
+	defer server.Close()
+
+	policy := New(DefaultMinEntropy, server.URL)
+
+	v := validator.New()
+	err := policy.Validate(context.Background(), v, breached)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if v.Valid() {
+		t.Error("expected a breached password to be rejected")
+	}
+	if requested != "/range/"+hash[:5] {
+		t.Errorf("expected only the hash prefix to be sent, got %s", requested)
+	}
+
+	v = validator.New()
+	err = policy.Validate(context.Background(), v, "Quiet-Lantern-58")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !v.Valid() {
+		t.Errorf("expected password to be accepted, got %v", v.Errors)
+	}
+}
@@ -0,0 +1,163 @@
+// Package passwords decides whether a new password is strong enough to be accepted.
+// A Policy rejects guessable passwords, common passwords from an embedded deny-list,
+// passwords built from the user's own details and, optionally, passwords found in a
+// public data breach.
+package passwords
+
+import (
+	"bufio"
+	"context"
+	_ "embed"
+	"math"
+	"strings"
+	"unicode"
+
+	"github.com/Blue-Davinci/musical-zoe/internal/validator"
+)
+
+const (
+	DefaultMinEntropy = 40.0
+	// minPersonalTokenLength is the shortest piece of a name or email that we look for in
+	// a password, shorter pieces match too much by accident.
+	minPersonalTokenLength = 3
+)
+
+//go:embed common_passwords.txt
+var commonPasswordsFile string
+
+// commonPasswords is the deny-list, lowercased.
+var commonPasswords = loadDenyList(commonPasswordsFile)
+
+// Policy holds the rules a new password has to pass. The zero value only applies the
+// deny-list and the personal information check.
+type Policy struct {
+	// MinEntropy is the estimated strength, in bits, a password needs to reach.
+	MinEntropy float64
+	// Breaches is used to reject breached passwords, nil disables the lookup.
+	Breaches *BreachChecker
+}
+
+// New() returns a policy with the given minimum entropy. An empty breachAPIURL leaves
+// the breach lookup switched off.
+func New(minEntropy float64, breachAPIURL string) *Policy {
+	policy := &Policy{MinEntropy: minEntropy}
+	if breachAPIURL != "" {
+		policy.Breaches = NewBreachChecker(breachAPIURL)
+	}
+	return policy
+}
+
+// Validate() checks password against the policy and adds the first rule it breaks to v
+// under the "password" key. personal holds values the user has told us, such as their
+// name and email, which the password must not contain. The returned error is only set
+// when the breach lookup itself fails, in which case the password is judged on the
+// remaining rules so that an outage doesn't block sign-ups.
+func (p *Policy) Validate(ctx context.Context, v *validator.Validator, password string, personal ...string) error {
+	lowered := strings.ToLower(password)
+	v.Check(!isCommon(lowered), "password", "is one of the most commonly used passwords, please choose something less predictable")
+	v.Check(!containsPersonal(lowered, personal), "password", "must not contain your name or email address")
+	v.Check(Entropy(password) >= p.MinEntropy, "password", "is too easy to guess, try a longer password or mix upper and lower case letters, numbers and symbols")
+	if !v.Valid() || p.Breaches == nil {
+		return nil
+	}
+	breached, err := p.Breaches.Breached(ctx, password)
+	if err != nil {
+		return err
+	}
+	v.Check(!breached, "password", "has appeared in a known data breach, please choose a different password")
+	return nil
+}
+
+// Entropy() estimates the strength of a password in bits as the size of the character
+// pool it draws from, raised to its length. Characters that repeat or continue a run
+// from the one before (such as "aaa" or "1234") add nothing to the length.
+func Entropy(password string) float64 {
+	var lower, upper, digit, symbol, other bool
+	length := 0
+	var prev rune
+	for i, r := range password {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < unicode.MaxASCII && unicode.IsPrint(r):
+			symbol = true
+		default:
+			other = true
+		}
+		if i == 0 || (r != prev && r != prev+1 && r != prev-1) {
+			length++
+		}
+		prev = r
+	}
+	pool := 0
+	if lower {
+		pool += 26
+	}
+	if upper {
+		pool += 26
+	}
+	if digit {
+		pool += 10
+	}
+	if symbol {
+		pool += 33
+	}
+	if other {
+		pool += 100
+	}
+	if pool == 0 {
+		return 0
+	}
+	return float64(length) * math.Log2(float64(pool))
+}
+
+// isCommon() reports whether a lowercased password is on the deny-list, either as is or
+// once the digits and symbols people tend to tack on the end are removed.
+func isCommon(lowered string) bool {
+	if commonPasswords[lowered] {
+		return true
+	}
+	trimmed := strings.TrimRightFunc(lowered, func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	return trimmed != lowered && commonPasswords[trimmed]
+}
+
+// containsPersonal() reports whether a lowercased password contains any word of the
+// personal values, or the local part of an email address.
+func containsPersonal(lowered string, personal []string) bool {
+	for _, value := range personal {
+		value = strings.ToLower(value)
+		if local, _, ok := strings.Cut(value, "@"); ok {
+			value = local
+		}
+		tokens := strings.FieldsFunc(value, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		for _, token := range append(tokens, value) {
+			if len(token) >= minPersonalTokenLength && strings.Contains(lowered, token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// loadDenyList() parses the embedded deny-list, one password per line. Blank lines and
+// lines starting with # are skipped.
+func loadDenyList(file string) map[string]bool {
+	list := make(map[string]bool)
+	scanner := bufio.NewScanner(strings.NewReader(file))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		list[strings.ToLower(line)] = true
+	}
+	return list
+}
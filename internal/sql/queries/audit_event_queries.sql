@@ -0,0 +1,30 @@
+-- name: InsertAuditEvent :one
+INSERT INTO audit_events (user_id, email, event_type, ip_address, user_agent, request_id, metadata)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING id, created_at;
+
+-- name: ListAuditEvents :many
+SELECT id, user_id, email, event_type, ip_address, user_agent, request_id, metadata, created_at
+FROM audit_events
+WHERE (sqlc.narg('user_id')::bigint IS NULL OR user_id = sqlc.narg('user_id'))
+AND (sqlc.arg('event_type')::text = '' OR event_type = sqlc.arg('event_type'))
+AND (sqlc.arg('email')::text = '' OR email = sqlc.arg('email'))
+AND (sqlc.narg('created_after')::timestamptz IS NULL OR created_at >= sqlc.narg('created_after'))
+AND (sqlc.narg('created_before')::timestamptz IS NULL OR created_at < sqlc.narg('created_before'))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('limit') OFFSET sqlc.arg('offset');
+
+-- name: CountAuditEvents :one
+SELECT COUNT(*)
+FROM audit_events
+WHERE (sqlc.narg('user_id')::bigint IS NULL OR user_id = sqlc.narg('user_id'))
+AND (sqlc.arg('event_type')::text = '' OR event_type = sqlc.arg('event_type'))
+AND (sqlc.arg('email')::text = '' OR email = sqlc.arg('email'))
+AND (sqlc.narg('created_after')::timestamptz IS NULL OR created_at >= sqlc.narg('created_after'))
+AND (sqlc.narg('created_before')::timestamptz IS NULL OR created_at < sqlc.narg('created_before'));
+
+-- name: GetAuditEventsForUser :many
+SELECT id, user_id, email, event_type, ip_address, user_agent, request_id, metadata, created_at
+FROM audit_events
+WHERE user_id = $1
+ORDER BY created_at DESC, id DESC;
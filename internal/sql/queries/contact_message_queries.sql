@@ -0,0 +1,35 @@
+-- name: InsertContactMessage :one
+INSERT INTO contact_messages (name, email, subject, message, ip_address, user_agent)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING id, created_at;
+
+-- name: CountContactMessagesForIPSince :one
+SELECT COUNT(*)
+FROM contact_messages
+WHERE ip_address = $1
+AND created_at >= $2;
+
+-- name: ListContactMessages :many
+SELECT id, name, email, subject, message, ip_address, user_agent, resolved_at, resolved_by, created_at
+FROM contact_messages
+WHERE (sqlc.narg('resolved')::boolean IS NULL OR (resolved_at IS NOT NULL) = sqlc.narg('resolved'))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('limit') OFFSET sqlc.arg('offset');
+
+-- name: CountContactMessages :one
+SELECT COUNT(*)
+FROM contact_messages
+WHERE (sqlc.narg('resolved')::boolean IS NULL OR (resolved_at IS NOT NULL) = sqlc.narg('resolved'));
+
+-- name: UpdateContactMessageResolution :one
+UPDATE contact_messages
+SET resolved_at = CASE WHEN sqlc.arg('resolved')::boolean THEN COALESCE(resolved_at, now()) ELSE NULL END,
+    resolved_by = CASE WHEN sqlc.arg('resolved')::boolean THEN COALESCE(resolved_by, sqlc.narg('resolved_by')) ELSE NULL END
+WHERE id = sqlc.arg('id')
+RETURNING id, name, email, subject, message, ip_address, user_agent, resolved_at, resolved_by, created_at;
+
+-- name: GetContactMessagesForEmail :many
+SELECT id, name, email, subject, message, ip_address, user_agent, resolved_at, resolved_by, created_at
+FROM contact_messages
+WHERE email = $1
+ORDER BY created_at DESC, id DESC;
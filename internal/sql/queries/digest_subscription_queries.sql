@@ -0,0 +1,41 @@
+-- name: UpsertDigestSubscription :one
+INSERT INTO digest_subscriptions (user_id, genres, country, send_day, send_hour, timezone, next_send_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+ON CONFLICT (user_id) DO UPDATE
+SET subscribed = true,
+    genres = EXCLUDED.genres,
+    country = EXCLUDED.country,
+    send_day = EXCLUDED.send_day,
+    send_hour = EXCLUDED.send_hour,
+    timezone = EXCLUDED.timezone,
+    next_send_at = EXCLUDED.next_send_at,
+    updated_at = now()
+RETURNING user_id, subscribed, genres, country, send_day, send_hour, timezone, next_send_at, last_sent_at, created_at, updated_at;
+
+-- name: GetDigestSubscription :one
+SELECT user_id, subscribed, genres, country, send_day, send_hour, timezone, next_send_at, last_sent_at, created_at, updated_at
+FROM digest_subscriptions
+WHERE user_id = $1;
+
+-- name: UnsubscribeDigest :execrows
+UPDATE digest_subscriptions
+SET subscribed = false, updated_at = now()
+WHERE user_id = $1 AND subscribed;
+
+-- name: GetDueDigestSubscriptions :many
+SELECT sqlc.embed(digest_subscriptions), users.name, users.email, users.locale
+FROM digest_subscriptions
+INNER JOIN users
+ON users.id = digest_subscriptions.user_id
+WHERE digest_subscriptions.subscribed
+AND users.activated
+AND digest_subscriptions.next_send_at <= $1
+ORDER BY digest_subscriptions.next_send_at
+LIMIT $2;
+
+-- name: ClaimDigestSubscription :execrows
+UPDATE digest_subscriptions
+SET next_send_at = sqlc.arg(next_send_at), last_sent_at = now(), updated_at = now()
+WHERE user_id = sqlc.arg(user_id)
+AND next_send_at = sqlc.arg(due_at)
+AND subscribed;
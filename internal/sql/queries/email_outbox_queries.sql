@@ -0,0 +1,69 @@
+-- name: InsertEmailOutboxMessage :one
+INSERT INTO email_outbox (message_id, recipient, sender, template, subject, plain_body, html_body, headers, created_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+RETURNING id, status, next_attempt_at, updated_at;
+
+-- name: ClaimEmailOutboxMessage :one
+UPDATE email_outbox
+SET status = 'sending', attempts = attempts + 1, locked_until = $1, updated_at = now()
+WHERE id = (
+    SELECT id FROM email_outbox
+    WHERE (status = 'pending' AND next_attempt_at <= now())
+    OR (status = 'sending' AND locked_until < now())
+    ORDER BY next_attempt_at, id
+    LIMIT 1
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING id, message_id, recipient, sender, template, subject, plain_body, html_body, status, attempts, last_error, next_attempt_at, locked_until, sent_at, created_at, updated_at, headers;
+
+-- name: MarkEmailOutboxMessageSent :execrows
+UPDATE email_outbox
+SET status = 'sent', sent_at = now(), locked_until = NULL, last_error = '', plain_body = '', html_body = '', headers = '{}', updated_at = now()
+WHERE id = $1 AND status = 'sending';
+
+-- name: MarkEmailOutboxMessageFailed :execrows
+UPDATE email_outbox
+SET status = $2, last_error = $3, next_attempt_at = $4, locked_until = NULL, updated_at = now()
+WHERE id = $1 AND status = 'sending';
+
+-- name: GetEmailOutboxMessage :one
+SELECT id, message_id, recipient, sender, template, subject, plain_body, html_body, status, attempts, last_error, next_attempt_at, locked_until, sent_at, created_at, updated_at, headers
+FROM email_outbox
+WHERE id = $1;
+
+-- name: ListEmailOutboxMessages :many
+SELECT id, message_id, recipient, sender, template, subject, plain_body, html_body, status, attempts, last_error, next_attempt_at, locked_until, sent_at, created_at, updated_at, headers
+FROM email_outbox
+WHERE (sqlc.arg('status')::text = '' OR status = sqlc.arg('status'))
+AND (sqlc.arg('recipient')::text = '' OR recipient = sqlc.arg('recipient'))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('limit') OFFSET sqlc.arg('offset');
+
+-- name: CountEmailOutboxMessages :one
+SELECT COUNT(*)
+FROM email_outbox
+WHERE (sqlc.arg('status')::text = '' OR status = sqlc.arg('status'))
+AND (sqlc.arg('recipient')::text = '' OR recipient = sqlc.arg('recipient'));
+
+-- name: CountEmailOutboxMessagesByStatus :many
+SELECT status, COUNT(*) AS count
+FROM email_outbox
+GROUP BY status;
+
+-- name: RetryEmailOutboxMessage :execrows
+UPDATE email_outbox
+SET status = 'pending', attempts = 0, last_error = '', next_attempt_at = now(), updated_at = now()
+WHERE id = $1 AND status = 'dead';
+
+-- name: RetryDeadEmailOutboxMessages :execrows
+UPDATE email_outbox
+SET status = 'pending', attempts = 0, last_error = '', next_attempt_at = now(), updated_at = now()
+WHERE status = 'dead';
+
+-- name: DeleteSentEmailOutboxMessagesBefore :execrows
+DELETE FROM email_outbox
+WHERE status = 'sent' AND sent_at < $1;
+
+-- name: DeleteDeadEmailOutboxMessagesBefore :execrows
+DELETE FROM email_outbox
+WHERE status = 'dead' AND updated_at < $1;
@@ -0,0 +1,39 @@
+-- name: InsertUserIdentity :one
+INSERT INTO user_identities (user_id, provider, subject, email)
+VALUES ($1, $2, $3, $4)
+RETURNING id, created_at, last_login_at;
+
+-- name: GetUserForIdentity :one
+SELECT sqlc.embed(users)
+FROM users
+INNER JOIN user_identities
+ON users.id = user_identities.user_id
+WHERE user_identities.provider = $1 AND user_identities.subject = $2;
+
+-- name: UpdateUserIdentityLogin :exec
+UPDATE user_identities
+SET email = $1, last_login_at = now()
+WHERE provider = $2 AND subject = $3;
+
+-- name: GetUserIdentitiesForUser :many
+SELECT id, user_id, provider, subject, email, created_at, last_login_at
+FROM user_identities
+WHERE user_id = $1
+ORDER BY created_at;
+
+-- name: DeleteUserIdentityForUser :execrows
+DELETE FROM user_identities
+WHERE id = $1 AND user_id = $2;
+
+-- name: InsertOIDCAuthRequest :exec
+INSERT INTO oidc_auth_requests (state_hash, provider, code_verifier, nonce, expiry)
+VALUES ($1, $2, $3, $4, $5);
+
+-- name: DeleteOIDCAuthRequest :one
+DELETE FROM oidc_auth_requests
+WHERE state_hash = $1 AND expiry > $2
+RETURNING provider, code_verifier, nonce;
+
+-- name: DeleteExpiredOIDCAuthRequests :execrows
+DELETE FROM oidc_auth_requests
+WHERE expiry < $1;
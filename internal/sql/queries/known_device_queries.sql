@@ -0,0 +1,26 @@
+-- name: UpsertKnownDevice :one
+WITH previous AS (
+    SELECT revoked
+    FROM known_devices
+    WHERE user_id = $1 AND fingerprint = $2
+)
+INSERT INTO known_devices (user_id, fingerprint, ip_address, user_agent)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (user_id, fingerprint) DO UPDATE SET last_seen_at = now(), revoked = false
+RETURNING id, (xmax = 0)::boolean AS inserted, COALESCE((SELECT revoked FROM previous), false)::boolean AS was_revoked;
+
+-- name: CountKnownDevicesForUser :one
+SELECT COUNT(*)
+FROM known_devices
+WHERE user_id = $1;
+
+-- name: RevokeKnownDevicesForUser :exec
+UPDATE known_devices
+SET revoked = true
+WHERE user_id = $1;
+
+-- name: GetKnownDevicesForUser :many
+SELECT id, user_id, fingerprint, ip_address, user_agent, first_seen_at, last_seen_at, revoked
+FROM known_devices
+WHERE user_id = $1
+ORDER BY last_seen_at DESC, id DESC;
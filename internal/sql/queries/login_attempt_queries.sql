@@ -0,0 +1,39 @@
+-- name: InsertLoginFailure :exec
+INSERT INTO login_attempts (email, ip_address)
+VALUES ($1, $2);
+
+-- name: CountLoginFailuresForEmail :one
+SELECT COUNT(*)
+FROM login_attempts
+WHERE email = $1 AND created_at > $2;
+
+-- name: CountLoginFailuresForIP :one
+SELECT COUNT(*)
+FROM login_attempts
+WHERE ip_address = $1 AND created_at > $2;
+
+-- name: DeleteLoginFailuresForEmail :exec
+DELETE FROM login_attempts
+WHERE email = $1;
+
+-- name: UpsertLoginLockout :exec
+INSERT INTO login_lockouts (email, locked_until)
+VALUES ($1, $2)
+ON CONFLICT (email) DO UPDATE SET locked_until = EXCLUDED.locked_until;
+
+-- name: GetLoginLockout :one
+SELECT locked_until
+FROM login_lockouts
+WHERE email = $1 AND locked_until > $2;
+
+-- name: DeleteLoginLockout :exec
+DELETE FROM login_lockouts
+WHERE email = $1;
+
+-- name: DeleteLoginFailuresBefore :execrows
+DELETE FROM login_attempts
+WHERE created_at < $1;
+
+-- name: DeleteExpiredLoginLockouts :execrows
+DELETE FROM login_lockouts
+WHERE locked_until < $1;
@@ -0,0 +1,5 @@
+-- name: UseMFAStep :execrows
+INSERT INTO mfa_used_steps (user_id, step)
+VALUES ($1, $2)
+ON CONFLICT (user_id) DO UPDATE SET step = EXCLUDED.step, used_at = now()
+WHERE mfa_used_steps.step < EXCLUDED.step;
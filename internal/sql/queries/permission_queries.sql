@@ -0,0 +1,20 @@
+-- name: GetAllPermissionsForUser :many
+SELECT permissions.code
+FROM permissions
+INNER JOIN users_permissions ON users_permissions.permission_id = permissions.id
+WHERE users_permissions.user_id = $1
+ORDER BY permissions.code;
+
+-- name: AddPermissionsForUser :exec
+INSERT INTO users_permissions (user_id, permission_id)
+SELECT sqlc.arg(user_id), permissions.id
+FROM permissions
+WHERE permissions.code = ANY(sqlc.arg(codes)::text[])
+ON CONFLICT DO NOTHING;
+
+-- name: RemovePermissionsForUser :exec
+DELETE FROM users_permissions
+USING permissions
+WHERE users_permissions.permission_id = permissions.id
+AND users_permissions.user_id = sqlc.arg(user_id)
+AND permissions.code = ANY(sqlc.arg(codes)::text[]);
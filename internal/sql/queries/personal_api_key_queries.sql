@@ -0,0 +1,52 @@
+-- name: InsertPersonalApiKey :one
+INSERT INTO personal_api_keys (user_id, name, key_hash, key_prefix, scopes, expiry)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING id, created_at;
+
+-- name: GetPersonalApiKeysForUser :many
+SELECT id, user_id, name, key_prefix, scopes, expiry, created_at, last_used_at
+FROM personal_api_keys
+WHERE user_id = $1
+ORDER BY created_at DESC;
+
+-- name: GetPersonalApiKeyByIDForUser :one
+SELECT id, user_id, name, key_prefix, scopes, expiry, created_at, last_used_at
+FROM personal_api_keys
+WHERE id = $1 AND user_id = $2;
+
+-- name: UpdatePersonalApiKey :execrows
+UPDATE personal_api_keys
+SET name = $1, scopes = $2
+WHERE id = $3 AND user_id = $4;
+
+-- name: DeletePersonalApiKeyForUser :execrows
+DELETE FROM personal_api_keys
+WHERE id = $1 AND user_id = $2;
+
+-- name: CountPersonalApiKeysForUser :one
+SELECT COUNT(*)
+FROM personal_api_keys
+WHERE user_id = $1;
+
+-- name: GetUserForPersonalApiKey :one
+SELECT
+    sqlc.embed(users),
+    personal_api_keys.id,
+    personal_api_keys.name,
+    personal_api_keys.scopes,
+    personal_api_keys.expiry
+FROM users
+INNER JOIN personal_api_keys
+ON users.id = personal_api_keys.user_id
+WHERE personal_api_keys.key_hash = sqlc.arg(key_hash)
+AND (personal_api_keys.expiry IS NULL OR personal_api_keys.expiry > sqlc.arg(now));
+
+-- name: UpdatePersonalApiKeyLastUsed :exec
+UPDATE personal_api_keys
+SET last_used_at = sqlc.arg(last_used_at)
+WHERE id = sqlc.arg(id)
+AND (last_used_at IS NULL OR last_used_at < sqlc.arg(stale_before));
+
+-- name: DeleteAllPersonalApiKeysForUser :execrows
+DELETE FROM personal_api_keys
+WHERE user_id = $1;
@@ -1,7 +1,7 @@
 -- name: InsertApiKey :one
-INSERT INTO api_keys (api_key, user_id, expiry, scope)
-VALUES ($1, $2, $3, $4)
-RETURNING user_id;
+INSERT INTO api_keys (api_key, user_id, expiry, scope, ip_address, user_agent, family_id)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING id, created_at;
 
 -- name: DeletAllAPIKeysForUser :exec
 DELETE FROM api_keys
@@ -16,10 +16,115 @@ SELECT
     users.activated, 
     users.version, 
     users.created_at, 
-    users.updated_at
+    users.updated_at,
+    users.mfa_secret,
+    users.mfa_enabled,
+    users.pending_email,
+    users.locale,
+    users.suspended
 FROM users
 INNER JOIN api_keys
 ON users.id = api_keys.user_id
 WHERE api_keys.api_key = $1
 AND api_keys.scope = $2
-AND api_keys.expiry > $3;
\ No newline at end of file
+AND api_keys.expiry > $3;
+
+-- name: DeleteApiKeyForUser :execrows
+DELETE FROM api_keys
+WHERE user_id = sqlc.arg(user_id)
+AND (
+    (api_key = sqlc.arg(api_key) AND scope = sqlc.arg(scope))
+    OR family_id IN (
+        SELECT family_id FROM api_keys
+        WHERE api_key = sqlc.arg(api_key) AND scope = sqlc.arg(scope) AND user_id = sqlc.arg(user_id) AND family_id <> ''
+    )
+);
+
+-- name: CountApiKeysForUser :one
+SELECT COUNT(*)
+FROM api_keys
+WHERE scope = $1 AND user_id = $2 AND expiry > $3;
+
+-- name: GetSessionsForUser :many
+SELECT
+    id,
+    created_at,
+    expiry,
+    last_used_at,
+    ip_address,
+    user_agent,
+    (api_key = sqlc.arg(current_api_key) OR family_id IN (
+        SELECT family_id FROM api_keys WHERE api_key = sqlc.arg(current_api_key) AND family_id <> ''
+    ))::boolean AS current
+FROM api_keys
+WHERE user_id = sqlc.arg(user_id)
+AND expiry > sqlc.arg(expiry)
+AND (
+    (scope = sqlc.arg(session_scope) AND family_id = '')
+    OR (scope = sqlc.arg(refresh_scope) AND rotated_at IS NULL)
+)
+ORDER BY last_used_at DESC;
+
+-- name: DeleteApiKeyByIDForUser :execrows
+DELETE FROM api_keys
+WHERE user_id = sqlc.arg(user_id)
+AND (
+    (id = sqlc.arg(id) AND scope = sqlc.arg(scope))
+    OR family_id IN (
+        SELECT family_id FROM api_keys
+        WHERE id = sqlc.arg(id) AND scope = sqlc.arg(scope) AND user_id = sqlc.arg(user_id) AND family_id <> ''
+    )
+);
+
+-- name: UpdateApiKeyLastUsed :exec
+UPDATE api_keys
+SET last_used_at = sqlc.arg(last_used_at)
+WHERE (
+    api_key = sqlc.arg(api_key)
+    OR family_id IN (SELECT family_id FROM api_keys WHERE api_key = sqlc.arg(api_key) AND family_id <> '')
+)
+AND last_used_at < sqlc.arg(stale_before);
+
+-- name: CountApiKeysCreatedSince :one
+SELECT COUNT(*)
+FROM api_keys
+WHERE scope = $1 AND user_id = $2 AND created_at > $3;
+
+-- name: DeleteApiKeysForUserExcept :exec
+DELETE FROM api_keys
+WHERE scope = $1 AND user_id = $2 AND api_key <> $3
+AND family_id NOT IN (
+    SELECT family_id FROM api_keys WHERE api_key = $3 AND family_id <> ''
+);
+
+-- name: GetRefreshToken :one
+SELECT id, user_id, family_id, rotated_at
+FROM api_keys
+WHERE api_key = $1 AND scope = $2 AND expiry > $3;
+
+-- name: MarkApiKeyRotated :execrows
+UPDATE api_keys
+SET rotated_at = $1
+WHERE id = $2 AND rotated_at IS NULL;
+
+-- name: DeleteApiKeyFamily :execrows
+DELETE FROM api_keys
+WHERE family_id = $1 AND family_id <> '';
+
+-- name: DeleteApiKeysForFamily :exec
+DELETE FROM api_keys
+WHERE family_id = $1 AND scope = $2;
+
+-- name: DeleteExpiredApiKeys :execrows
+DELETE FROM api_keys
+WHERE expiry < $1;
+
+-- name: DeleteApiKeysForUser :exec
+DELETE FROM api_keys
+WHERE user_id = $1;
+
+-- name: IncrementApiKeyFailedAttempts :one
+UPDATE api_keys
+SET failed_attempts = failed_attempts + 1
+WHERE api_key = $1 AND scope = $2
+RETURNING failed_attempts;
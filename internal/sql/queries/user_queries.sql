@@ -1,18 +1,78 @@
 -- name: CreateUser :one
-INSERT INTO users (name, email, password_hash, activated)
-VALUES ($1, $2, $3, $4)
+INSERT INTO users (name, email, password_hash, activated, locale)
+VALUES ($1, $2, $3, $4, $5)
 RETURNING id, created_at, version;
 
 -- name: GetUserByEmail :one
-SELECT id, name, email, password_hash, activated, version, created_at, updated_at
+SELECT id, name, email, password_hash, activated, version, created_at, updated_at, mfa_secret, mfa_enabled, pending_email, locale, suspended
 FROM users WHERE email = $1;
 
+-- name: GetUserByID :one
+SELECT id, name, email, password_hash, activated, version, created_at, updated_at, mfa_secret, mfa_enabled, pending_email, locale, suspended
+FROM users WHERE id = $1;
+
 -- name: UpdateUser :one
 UPDATE users
 SET 
     name = $1, 
     email = $2, 
     password_hash = $3, 
-    activated = $4
-WHERE id = $5 AND version = $6
-RETURNING version, updated_at;
\ No newline at end of file
+    activated = $4,
+    mfa_secret = $5,
+    mfa_enabled = $6,
+    pending_email = $7,
+    locale = $8,
+    suspended = $9,
+    version = version + 1
+WHERE id = $10 AND version = $11
+RETURNING version, updated_at;
+
+-- name: DeleteUser :execrows
+WITH anonymised_audit_events AS (
+    UPDATE audit_events
+    SET email = '', ip_address = '', user_agent = ''
+    WHERE user_id = $1 OR email = $2
+)
+DELETE FROM users
+WHERE id = $1;
+
+-- name: ListUsers :many
+SELECT id, name, email, password_hash, activated, version, created_at, updated_at, mfa_secret, mfa_enabled, pending_email, locale, suspended
+FROM users
+WHERE (sqlc.narg('activated')::boolean IS NULL OR activated = sqlc.narg('activated'))
+AND (sqlc.narg('created_after')::timestamptz IS NULL OR created_at >= sqlc.narg('created_after'))
+AND (sqlc.narg('created_before')::timestamptz IS NULL OR created_at < sqlc.narg('created_before'))
+AND (sqlc.arg('email')::text = '' OR email ILIKE '%' || sqlc.arg('email')::text || '%')
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('limit') OFFSET sqlc.arg('offset');
+
+-- name: CountUsers :one
+SELECT COUNT(*)
+FROM users
+WHERE (sqlc.narg('activated')::boolean IS NULL OR activated = sqlc.narg('activated'))
+AND (sqlc.narg('created_after')::timestamptz IS NULL OR created_at >= sqlc.narg('created_after'))
+AND (sqlc.narg('created_before')::timestamptz IS NULL OR created_at < sqlc.narg('created_before'))
+AND (sqlc.arg('email')::text = '' OR email ILIKE '%' || sqlc.arg('email')::text || '%');
+
+-- name: GetUsersForActivationReminder :many
+SELECT users.id, users.name, users.email, users.locale, users.created_at
+FROM users
+LEFT JOIN activation_reminders
+ON activation_reminders.user_id = users.id
+WHERE users.activated = false
+AND users.suspended = false
+AND users.created_at < $1
+AND activation_reminders.user_id IS NULL
+ORDER BY users.created_at
+LIMIT $2;
+
+-- name: InsertActivationReminder :exec
+INSERT INTO activation_reminders (user_id)
+VALUES ($1)
+ON CONFLICT (user_id) DO NOTHING;
+
+-- name: DeleteUnactivatedUsers :execrows
+DELETE FROM users
+WHERE activated = false
+AND suspended = false
+AND created_at < $1;
@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE users
+    ADD COLUMN mfa_secret text NOT NULL DEFAULT '',
+    ADD COLUMN mfa_enabled bool NOT NULL DEFAULT FALSE;
+
+-- +goose Down
+ALTER TABLE users
+    DROP COLUMN IF EXISTS mfa_enabled,
+    DROP COLUMN IF EXISTS mfa_secret;
@@ -0,0 +1,19 @@
+-- +goose Up
+ALTER TABLE api_keys
+    ADD COLUMN id bigserial UNIQUE NOT NULL,
+    ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    ADD COLUMN last_used_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    ADD COLUMN ip_address text NOT NULL DEFAULT '',
+    ADD COLUMN user_agent text NOT NULL DEFAULT '';
+
+-- Sessions are listed per user and scope, most recently used first
+CREATE INDEX idx_api_keys_user_id_scope ON api_keys (user_id, scope);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_api_keys_user_id_scope;
+ALTER TABLE api_keys
+    DROP COLUMN IF EXISTS user_agent,
+    DROP COLUMN IF EXISTS ip_address,
+    DROP COLUMN IF EXISTS last_used_at,
+    DROP COLUMN IF EXISTS created_at,
+    DROP COLUMN IF EXISTS id;
@@ -0,0 +1,23 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS permissions (
+    id bigserial PRIMARY KEY,
+    code text UNIQUE NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS users_permissions (
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    permission_id bigint NOT NULL REFERENCES permissions ON DELETE CASCADE,
+    PRIMARY KEY (user_id, permission_id)
+);
+
+-- Seed the permissions the application checks for
+INSERT INTO permissions (code)
+VALUES
+    ('metrics:read'),
+    ('admin:read'),
+    ('admin:write'),
+    ('premium:access');
+
+-- +goose Down
+DROP TABLE IF EXISTS users_permissions;
+DROP TABLE IF EXISTS permissions;
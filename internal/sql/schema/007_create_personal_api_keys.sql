@@ -0,0 +1,18 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS personal_api_keys (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    name text NOT NULL,
+    key_hash bytea UNIQUE NOT NULL,
+    key_prefix text NOT NULL,
+    scopes text[] NOT NULL DEFAULT '{}',
+    expiry TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_used_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_personal_api_keys_user_id ON personal_api_keys (user_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_personal_api_keys_user_id;
+DROP TABLE IF EXISTS personal_api_keys;
@@ -0,0 +1,14 @@
+-- +goose Up
+-- family_id ties together the access and refresh tokens issued by one login, and
+-- rotated_at marks refresh tokens that have already been exchanged.
+ALTER TABLE api_keys
+    ADD COLUMN family_id text NOT NULL DEFAULT '',
+    ADD COLUMN rotated_at TIMESTAMPTZ;
+
+CREATE INDEX idx_api_keys_family_id ON api_keys (family_id) WHERE family_id <> '';
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_api_keys_family_id;
+ALTER TABLE api_keys
+    DROP COLUMN IF EXISTS rotated_at,
+    DROP COLUMN IF EXISTS family_id;
@@ -0,0 +1,23 @@
+-- +goose Up
+-- Failed logins are recorded per email and per IP address so that repeated guessing
+-- can be throttled. Emails are stored even when no such account exists.
+CREATE TABLE IF NOT EXISTS login_attempts (
+    id bigserial PRIMARY KEY,
+    email citext NOT NULL,
+    ip_address text NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_login_attempts_email_created_at ON login_attempts (email, created_at);
+CREATE INDEX idx_login_attempts_ip_address_created_at ON login_attempts (ip_address, created_at);
+
+CREATE TABLE IF NOT EXISTS login_lockouts (
+    email citext PRIMARY KEY,
+    locked_until TIMESTAMPTZ NOT NULL
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS login_lockouts;
+DROP INDEX IF EXISTS idx_login_attempts_ip_address_created_at;
+DROP INDEX IF EXISTS idx_login_attempts_email_created_at;
+DROP TABLE IF EXISTS login_attempts;
@@ -0,0 +1,30 @@
+-- +goose Up
+-- Accounts at external OpenID Connect providers that are linked to a user. A provider
+-- account is identified by its issuer-scoped subject, never by its email.
+CREATE TABLE IF NOT EXISTS user_identities (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    provider text NOT NULL,
+    subject text NOT NULL,
+    email citext NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_login_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (provider, subject)
+);
+
+CREATE INDEX idx_user_identities_user_id ON user_identities (user_id);
+
+-- In-flight authorization requests, holding the PKCE verifier and nonce between the
+-- redirect to the provider and its callback.
+CREATE TABLE IF NOT EXISTS oidc_auth_requests (
+    state_hash bytea PRIMARY KEY,
+    provider text NOT NULL,
+    code_verifier text NOT NULL,
+    nonce text NOT NULL,
+    expiry TIMESTAMPTZ NOT NULL
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS oidc_auth_requests;
+DROP INDEX IF EXISTS idx_user_identities_user_id;
+DROP TABLE IF EXISTS user_identities;
@@ -0,0 +1,14 @@
+-- +goose Up
+-- Records the accounts that have been sent an activation reminder by the janitor, so
+-- that each unactivated account is reminded at most once before it is purged.
+CREATE TABLE IF NOT EXISTS activation_reminders (
+    user_id bigint PRIMARY KEY REFERENCES users ON DELETE CASCADE,
+    sent_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- The janitor looks for unactivated accounts by age
+CREATE INDEX idx_users_unactivated_created_at ON users (created_at) WHERE activated = false;
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_users_unactivated_created_at;
+DROP TABLE IF EXISTS activation_reminders;
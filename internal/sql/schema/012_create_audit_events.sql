@@ -0,0 +1,39 @@
+-- +goose Up
+-- audit_events is an append-only record of security-relevant account activity. There
+-- is no foreign key on user_id so that a user's history outlives their account, and a
+-- trigger rejects any attempt to change or remove a recorded event.
+CREATE TABLE IF NOT EXISTS audit_events (
+    id bigserial PRIMARY KEY,
+    user_id bigint,
+    email citext NOT NULL DEFAULT '',
+    event_type text NOT NULL,
+    ip_address text NOT NULL DEFAULT '',
+    user_agent text NOT NULL DEFAULT '',
+    request_id text NOT NULL DEFAULT '',
+    metadata jsonb NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_audit_events_user_id_created_at ON audit_events (user_id, created_at);
+CREATE INDEX idx_audit_events_event_type_created_at ON audit_events (event_type, created_at);
+
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION reject_audit_event_changes()
+RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ language 'plpgsql';
+-- +goose StatementEnd
+
+CREATE TRIGGER audit_events_append_only
+BEFORE UPDATE OR DELETE ON audit_events
+FOR EACH ROW
+EXECUTE FUNCTION reject_audit_event_changes();
+
+-- +goose Down
+DROP TRIGGER IF EXISTS audit_events_append_only ON audit_events;
+DROP FUNCTION IF EXISTS reject_audit_event_changes();
+DROP INDEX IF EXISTS idx_audit_events_event_type_created_at;
+DROP INDEX IF EXISTS idx_audit_events_user_id_created_at;
+DROP TABLE IF EXISTS audit_events;
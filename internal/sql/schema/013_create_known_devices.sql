@@ -0,0 +1,17 @@
+-- +goose Up
+-- known_devices remembers each IP address and user-agent pair a user has logged in
+-- from, so that logins from a new device can be reported to them. The fingerprint is
+-- a hash of the pair, which keeps the unique index small.
+CREATE TABLE IF NOT EXISTS known_devices (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    fingerprint bytea NOT NULL,
+    ip_address text NOT NULL DEFAULT '',
+    user_agent text NOT NULL DEFAULT '',
+    first_seen_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_seen_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (user_id, fingerprint)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS known_devices;
@@ -0,0 +1,23 @@
+-- +goose Up
+-- contact_messages holds the messages sent through the public contact form until an
+-- operator marks them resolved. The sender's IP address is kept to throttle abuse.
+CREATE TABLE IF NOT EXISTS contact_messages (
+    id bigserial PRIMARY KEY,
+    name text NOT NULL,
+    email citext NOT NULL,
+    subject text NOT NULL,
+    message text NOT NULL,
+    ip_address text NOT NULL DEFAULT '',
+    user_agent text NOT NULL DEFAULT '',
+    resolved_at TIMESTAMPTZ,
+    resolved_by bigint REFERENCES users ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_contact_messages_ip_address_created_at ON contact_messages (ip_address, created_at);
+CREATE INDEX idx_contact_messages_created_at ON contact_messages (created_at);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_contact_messages_created_at;
+DROP INDEX IF EXISTS idx_contact_messages_ip_address_created_at;
+DROP TABLE IF EXISTS contact_messages;
@@ -0,0 +1,32 @@
+-- +goose Up
+-- email_outbox queues rendered emails so that they survive restarts and SMTP outages.
+-- Requests insert a pending row and a pool of workers delivers it, retrying with
+-- backoff until it is sent or, after too many attempts, dead-lettered. message_id is
+-- also used as the Message-ID header so that a retried delivery can be recognised as a
+-- duplicate by the receiving server.
+CREATE TABLE IF NOT EXISTS email_outbox (
+    id bigserial PRIMARY KEY,
+    message_id text NOT NULL UNIQUE,
+    recipient citext NOT NULL,
+    sender text NOT NULL,
+    template text NOT NULL,
+    subject text NOT NULL,
+    plain_body text NOT NULL,
+    html_body text NOT NULL,
+    status text NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'sending', 'sent', 'dead')),
+    attempts integer NOT NULL DEFAULT 0,
+    last_error text NOT NULL DEFAULT '',
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    locked_until TIMESTAMPTZ,
+    sent_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_email_outbox_due ON email_outbox (next_attempt_at) WHERE status IN ('pending', 'sending');
+CREATE INDEX idx_email_outbox_status_created_at ON email_outbox (status, created_at);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_email_outbox_status_created_at;
+DROP INDEX IF EXISTS idx_email_outbox_due;
+DROP TABLE IF EXISTS email_outbox;
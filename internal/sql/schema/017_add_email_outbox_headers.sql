@@ -0,0 +1,9 @@
+-- +goose Up
+-- headers holds extra message headers, such as List-Unsubscribe, as a JSON object. Like
+-- the bodies they can contain single-use links, so they are cleared once sent.
+ALTER TABLE email_outbox
+    ADD COLUMN headers jsonb NOT NULL DEFAULT '{}';
+
+-- +goose Down
+ALTER TABLE email_outbox
+    DROP COLUMN IF EXISTS headers;
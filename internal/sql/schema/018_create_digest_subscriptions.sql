@@ -0,0 +1,25 @@
+-- +goose Up
+-- digest_subscriptions holds the preferences of users who opted in to the weekly music
+-- digest. The digest is sent on send_day (0 is Sunday) at send_hour in the user's
+-- timezone, and next_send_at is that moment as an instant, so due digests can be found
+-- with an index scan. Unsubscribing keeps the row, with its preferences, for a later
+-- opt-in.
+CREATE TABLE IF NOT EXISTS digest_subscriptions (
+    user_id bigint PRIMARY KEY REFERENCES users ON DELETE CASCADE,
+    subscribed boolean NOT NULL DEFAULT true,
+    genres text[] NOT NULL DEFAULT '{}',
+    country text NOT NULL DEFAULT 'us',
+    send_day smallint NOT NULL DEFAULT 1 CHECK (send_day BETWEEN 0 AND 6),
+    send_hour smallint NOT NULL DEFAULT 8 CHECK (send_hour BETWEEN 0 AND 23),
+    timezone text NOT NULL DEFAULT 'UTC',
+    next_send_at TIMESTAMPTZ NOT NULL,
+    last_sent_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_digest_subscriptions_due ON digest_subscriptions (next_send_at) WHERE subscribed;
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_digest_subscriptions_due;
+DROP TABLE IF EXISTS digest_subscriptions;
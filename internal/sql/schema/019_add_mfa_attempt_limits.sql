@@ -0,0 +1,18 @@
+-- +goose Up
+-- failed_attempts counts the wrong codes entered against an mfa-login token. Once it
+-- reaches the limit the token is deleted and the user has to log in again.
+ALTER TABLE api_keys
+    ADD COLUMN failed_attempts integer NOT NULL DEFAULT 0;
+
+-- Records the last TOTP time step each user has used, so that a code which has been
+-- accepted once can't be replayed within its validity window.
+CREATE TABLE IF NOT EXISTS mfa_used_steps (
+    user_id bigint PRIMARY KEY REFERENCES users ON DELETE CASCADE,
+    step bigint NOT NULL,
+    used_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS mfa_used_steps;
+ALTER TABLE api_keys
+    DROP COLUMN IF EXISTS failed_attempts;
@@ -0,0 +1,10 @@
+-- +goose Up
+-- revoked marks the devices a user had logged in from when they reported a login they
+-- did not recognise. The next login from any of them is reported again, including the
+-- device the unrecognised login came from.
+ALTER TABLE known_devices
+    ADD COLUMN revoked boolean NOT NULL DEFAULT false;
+
+-- +goose Down
+ALTER TABLE known_devices
+    DROP COLUMN IF EXISTS revoked;
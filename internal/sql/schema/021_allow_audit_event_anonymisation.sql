@@ -0,0 +1,33 @@
+-- +goose Up
+-- Deleting an account blanks the email, IP address and user-agent of its audit events.
+-- The events themselves are kept, and any other change or removal is still rejected.
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION reject_audit_event_changes()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'UPDATE'
+        AND NEW.id = OLD.id
+        AND NEW.user_id IS NOT DISTINCT FROM OLD.user_id
+        AND NEW.event_type = OLD.event_type
+        AND NEW.request_id = OLD.request_id
+        AND NEW.metadata = OLD.metadata
+        AND NEW.created_at = OLD.created_at
+        AND NEW.email = ''
+        AND NEW.ip_address = ''
+        AND NEW.user_agent = '' THEN
+        RETURN NEW;
+    END IF;
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ language 'plpgsql';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION reject_audit_event_changes()
+RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ language 'plpgsql';
+-- +goose StatementEnd
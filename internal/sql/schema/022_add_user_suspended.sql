@@ -0,0 +1,21 @@
+-- +goose Up
+-- suspended marks accounts deactivated by an operator, as opposed to accounts that were
+-- never activated. The owner of a suspended account can't activate it again themselves,
+-- by activation token or by signing in with an identity provider, and the janitor never
+-- reminds or purges it as an unactivated account.
+ALTER TABLE users
+    ADD COLUMN suspended boolean NOT NULL DEFAULT false;
+
+-- accounts deactivated by an operator before the column existed, going by the audit log
+UPDATE users
+SET suspended = true
+WHERE activated = false
+AND id IN (
+    SELECT user_id FROM audit_events
+    WHERE event_type = 'token.revoke'
+    AND metadata->>'reason' = 'deactivated by an operator'
+);
+
+-- +goose Down
+ALTER TABLE users
+    DROP COLUMN IF EXISTS suspended;
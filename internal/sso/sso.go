@@ -0,0 +1,195 @@
+package sso
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+var (
+	ErrUnknownProvider = errors.New("unknown identity provider")
+	ErrMissingIDToken  = errors.New("token response did not contain an id_token")
+	ErrNonceMismatch   = errors.New("id_token nonce does not match the login request")
+)
+
+// ProviderConfig describes a single OpenID Connect identity provider. The endpoints are
+// discovered from the issuer, so any standards compliant provider can be plugged in.
+type ProviderConfig struct {
+	Name         string
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// Claims holds the parts of a verified ID token that we use to find or create a user.
+type Claims struct {
+	Subject       string `json:"sub"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name"`
+}
+
+// Provider wraps the OAuth2 configuration and ID token verifier for one identity
+// provider. Discovery happens on first use so that an unreachable provider doesn't
+// stop the server from starting.
+type Provider struct {
+	config   ProviderConfig
+	mu       sync.Mutex
+	oauth2   *oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+// Providers is the set of configured identity providers, keyed by name.
+type Providers struct {
+	providers map[string]*Provider
+}
+
+// ParseProviderConfig() parses a provider from a comma separated list of key=value
+// pairs, for example:
+//
+//	name=google,issuer=https://accounts.google.com,client-id=ID,client-secret=SECRET
+//
+// An optional scopes key takes a space separated list of extra scopes.
+func ParseProviderConfig(value string) (ProviderConfig, error) {
+	var cfg ProviderConfig
+	for _, pair := range strings.Split(value, ",") {
+		key, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return cfg, fmt.Errorf("invalid identity provider setting %q", pair)
+		}
+		switch key {
+		case "name":
+			cfg.Name = val
+		case "issuer":
+			cfg.IssuerURL = val
+		case "client-id":
+			cfg.ClientID = val
+		case "client-secret":
+			cfg.ClientSecret = val
+		case "scopes":
+			cfg.Scopes = strings.Fields(val)
+		default:
+			return cfg, fmt.Errorf("unknown identity provider setting %q", key)
+		}
+	}
+	if cfg.Name == "" || cfg.IssuerURL == "" || cfg.ClientID == "" {
+		return cfg, errors.New("identity provider requires name, issuer and client-id")
+	}
+	return cfg, nil
+}
+
+// New() builds the provider set. Each provider's redirect URL is derived from
+// redirectBaseURL as <redirectBaseURL>/<name>/callback.
+func New(redirectBaseURL string, configs []ProviderConfig) (*Providers, error) {
+	providers := &Providers{providers: make(map[string]*Provider)}
+	for _, cfg := range configs {
+		if _, exists := providers.providers[cfg.Name]; exists {
+			return nil, fmt.Errorf("duplicate identity provider %q", cfg.Name)
+		}
+		if cfg.RedirectURL == "" {
+			cfg.RedirectURL = strings.TrimSuffix(redirectBaseURL, "/") + "/" + cfg.Name + "/callback"
+		}
+		providers.providers[cfg.Name] = &Provider{config: cfg}
+	}
+	return providers, nil
+}
+
+// Get() returns the named provider.
+func (ps *Providers) Get(name string) (*Provider, error) {
+	provider, ok := ps.providers[name]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	return provider, nil
+}
+
+// Names() lists the configured providers in alphabetical order.
+func (ps *Providers) Names() []string {
+	names := make([]string, 0, len(ps.providers))
+	for name := range ps.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Name() returns the name the provider was configured with.
+func (p *Provider) Name() string {
+	return p.config.Name
+}
+
+// discover() fetches the provider's OpenID configuration the first time it is needed.
+func (p *Provider) discover(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.oauth2 != nil {
+		return nil
+	}
+	provider, err := oidc.NewProvider(ctx, p.config.IssuerURL)
+	if err != nil {
+		return err
+	}
+	p.oauth2 = &oauth2.Config{
+		ClientID:     p.config.ClientID,
+		ClientSecret: p.config.ClientSecret,
+		RedirectURL:  p.config.RedirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       append([]string{oidc.ScopeOpenID, "email", "profile"}, p.config.Scopes...),
+	}
+	p.verifier = provider.Verifier(&oidc.Config{ClientID: p.config.ClientID})
+	return nil
+}
+
+// AuthCodeURL() returns the URL to send the user to. The code challenge is derived from
+// codeVerifier using S256, and the nonce is echoed back inside the ID token.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, codeVerifier, nonce string) (string, error) {
+	err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	return p.oauth2.AuthCodeURL(state, oauth2.S256ChallengeOption(codeVerifier), oidc.Nonce(nonce)), nil
+}
+
+// Exchange() swaps an authorization code for tokens and returns the claims of the
+// verified ID token, making sure it was issued for the login request with this nonce.
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*Claims, error) {
+	err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	token, err := p.oauth2.Exchange(ctx, code, oauth2.VerifierOption(codeVerifier))
+	if err != nil {
+		return nil, err
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return nil, ErrMissingIDToken
+	}
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, err
+	}
+	if idToken.Nonce != nonce {
+		return nil, ErrNonceMismatch
+	}
+	var claims Claims
+	err = idToken.Claims(&claims)
+	if err != nil {
+		return nil, err
+	}
+	return &claims, nil
+}
+
+// GenerateSecret() returns a random, URL safe string suitable for use as a state,
+// nonce or PKCE code verifier.
+func GenerateSecret() string {
+	return oauth2.GenerateVerifier()
+}
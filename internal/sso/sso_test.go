@@ -0,0 +1,153 @@
+package sso_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/Blue-Davinci/musical-zoe/internal/sso"
+	"github.com/Blue-Davinci/musical-zoe/internal/sso/ssotest"
+)
+
+// authorize() follows the provider's authorization URL and returns the code and state
+// that the mock issuer redirects back with.
+func authorize(t *testing.T, authURL string) (string, string) {
+	t.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatalf("authorize request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("expected status %d, got %d", http.StatusFound, resp.StatusCode)
+	}
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("invalid redirect location: %v", err)
+	}
+	return location.Query().Get("code"), location.Query().Get("state")
+}
+
+func newProvider(t *testing.T, issuer *ssotest.Issuer) *sso.Provider {
+	t.Helper()
+	providers, err := sso.New("http://localhost:4000/v1/api/authentication/oidc", []sso.ProviderConfig{{
+		Name:         "mock",
+		IssuerURL:    issuer.URL,
+		ClientID:     ssotest.ClientID,
+		ClientSecret: ssotest.ClientSecret,
+	}})
+	if err != nil {
+		t.Fatalf("failed to create providers: %v", err)
+	}
+	provider, err := providers.Get("mock")
+	if err != nil {
+		t.Fatalf("failed to get provider: %v", err)
+	}
+	return provider
+}
+
+func TestProviderExchange(t *testing.T) {
+	issuer, err := ssotest.NewIssuer()
+	if err != nil {
+		t.Fatalf("failed to start mock issuer: %v", err)
+	}
+	defer issuer.Close()
+	identity := ssotest.Identity{
+		Subject:       "subject-123",
+		Email:         "jane@example.com",
+		EmailVerified: true,
+		Name:          "Jane Doe",
+	}
+	issuer.SetIdentity(identity)
+
+	tests := []struct {
+		name          string
+		exchangeNonce string
+		wrongVerifier bool
+		expectError   bool
+	}{
+		{name: "valid login", exchangeNonce: "nonce"},
+		{name: "nonce mismatch", exchangeNonce: "other-nonce", expectError: true},
+		{name: "wrong code verifier", exchangeNonce: "nonce", wrongVerifier: true, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			provider := newProvider(t, issuer)
+			state, verifier := sso.GenerateSecret(), sso.GenerateSecret()
+			authURL, err := provider.AuthCodeURL(ctx, state, verifier, "nonce")
+			if err != nil {
+				t.Fatalf("failed to build auth URL: %v", err)
+			}
+			code, returnedState := authorize(t, authURL)
+			if returnedState != state {
+				t.Errorf("expected state %q, got %q", state, returnedState)
+			}
+			if tt.wrongVerifier {
+				verifier = sso.GenerateSecret()
+			}
+			claims, err := provider.Exchange(ctx, code, verifier, tt.exchangeNonce)
+			if tt.expectError {
+				if err == nil {
+					t.Error("expected an error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if claims.Subject != identity.Subject || claims.Email != identity.Email || !claims.EmailVerified || claims.Name != identity.Name {
+				t.Errorf("unexpected claims: %+v", claims)
+			}
+		})
+	}
+}
+
+func TestParseProviderConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		expected    sso.ProviderConfig
+		expectError bool
+	}{
+		{
+			name:  "full config",
+			input: "name=google,issuer=https://accounts.google.com,client-id=id,client-secret=secret,scopes=a b",
+			expected: sso.ProviderConfig{
+				Name:         "google",
+				IssuerURL:    "https://accounts.google.com",
+				ClientID:     "id",
+				ClientSecret: "secret",
+				Scopes:       []string{"a", "b"},
+			},
+		},
+		{name: "missing issuer", input: "name=google,client-id=id", expectError: true},
+		{name: "unknown key", input: "name=google,issuer=x,client-id=id,colour=blue", expectError: true},
+		{name: "malformed pair", input: "google", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := sso.ParseProviderConfig(tt.input)
+			if tt.expectError {
+				if err == nil {
+					t.Error("expected an error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if cfg.Name != tt.expected.Name || cfg.IssuerURL != tt.expected.IssuerURL ||
+				cfg.ClientID != tt.expected.ClientID || cfg.ClientSecret != tt.expected.ClientSecret ||
+				len(cfg.Scopes) != len(tt.expected.Scopes) {
+				t.Errorf("expected %+v, got %+v", tt.expected, cfg)
+			}
+		})
+	}
+}
@@ -0,0 +1,222 @@
+// Package ssotest provides a local OpenID Connect issuer for exercising the sso
+// package, and the handlers built on it, without a real identity provider.
+package ssotest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	jose "github.com/go-jose/go-jose/v4"
+)
+
+const (
+	ClientID     = "musicalzoe-test"
+	ClientSecret = "musicalzoe-test-secret"
+	keyID        = "ssotest"
+)
+
+// Identity is the user the issuer signs in on the next authorization request.
+type Identity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// pendingCode is an issued authorization code waiting to be exchanged.
+type pendingCode struct {
+	identity      Identity
+	nonce         string
+	codeChallenge string
+	redirectURI   string
+}
+
+// Issuer is a minimal OpenID Connect provider supporting discovery, the
+// authorization-code flow with PKCE (S256) and RS256 signed ID tokens. Authorization
+// requests are approved immediately for the identity set with SetIdentity().
+type Issuer struct {
+	*httptest.Server
+	key      *rsa.PrivateKey
+	mu       sync.Mutex
+	identity Identity
+	codes    map[string]pendingCode
+}
+
+// NewIssuer() starts a new mock issuer. Call Close() when done with it.
+func NewIssuer() (*Issuer, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	issuer := &Issuer{
+		key:   key,
+		codes: make(map[string]pendingCode),
+		identity: Identity{
+			Subject:       "ssotest-user",
+			Email:         "listener@example.com",
+			EmailVerified: true,
+			Name:          "Test Listener",
+		},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", issuer.discoveryHandler)
+	mux.HandleFunc("GET /keys", issuer.keysHandler)
+	mux.HandleFunc("GET /authorize", issuer.authorizeHandler)
+	mux.HandleFunc("POST /token", issuer.tokenHandler)
+	issuer.Server = httptest.NewServer(mux)
+	return issuer, nil
+}
+
+// SetIdentity() changes the user that subsequent authorization requests sign in.
+func (i *Issuer) SetIdentity(identity Identity) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.identity = identity
+}
+
+func (i *Issuer) discoveryHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                i.URL,
+		"authorization_endpoint":                i.URL + "/authorize",
+		"token_endpoint":                        i.URL + "/token",
+		"jwks_uri":                              i.URL + "/keys",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (i *Issuer) keysHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{
+		Key:       &i.key.PublicKey,
+		KeyID:     keyID,
+		Algorithm: string(jose.RS256),
+		Use:       "sig",
+	}}})
+}
+
+// authorizeHandler() approves the request straight away and redirects back to the
+// client with a code, as a real provider would after the user signs in.
+func (i *Issuer) authorizeHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("client_id") != ClientID || query.Get("response_type") != "code" {
+		http.Error(w, "invalid_request", http.StatusBadRequest)
+		return
+	}
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		http.Error(w, "invalid_request: PKCE is required", http.StatusBadRequest)
+		return
+	}
+	redirectURI, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || redirectURI.String() == "" {
+		http.Error(w, "invalid_request: bad redirect_uri", http.StatusBadRequest)
+		return
+	}
+	code := rand.Text()
+	i.mu.Lock()
+	i.codes[code] = pendingCode{
+		identity:      i.identity,
+		nonce:         query.Get("nonce"),
+		codeChallenge: query.Get("code_challenge"),
+		redirectURI:   redirectURI.String(),
+	}
+	i.mu.Unlock()
+	params := redirectURI.Query()
+	params.Set("code", code)
+	params.Set("state", query.Get("state"))
+	redirectURI.RawQuery = params.Encode()
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+// tokenHandler() exchanges a code for an ID token after checking the client
+// credentials and the PKCE code verifier.
+func (i *Issuer) tokenHandler(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		writeTokenError(w, "invalid_request")
+		return
+	}
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if clientID != ClientID || clientSecret != ClientSecret {
+		writeTokenError(w, "invalid_client")
+		return
+	}
+	code := r.PostForm.Get("code")
+	i.mu.Lock()
+	pending, ok := i.codes[code]
+	delete(i.codes, code)
+	i.mu.Unlock()
+	if !ok || r.PostForm.Get("grant_type") != "authorization_code" || r.PostForm.Get("redirect_uri") != pending.redirectURI {
+		writeTokenError(w, "invalid_grant")
+		return
+	}
+	challenge := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(challenge[:]) != pending.codeChallenge {
+		writeTokenError(w, "invalid_grant")
+		return
+	}
+	idToken, err := i.signIDToken(pending)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": rand.Text(),
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+// signIDToken() builds and signs the ID token for an exchanged code.
+func (i *Issuer) signIDToken(pending pendingCode) (string, error) {
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.RS256, Key: i.key},
+		(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", keyID),
+	)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	payload, err := json.Marshal(map[string]any{
+		"iss":            i.URL,
+		"sub":            pending.identity.Subject,
+		"aud":            ClientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+		"nonce":          pending.nonce,
+		"email":          pending.identity.Email,
+		"email_verified": pending.identity.EmailVerified,
+		"name":           pending.identity.Name,
+	})
+	if err != nil {
+		return "", err
+	}
+	signed, err := signer.Sign(payload)
+	if err != nil {
+		return "", err
+	}
+	return signed.CompactSerialize()
+}
+
+func writeJSON(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
+
+func writeTokenError(w http.ResponseWriter, code string) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{"error": code})
+}
@@ -8,6 +8,8 @@ import (
 // taken from https://html.spec.whatwg.org/#valid-e-mail-address.
 var (
 	EmailRX = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+\\/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
+	// TOTPCodeRX matches the 6 digit codes produced by TOTP authenticator apps.
+	TOTPCodeRX = regexp.MustCompile(`^[0-9]{6}$`)
 )
 
 // Define a new Validator type which contains a map of validation errors.